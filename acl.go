@@ -1,42 +1,42 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 // GetACLInfo fetches both the abstract and authors from an ACL Anthology page
-func GetACLInfo(aclURL string) (string, []string, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
+func GetACLInfo(ctx context.Context, f Fetcher, aclURL string) (string, []string, error) {
 	// Make the request
-	resp, err := client.Get(aclURL)
+	req, err := newGetRequest(ctx, aclURL)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to fetch ACL page: %v", err)
+		return "", nil, err
+	}
+	resp, err := f.Do(req)
+	if err != nil {
+		return "", nil, newFetchError(sourceACL, aclURL, ErrNetwork, "failed to fetch ACL page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check for rate limiting
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return "", nil, fmt.Errorf("Rate limited by ACL Anthology. Please wait a few minutes before trying again.")
+		return "", nil, newFetchError(sourceACL, aclURL, ErrRateLimited, "Rate limited by ACL Anthology. Please wait a few minutes before trying again.")
 	}
 
 	// Check for other errors
 	if resp.StatusCode != http.StatusOK {
-		return "", nil, fmt.Errorf("failed to fetch ACL page: status code %d", resp.StatusCode)
+		return "", nil, newFetchError(sourceACL, aclURL, statusKind(resp.StatusCode), "failed to fetch ACL page: status code %d", resp.StatusCode)
 	}
 
 	// Parse the HTML
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse HTML: %v", err)
+		return "", nil, newFetchError(sourceACL, aclURL, ErrParseFailed, "failed to parse HTML: %w", err)
 	}
 
 	// Extract abstract
@@ -58,14 +58,14 @@ func GetACLInfo(aclURL string) (string, []string, error) {
 }
 
 // GetACLAbstract fetches the abstract from an ACL Anthology page
-func GetACLAbstract(aclURL string) (string, error) {
-	abstract, _, err := GetACLInfo(aclURL)
+func GetACLAbstract(ctx context.Context, f Fetcher, aclURL string) (string, error) {
+	abstract, _, err := GetACLInfo(ctx, f, aclURL)
 	return abstract, err
 }
 
 // GetACLAuthors fetches the authors from an ACL Anthology page
-func GetACLAuthors(aclURL string) ([]string, error) {
-	_, authors, err := GetACLInfo(aclURL)
+func GetACLAuthors(ctx context.Context, f Fetcher, aclURL string) ([]string, error) {
+	_, authors, err := GetACLInfo(ctx, f, aclURL)
 	return authors, err
 }
 
@@ -73,3 +73,26 @@ func GetACLAuthors(aclURL string) ([]string, error) {
 func IsACLURL(url string) bool {
 	return strings.Contains(url, "aclanthology.org")
 }
+
+// aclYearRegex matches the year in new (2023.acl-long.1) and old (P19-1001)
+// ACL Anthology IDs
+var aclYearRegex = regexp.MustCompile(`aclanthology\.org/(?:(\d{4})\.|[A-Z](\d{2})-\d)`)
+
+// GetACLYear returns the year of an ACL Anthology paper, from its ID, or 0
+// if the URL has no ID
+func GetACLYear(aclURL string) int {
+	matches := aclYearRegex.FindStringSubmatch(aclURL)
+	switch {
+	case matches == nil:
+		return 0
+	case matches[1] != "":
+		year, _ := strconv.Atoi(matches[1])
+		return year
+	}
+	// Old IDs start in 1965
+	yy, _ := strconv.Atoi(matches[2])
+	if yy >= 50 {
+		return 1900 + yy
+	}
+	return 2000 + yy
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -45,6 +46,24 @@ func TestIsACLURL(t *testing.T) {
 	}
 }
 
+func TestGetACLYear(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"https://aclanthology.org/2023.acl-long.123/", 2023},
+		{"https://aclanthology.org/P19-1001.pdf", 2019},
+		{"https://aclanthology.org/C65-1001", 1965},
+		{"https://aclanthology.org/events/acl-2023/", 0},
+	}
+
+	for _, tt := range tests {
+		if result := GetACLYear(tt.url); result != tt.expected {
+			t.Errorf("GetACLYear(%q) = %d; want %d", tt.url, result, tt.expected)
+		}
+	}
+}
+
 func TestGetACLInfo(t *testing.T) {
 	// Create a mock server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -69,7 +88,7 @@ func TestGetACLInfo(t *testing.T) {
 	defer server.Close()
 
 	// Test successful case
-	abstract, authors, err := GetACLInfo(server.URL)
+	abstract, authors, err := GetACLInfo(context.Background(), testFetcher(t), server.URL)
 	if err != nil {
 		t.Fatalf("GetACLInfo failed: %v", err)
 	}
@@ -93,7 +112,7 @@ func TestGetACLInfo(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	_, _, err = GetACLInfo(rateLimitServer.URL)
+	_, _, err = GetACLInfo(context.Background(), testFetcher(t), rateLimitServer.URL)
 	if err == nil {
 		t.Error("Expected error for rate limiting, got nil")
 	}
@@ -117,7 +136,7 @@ func TestGetACLAbstract(t *testing.T) {
 	}))
 	defer server.Close()
 
-	abstract, err := GetACLAbstract(server.URL)
+	abstract, err := GetACLAbstract(context.Background(), testFetcher(t), server.URL)
 	if err != nil {
 		t.Fatalf("GetACLAbstract failed: %v", err)
 	}
@@ -144,7 +163,7 @@ func TestGetACLAuthors(t *testing.T) {
 	}))
 	defer server.Close()
 
-	authors, err := GetACLAuthors(server.URL)
+	authors, err := GetACLAuthors(context.Background(), testFetcher(t), server.URL)
 	if err != nil {
 		t.Fatalf("GetACLAuthors failed: %v", err)
 	}
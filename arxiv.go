@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"log/slog"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -41,42 +43,82 @@ func GetArxivID(arxivURL string) string {
 	return ""
 }
 
+// arxivYearRegex matches the YYMM that starts both new (2311.09862) and old
+// (hep-th/9901001) arXiv IDs
+var arxivYearRegex = regexp.MustCompile(`arxiv\.org/(?:abs|pdf)/(?:[a-z-]+(?:\.[A-Z]{2})?/)?(\d{2})(\d{2})`)
+
+// GetArxivYear returns the year an arXiv paper was submitted, from its ID,
+// or 0 if the URL has no ID
+func GetArxivYear(arxivURL string) int {
+	matches := arxivYearRegex.FindStringSubmatch(arxivURL)
+	if matches == nil {
+		return 0
+	}
+	yy, _ := strconv.Atoi(matches[1])
+	// arXiv started in 1991
+	if yy >= 91 {
+		return 1900 + yy
+	}
+	return 2000 + yy
+}
+
+// GetArxivMonth returns the month an arXiv paper was submitted as "2006-01",
+// from its ID, or "" if the URL has no ID
+func GetArxivMonth(arxivURL string) string {
+	year := GetArxivYear(arxivURL)
+	if year == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%s", year, arxivYearRegex.FindStringSubmatch(arxivURL)[2])
+}
+
 // GetArxivSummary fetches the abstract/summary from an arXiv page
-func GetArxivSummary(arxivURL string) (string, error) {
-	fmt.Printf("Fetching abstract from: %s\n", arxivURL)
+func GetArxivSummary(ctx context.Context, f Fetcher, arxivURL string) (string, error) {
+	info, err := GetArxivInfo(ctx, f, arxivURL)
+	return info.Summary, err
+}
+
+// ArxivInfo is what an arXiv abstract page says about a paper
+type ArxivInfo struct {
+	Title   string
+	Summary string
+	Authors []string
+}
 
-	// Create HTTP client
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", arxivURL, nil)
+// GetArxivInfo fetches the title, the abstract and the authors from an arXiv page
+func GetArxivInfo(ctx context.Context, f Fetcher, arxivURL string) (ArxivInfo, error) {
+	var info ArxivInfo
+	req, err := newGetRequest(ctx, arxivURL)
 	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return "", err
+		return info, err
 	}
 
-	// Set headers to mimic a browser
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
-
-	resp, err := client.Do(req)
+	resp, err := f.Do(req)
 	if err != nil {
-		fmt.Printf("Error making request: %v\n", err)
-		return "", err
+		return info, newFetchError(sourceArxiv, arxivURL, ErrNetwork, "failed to fetch arXiv page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		fmt.Printf("Bad status code: %d\n", resp.StatusCode)
-		return "", fmt.Errorf("failed to fetch arXiv page: %s", resp.Status)
+		return info, newFetchError(sourceArxiv, arxivURL, statusKind(resp.StatusCode), "failed to fetch arXiv page: %s", resp.Status)
 	}
 
 	// Parse the HTML response
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		fmt.Printf("Error parsing HTML: %v\n", err)
-		return "", err
+		return info, newFetchError(sourceArxiv, arxivURL, ErrParseFailed, "failed to parse HTML: %w", err)
 	}
 
+	titleBlock := doc.Find("h1.title").First()
+	titleBlock.Find("span.descriptor").Remove()
+	info.Title = strings.Join(strings.Fields(titleBlock.Text()), " ")
+
+	doc.Find("div.authors a").Each(func(i int, s *goquery.Selection) {
+		if author := strings.TrimSpace(s.Text()); author != "" {
+			info.Authors = append(info.Authors, author)
+		}
+	})
+
 	// Find the abstract using the correct selector
 	abstractBlock := doc.Find("blockquote.abstract.mathjax")
 	if abstractBlock.Length() > 0 {
@@ -84,18 +126,17 @@ func GetArxivSummary(arxivURL string) (string, error) {
 		abstractBlock.Find("span.descriptor").Remove()
 
 		// Get the text content and clean it
-		summary := abstractBlock.Text()
-		summary = strings.TrimSpace(summary)
-		fmt.Printf("Successfully found abstract, length: %d\n", len(summary))
-		return summary, nil
+		info.Summary = strings.TrimSpace(abstractBlock.Text())
+		slog.Debug("Found arXiv abstract", "url", arxivURL, "length", len(info.Summary), "authors", len(info.Authors))
+		return info, nil
 	}
 
-	fmt.Printf("No abstract found with selector 'blockquote.abstract.mathjax'\n")
-	// If we reach here, we couldn't find the abstract
-	return "", fmt.Errorf("abstract not found on page")
+	// If we reach here, the page layout isn't what we expect
+	return info, newFetchError(sourceArxiv, arxivURL, ErrParseFailed, "abstract not found on page")
 }
 
-// GetDirectScholarURL constructs a direct Google Scholar URL for an arXiv paper
-func GetDirectScholarURL(arxivID string) string {
-	return fmt.Sprintf("https://scholar.google.com/scholar?q=arxiv:%s", arxivID)
+// GetDirectScholarURL constructs a direct Google Scholar URL for an arXiv paper.
+// scholarURL is the Google Scholar base URL, e.g. https://scholar.google.com
+func GetDirectScholarURL(scholarURL, arxivID string) string {
+	return fmt.Sprintf("%s/scholar?q=arxiv:%s", scholarURL, arxivID)
 }
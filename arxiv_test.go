@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetArxivSummary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`
+			<html>
+				<body>
+					<blockquote class="abstract mathjax">
+						<span class="descriptor">Abstract:</span>
+						We study graphs.
+					</blockquote>
+				</body>
+			</html>
+		`))
+	}))
+	defer server.Close()
+
+	summary, err := GetArxivSummary(context.Background(), testFetcher(t), server.URL)
+	if err != nil {
+		t.Fatalf("GetArxivSummary failed: %v", err)
+	}
+	if summary != "We study graphs." {
+		t.Errorf("Expected summary 'We study graphs.', got %q", summary)
+	}
+}
+
+func TestGetArxivInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`
+			<html>
+				<body>
+					<h1 class="title mathjax"><span class="descriptor">Title:</span>Attention Is All You Need</h1>
+					<div class="authors"><span class="descriptor">Authors:</span><a href="/a/vaswani_a_1">Ashish Vaswani</a>, <a href="/a/shazeer_n_1">Noam Shazeer</a></div>
+					<blockquote class="abstract mathjax">
+						<span class="descriptor">Abstract:</span>
+						We study attention.
+					</blockquote>
+				</body>
+			</html>
+		`))
+	}))
+	defer server.Close()
+
+	info, err := GetArxivInfo(context.Background(), testFetcher(t), server.URL)
+	if err != nil {
+		t.Fatalf("GetArxivInfo failed: %v", err)
+	}
+	if info.Title != "Attention Is All You Need" {
+		t.Errorf("Unexpected title %q", info.Title)
+	}
+	if info.Summary != "We study attention." {
+		t.Errorf("Expected summary 'We study attention.', got %q", info.Summary)
+	}
+	if len(info.Authors) != 2 || info.Authors[0] != "Ashish Vaswani" || info.Authors[1] != "Noam Shazeer" {
+		t.Errorf("Unexpected authors %q", info.Authors)
+	}
+}
+
+func TestGetArxivSummaryCancelled(t *testing.T) {
+	// A server that never answers
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := GetArxivSummary(ctx, testFetcher(t), server.URL)
+	if err == nil {
+		t.Fatal("Expected error for cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GetArxivSummary took %v after cancellation", elapsed)
+	}
+}
+
+func TestConvertPDFtoAbsURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://arxiv.org/pdf/2311.09862", "https://arxiv.org/abs/2311.09862"},
+		{"https://arxiv.org/pdf/2311.09862.pdf", "https://arxiv.org/abs/2311.09862"},
+		{"https://arxiv.org/abs/2311.09862", "https://arxiv.org/abs/2311.09862"},
+	}
+
+	for _, tt := range tests {
+		if result := ConvertPDFtoAbsURL(tt.url); result != tt.expected {
+			t.Errorf("ConvertPDFtoAbsURL(%q) = %q; want %q", tt.url, result, tt.expected)
+		}
+	}
+}
+
+func TestGetArxivYear(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"https://arxiv.org/abs/2311.09862", 2023},
+		{"https://arxiv.org/pdf/0704.0001v2", 2007},
+		{"https://arxiv.org/abs/hep-th/9901001", 1999},
+		{"https://arxiv.org/abs/math.GT/0309136", 2003},
+		{"https://arxiv.org/list/cs.LG/recent", 0},
+	}
+
+	for _, tt := range tests {
+		if result := GetArxivYear(tt.url); result != tt.expected {
+			t.Errorf("GetArxivYear(%q) = %d; want %d", tt.url, result, tt.expected)
+		}
+	}
+}
+
+func TestGetArxivMonth(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://arxiv.org/abs/2311.09862", "2023-11"},
+		{"https://arxiv.org/abs/hep-th/9901001", "1999-01"},
+		{"https://arxiv.org/list/cs.LG/recent", ""},
+	}
+
+	for _, tt := range tests {
+		if result := GetArxivMonth(tt.url); result != tt.expected {
+			t.Errorf("GetArxivMonth(%q) = %q; want %q", tt.url, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// canonicalArxivIDRegex matches new-style (2311.09862) and old-style
+	// (hep-th/9901001) arXiv IDs, with an optional version
+	canonicalArxivIDRegex = regexp.MustCompile(`^(\d{4}\.\d{4,5}|[a-z-]+(?:\.[A-Z]{2})?/\d{7})(?:v\d+)?$`)
+	// arxivPathRegex matches the paths of arXiv abstract and PDF pages
+	arxivPathRegex = regexp.MustCompile(`^/(?:abs|pdf)/(.+?)(?:\.pdf)?$`)
+	// canonicalDOIRegex matches DOIs like 10.1145/3292500.3330701
+	canonicalDOIRegex = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+)
+
+// canonicalURL returns the form a paper URL is stored under, the same the UI
+// server stores the papers added through it under, so a paper listed and
+// added is stored once. arXiv IDs and abstract and PDF URLs become
+// https://arxiv.org/abs/ID without a version, DOIs and their URLs
+// https://doi.org/DOI, and other URLs lose their fragment and tracking
+// parameters. URLs the server would reject are kept as they are.
+// server/testdata/canonical_urls.json has the cases both must agree on.
+func canonicalURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	id := strings.TrimPrefix(strings.TrimPrefix(raw, "arXiv:"), "arxiv:")
+	if m := canonicalArxivIDRegex.FindStringSubmatch(id); m != nil {
+		return "https://arxiv.org/abs/" + m[1]
+	}
+	if doi := strings.TrimPrefix(raw, "doi:"); canonicalDOIRegex.MatchString(doi) {
+		return "https://doi.org/" + doi
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if (u.Scheme != "http" && u.Scheme != "https") || host == "" {
+		return raw
+	}
+
+	switch host {
+	case "arxiv.org", "www.arxiv.org", "export.arxiv.org":
+		if m := arxivPathRegex.FindStringSubmatch(strings.TrimSuffix(u.Path, "/")); m != nil {
+			if id := canonicalArxivIDRegex.FindStringSubmatch(m[1]); id != nil {
+				return "https://arxiv.org/abs/" + id[1]
+			}
+		}
+	case "doi.org", "dx.doi.org", "www.doi.org":
+		return "https://doi.org/" + strings.TrimPrefix(u.Path, "/")
+	}
+
+	// Keep the port only when it isn't the default one
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+	if u.Path != "/" {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	// Tracking parameters don't identify the paper
+	query := u.Query()
+	for name := range query {
+		if strings.HasPrefix(name, "utm_") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// urlTables are the tables other than paper_cache that hold papers by URL
+var urlTables = []string{"paper_tags", "fetch_failures", "citation_history", "collection_papers", "annotations"}
+
+// canonicalizeURLs moves the papers stored under a URL that isn't canonical,
+// by older versions, to their canonical URL. A paper stored under both, like
+// a listed one the UI server added again, keeps the canonical row unless it
+// is still pending, and gets the other's tags, history, collections and
+// annotations.
+func canonicalizeURLs(db *sql.DB) error {
+	rows, err := db.Query("SELECT url FROM paper_cache")
+	if err != nil {
+		return fmt.Errorf("failed to read paper URLs: %v", err)
+	}
+	moved := make(map[string]string)
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read paper URLs: %v", err)
+		}
+		if canonical := canonicalURL(url); canonical != url {
+			moved[url] = canonical
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read paper URLs: %v", err)
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for url, canonical := range moved {
+		// A pending paper hasn't been fetched, so the moved one has more
+		if _, err := tx.Exec("DELETE FROM paper_cache WHERE url = ? AND pending = 1", canonical); err != nil {
+			return fmt.Errorf("failed to move %s: %v", url, err)
+		}
+		// Rows the canonical URL already has win over the moved ones
+		for _, table := range urlTables {
+			if _, err := tx.Exec("UPDATE OR IGNORE "+table+" SET url = ? WHERE url = ?", canonical, url); err != nil {
+				return fmt.Errorf("failed to move %s of %s: %v", table, url, err)
+			}
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE url = ?", url); err != nil {
+				return fmt.Errorf("failed to move %s of %s: %v", table, url, err)
+			}
+		}
+		if _, err := tx.Exec("UPDATE OR IGNORE paper_cache SET url = ? WHERE url = ?", canonical, url); err != nil {
+			return fmt.Errorf("failed to move %s: %v", url, err)
+		}
+		if _, err := tx.Exec("DELETE FROM paper_cache WHERE url = ?", url); err != nil {
+			return fmt.Errorf("failed to move %s: %v", url, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	return nil
+}
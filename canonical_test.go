@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	// The server's cases, so lists and the server store papers alike
+	data, err := os.ReadFile("server/testdata/canonical_urls.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests []struct {
+		Input     string `json:"input"`
+		Canonical string `json:"canonical"`
+		Rejected  bool   `json:"rejected"`
+	}
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		want := tt.Canonical
+		if tt.Rejected {
+			want = strings.TrimSpace(tt.Input)
+		}
+		if got := canonicalURL(tt.Input); got != want {
+			t.Errorf("canonicalURL(%q) = %q; want %q", tt.Input, got, want)
+		}
+	}
+}
+
+func TestInitCacheCanonicalizesURLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := initCache(path); err != nil {
+		t.Fatal(err)
+	}
+	// What older versions stored for listed papers, and the server for one added again
+	_, err := cacheDB.Exec(`
+		INSERT INTO paper_cache (url, title, citations) VALUES ('https://arxiv.org/pdf/1706.03762v5', 'Attention', 100);
+		INSERT INTO fetch_failures (url, source, kind, error) VALUES ('https://arxiv.org/pdf/1706.03762v5', 'arxiv', 'network', 'timeout');
+		INSERT INTO citation_history (url, source, citations, fetched) VALUES ('https://arxiv.org/pdf/1706.03762v5', 'scholar', 100, '2024-01-01');
+		INSERT INTO collection_papers (collection, url) VALUES ('nlp', 'https://arxiv.org/pdf/1706.03762v5');
+		INSERT INTO paper_cache (url, title, timestamp, pending) VALUES ('https://arxiv.org/abs/1706.03762', 'arXiv:1706.03762', NULL, 1);
+		INSERT INTO paper_tags (url, tag) VALUES ('https://arxiv.org/abs/1706.03762', 'transformers');
+		INSERT INTO paper_cache (url, title) VALUES ('https://example.com/paper?utm_source=list', 'Example');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeCache()
+
+	if err := initCache(path); err != nil {
+		t.Fatalf("initCache failed: %v", err)
+	}
+	defer closeCache()
+
+	var count int
+	if err := cacheDB.QueryRow("SELECT COUNT(*) FROM paper_cache").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("Expected 2 papers, got %d, %v", count, err)
+	}
+	paper, err := getCachedPaper("https://arxiv.org/abs/1706.03762")
+	if err != nil || paper == nil || paper.Title != "Attention" || paper.Citations == nil || *paper.Citations != 100 {
+		t.Fatalf("Expected the fetched paper under its canonical URL, got %+v, %v", paper, err)
+	}
+	for table, want := range map[string]int{"citation_history": 1, "collection_papers": 1, "fetch_failures": 1, "paper_tags": 1} {
+		var n int
+		if err := cacheDB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE url = ?", "https://arxiv.org/abs/1706.03762").Scan(&n); err != nil || n != want {
+			t.Errorf("Expected %d rows of %s, got %d, %v", want, table, n, err)
+		}
+	}
+	if paper, err := getCachedPaper("https://example.com/paper"); err != nil || paper == nil {
+		t.Errorf("Expected the example paper without its tracking parameter, got %v", err)
+	}
+	var pending sql.NullString
+	if err := cacheDB.QueryRow("SELECT url FROM paper_cache WHERE pending = 1").Scan(&pending); err != sql.ErrNoRows {
+		t.Errorf("Expected no pending paper left, got %v", pending)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// collectionSchema records the markdown lists, or collections, the papers
+// come from: the file each was last read from, and for each paper the section
+// it is listed under, when it was first and last seen in the list and when it
+// was dropped from it.
+const collectionSchema = `
+	CREATE TABLE IF NOT EXISTS collections (
+		name TEXT PRIMARY KEY,
+		source TEXT NOT NULL,
+		synced DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS collection_papers (
+		collection TEXT NOT NULL,
+		url TEXT NOT NULL,
+		section TEXT NOT NULL DEFAULT '',
+		first_seen DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		removed DATETIME,
+		PRIMARY KEY (collection, url)
+	);
+	CREATE INDEX IF NOT EXISTS collection_papers_url ON collection_papers (url);
+`
+
+// CollectionEntry is a paper's place in a collection
+type CollectionEntry struct {
+	Collection string
+	Source     string // the list file
+	Section    string
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Removed    time.Time // zero while the paper is listed
+}
+
+// collectionName names the collection of a list file after the file, like
+// graph-papers for lists/graph-papers.md
+func collectionName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// syncCollection records the papers read from a list file as its collection.
+// Papers new to it are first seen now, and those no longer in it are marked
+// removed rather than deleted; they come back if they are listed again.
+// Two lists with the same file name would be the same collection, dropping
+// each other's papers, so a list is refused while another of its name exists.
+func syncCollection(file string, papers []Paper) (added, removed int, err error) {
+	if cacheDB == nil {
+		return 0, 0, nil
+	}
+	name := collectionName(file)
+	source, err := filepath.Abs(file)
+	if err != nil {
+		source = file
+	}
+	now := time.Now().UTC().Format(time.DateTime)
+
+	tx, err := cacheDB.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// A collection whose list no longer exists has moved to this one
+	var existing string
+	err = tx.QueryRow("SELECT source FROM collections WHERE name = ?", name).Scan(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, 0, fmt.Errorf("failed to read collection %s: %v", name, err)
+	}
+	if err == nil && existing != source {
+		if _, statErr := os.Stat(existing); statErr == nil {
+			return 0, 0, fmt.Errorf("%s and %s are both the collection %s, rename one of them", file, existing, name)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO collections (name, source, synced) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET source = excluded.source, synced = excluded.synced`, name, source, now)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to save collection %s: %v", name, err)
+	}
+
+	listed := make(map[string]bool)
+	for _, paper := range papers {
+		// A paper listed twice stays in its first section
+		if listed[paper.URL] {
+			continue
+		}
+		listed[paper.URL] = true
+
+		result, err := tx.Exec("UPDATE collection_papers SET section = ?, last_seen = ?, removed = NULL WHERE collection = ? AND url = ?",
+			paper.Section, now, name, paper.URL)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to update %s in %s: %v", paper.URL, name, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			continue
+		}
+		_, err = tx.Exec("INSERT INTO collection_papers (collection, url, section, first_seen, last_seen) VALUES (?, ?, ?, ?, ?)",
+			name, paper.URL, paper.Section, now, now)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to add %s to %s: %v", paper.URL, name, err)
+		}
+		added++
+	}
+
+	rows, err := tx.Query("SELECT url FROM collection_papers WHERE collection = ? AND removed IS NULL", name)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read collection %s: %v", name, err)
+	}
+	var dropped []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		if !listed[url] {
+			dropped = append(dropped, url)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	for _, url := range dropped {
+		if _, err := tx.Exec("UPDATE collection_papers SET removed = ? WHERE collection = ? AND url = ?", now, name, url); err != nil {
+			return 0, 0, fmt.Errorf("failed to remove %s from %s: %v", url, name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit: %v", err)
+	}
+	return added, len(dropped), nil
+}
+
+// getPaperCollections returns the collections a paper is or was in, by name
+func getPaperCollections(url string) ([]CollectionEntry, error) {
+	if cacheDB == nil {
+		return nil, nil
+	}
+	rows, err := cacheDB.Query(`
+		SELECT p.collection, c.source, p.section, p.first_seen, p.last_seen, p.removed
+		FROM collection_papers p JOIN collections c ON c.name = p.collection
+		WHERE p.url = ? ORDER BY p.collection`, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collections of %s: %v", url, err)
+	}
+	defer rows.Close()
+
+	var entries []CollectionEntry
+	for rows.Next() {
+		var entry CollectionEntry
+		var removed sql.NullTime
+		if err := rows.Scan(&entry.Collection, &entry.Source, &entry.Section, &entry.FirstSeen, &entry.LastSeen, &removed); err != nil {
+			return nil, err
+		}
+		entry.Removed = removed.Time
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
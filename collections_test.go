@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMarkdownSections(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "graph-papers.md")
+	list := "- Before [[paper](http://a)]\n## Surveys\n- Survey [[paper](http://b)]\n### Graph RAG \n- RAG [[paper](http://c)]\n"
+	if err := os.WriteFile(file, []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	papers, err := parseMarkdownPapers(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "Surveys", "Graph RAG"}
+	if len(papers) != len(want) {
+		t.Fatalf("Expected %d papers, got %+v", len(want), papers)
+	}
+	for i, paper := range papers {
+		if paper.Section != want[i] {
+			t.Errorf("Expected %s in section %q, got %q", paper.Title, want[i], paper.Section)
+		}
+	}
+}
+
+func TestSyncCollection(t *testing.T) {
+	setupTestCache(t)
+	for _, url := range []string{"http://a", "http://b", "http://c"} {
+		if err := savePaper(&Paper{Title: url, URL: url}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	added, removed, err := syncCollection("lists/graph-papers.md", []Paper{
+		{URL: "http://a", Section: "Surveys"},
+		{URL: "http://b"},
+		{URL: "http://a", Section: "Again"},
+	})
+	if err != nil || added != 2 || removed != 0 {
+		t.Fatalf("Expected 2 papers added, got %d added, %d removed, %v", added, removed, err)
+	}
+
+	// b is dropped from the list and a moves to another section
+	added, removed, err = syncCollection("lists/graph-papers.md", []Paper{{URL: "http://a", Section: "Models"}, {URL: "http://c"}})
+	if err != nil || added != 1 || removed != 1 {
+		t.Fatalf("Expected 1 paper added and 1 removed, got %d, %d, %v", added, removed, err)
+	}
+
+	entries, err := getPaperCollections("http://a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Collection != "graph-papers" || entries[0].Section != "Models" || !entries[0].Removed.IsZero() ||
+		filepath.Base(entries[0].Source) != "graph-papers.md" || entries[0].FirstSeen.IsZero() {
+		t.Errorf("Unexpected collections of a: %+v", entries)
+	}
+	if entries, _ := getPaperCollections("http://b"); len(entries) != 1 || entries[0].Removed.IsZero() {
+		t.Errorf("Expected b marked removed, got %+v", entries)
+	}
+
+	// Only papers still listed are in the collection; dropped ones stay cached
+	papers, err := listPapers(PaperFilter{Collection: "graph-papers", Sort: "title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(papers) != 2 || papers[0].URL != "http://a" || papers[1].URL != "http://c" {
+		t.Errorf("Expected a and c in the collection, got %+v", papers)
+	}
+	if paper, _ := getCachedPaper("http://b"); paper == nil {
+		t.Error("Expected b to stay cached")
+	}
+
+	// Listing a paper again brings it back
+	if _, _, err := syncCollection("graph-papers.md", []Paper{{URL: "http://b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := getPaperCollections("http://b"); len(entries) != 1 || !entries[0].Removed.IsZero() {
+		t.Errorf("Expected b listed again, got %+v", entries)
+	}
+
+	// Deleting a paper deletes its collections
+	if _, err := deletePapers([]string{"http://b"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := getPaperCollections("http://b"); len(entries) != 0 {
+		t.Errorf("Expected no collections of a deleted paper, got %+v", entries)
+	}
+}
+
+func TestSyncCollectionsOfTheSameName(t *testing.T) {
+	setupTestCache(t)
+	dir := t.TempDir()
+	var lists []string
+	for _, sub := range []string{"a", "b"} {
+		list := filepath.Join(dir, sub, "papers.md")
+		if err := os.MkdirAll(filepath.Dir(list), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(list, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		lists = append(lists, list)
+	}
+
+	if _, _, err := syncCollection(lists[0], []Paper{{URL: "http://a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := syncCollection(lists[1], []Paper{{URL: "http://b"}}); err == nil {
+		t.Error("Expected an error for a second list named papers")
+	}
+	if entries, _ := getPaperCollections("http://a"); len(entries) != 1 || !entries[0].Removed.IsZero() {
+		t.Errorf("Expected a to stay listed, got %+v", entries)
+	}
+
+	// Once the first list is gone, the collection follows the second
+	if err := os.Remove(lists[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, removed, err := syncCollection(lists[1], []Paper{{URL: "http://b"}}); err != nil || removed != 1 {
+		t.Errorf("Expected the moved list to drop a, got %d removed, %v", removed, err)
+	}
+}
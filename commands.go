@@ -0,0 +1,783 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a collector subcommand
+type command struct {
+	name    string
+	args    string // synopsis of positional arguments
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"fetch", "[file.md ...]", "Fetch citation counts for the papers in markdown lists", runFetch},
+		{"list", "", "List cached papers", runList},
+		{"show", "<id|url>", "Show everything cached about one paper", runShow},
+		{"export", "", "Export cached papers as CSV, JSON or markdown", runExport},
+		{"refresh", "[url ...]", "Refetch selected cached papers", runRefresh},
+		{"stats", "", "Summarize the cache", runStats},
+		{"prune", "<file.md ...>", "Remove cached papers that are no longer in any list", runPrune},
+		{"cache", "purge", "Manage the on-disk HTTP response cache", runCache},
+		{"daemon", "[file.md ...]", "Keep the cache fresh on a schedule", runDaemon},
+	}
+}
+
+// findCommand returns the command with the given name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// printUsage prints the list of commands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: most-cited-papers <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'most-cited-papers <command> -h' for help on a command.")
+}
+
+// commonFlags are the flags shared by all commands
+type commonFlags struct {
+	config    string
+	dbPath    string
+	logLevel  string
+	logFormat string
+	debug     bool
+}
+
+// newFlagSet creates the flag set for a command, with the flags shared by all commands
+func newFlagSet(cmd string) (*flag.FlagSet, *commonFlags) {
+	c := findCommand(cmd)
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		synopsis := strings.TrimSpace("most-cited-papers " + c.name + " [flags] " + c.args)
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s.\n\nFlags:\n", synopsis, c.summary)
+		fs.PrintDefaults()
+	}
+
+	common := &commonFlags{}
+	fs.StringVar(&common.config, "config", "", "YAML config file (default $MCP_CONFIG or "+defaultConfigFile+" if present)")
+	fs.StringVar(&common.dbPath, "db", defaultDBPath, "Path to the SQLite database file")
+	fs.StringVar(&common.logLevel, "log-level", "info", "Log level: debug, info, warn or error")
+	fs.StringVar(&common.logFormat, "log-format", "text", "Log format: text or json")
+	fs.BoolVar(&common.debug, "debug", false, "Enable debug logging (same as -log-level debug)")
+	return fs, common
+}
+
+// parse parses the command line, fills in the flags that weren't given from
+// the config file and environment, and configures logging
+func (c *commonFlags) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(c.config)
+	if err != nil {
+		return err
+	}
+	if err := cfg.apply(fs); err != nil {
+		return err
+	}
+	if c.debug {
+		c.logLevel = "debug"
+	}
+	return setupLogging(os.Stderr, c.logLevel, c.logFormat)
+}
+
+// runFetch fetches citation counts for every paper in the given markdown files
+func runFetch(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("fetch")
+	inputFile := fs.String("input", "", "Input markdown file containing paper titles")
+	force := fs.Bool("force", false, "Force a fresh search, bypassing cache")
+	fetcherFlags := addFetcherFlags(fs)
+	reportFlags := addReportFlags(fs)
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+
+	collector, err := fetcherFlags()
+	if err != nil {
+		return err
+	}
+	reportOpts, err := reportFlags()
+	if err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if *inputFile != "" {
+		files = append([]string{*inputFile}, files...)
+	}
+	if len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input file specified")
+	}
+
+	var papers []Paper
+	lists := make([][]Paper, len(files))
+	for i, file := range files {
+		slog.Debug("Reading papers", "file", file)
+		filePapers, err := parseMarkdownPapers(file)
+		if err != nil {
+			return err
+		}
+		lists[i] = filePapers
+		papers = append(papers, filePapers...)
+	}
+	slog.Info("Found papers to process", "papers", len(papers), "force", *force)
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	for i, file := range files {
+		added, removed, err := syncCollection(file, lists[i])
+		if err != nil {
+			return err
+		}
+		slog.Info("Synced collection", "collection", collectionName(file), "papers", len(lists[i]), "added", added, "removed", removed)
+	}
+
+	report, runErr := collector.processPapers(ctx, papers, *force)
+	printResults(os.Stdout, papers[:report.Processed])
+
+	slog.Debug("Processing finished", "processed", report.Processed)
+	if err := reportOpts.write(report); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if err := checkReplay(collector); err != nil {
+		return err
+	}
+	return reportOpts.check(report)
+}
+
+// exitError is an error that makes the collector exit with a specific code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// exitFailureThreshold is the exit code of a run whose failures exceed -max-failures,
+// so that scheduled jobs can tell it apart from a crash
+const exitFailureThreshold = 3
+
+// reportOptions says what to do with the report at the end of a run
+type reportOptions struct {
+	path      string            // where to write the JSON report, empty for none
+	threshold *failureThreshold // nil for no limit
+}
+
+// addReportFlags registers the flags for the end-of-run report
+func addReportFlags(fs *flag.FlagSet) func() (*reportOptions, error) {
+	path := fs.String("report", "", "Write a JSON summary of the run to this file")
+	maxFailures := fs.String("max-failures", "", "Exit with code 3 when more papers than this fail, as a count or a percentage (e.g. 10%)")
+
+	return func() (*reportOptions, error) {
+		threshold, err := parseFailureThreshold(*maxFailures)
+		if err != nil {
+			return nil, err
+		}
+		return &reportOptions{path: *path, threshold: threshold}, nil
+	}
+}
+
+// write prints the report and saves it if -report was given
+func (o *reportOptions) write(report *RunReport) error {
+	printReport(os.Stdout, report)
+	if o.path == "" {
+		return nil
+	}
+	return writeReport(o.path, report)
+}
+
+// check fails with exitFailureThreshold when the report has too many failures
+func (o *reportOptions) check(report *RunReport) error {
+	if !o.threshold.exceeded(report) {
+		return nil
+	}
+	return &exitError{
+		code: exitFailureThreshold,
+		err:  fmt.Errorf("%d of %d papers failed, more than -max-failures %s", report.Failures(), report.Total, o.threshold),
+	}
+}
+
+// addFetcherFlags registers the flags that configure HTTP requests
+func addFetcherFlags(fs *flag.FlagSet) func() (*Collector, error) {
+	userAgent := fs.String("user-agent", defaultUserAgent, "User-Agent sent with every request")
+	proxy := fs.String("proxy", "", "HTTP proxy URL (default from HTTP_PROXY/HTTPS_PROXY)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each request")
+	hostTimeouts := fs.String("host-timeouts", "", "Per-host timeouts, e.g. arxiv.org=20s,scholar.google.com=5s")
+	cacheDir := fs.String("http-cache", defaultHTTPCacheDir, "Directory for cached HTTP responses, empty to disable")
+	cacheTTL := fs.Duration("http-cache-ttl", 24*time.Hour, "How long cached responses are used without revalidating")
+	hostTTLs := fs.String("http-cache-host-ttls", defaultHostTTLs, "Per-host cache TTLs, overriding -http-cache-ttl")
+	rateLimits := fs.String("rate-limits", "", "Minimum interval between requests to a host, e.g. scholar.google.com=5s")
+	sources := fs.String("sources", strings.Join(defaultSources, ","), "Enabled sources, highest priority first")
+	scholarURL := fs.String("scholar-url", defaultScholarURL, "Google Scholar base URL")
+	delay := fs.Duration("delay", defaultDelay, "Pause before fetching each paper")
+	record := fs.String("record", "", "Save every request/response pair to this directory")
+	replay := fs.String("replay", "", "Serve responses only from pairs saved with -record, failing on a miss")
+
+	return func() (*Collector, error) {
+		if *record != "" && *replay != "" {
+			return nil, fmt.Errorf("-record and -replay are mutually exclusive")
+		}
+		enabled, err := parseSources(*sources)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -sources: %v", err)
+		}
+		newCollector := func(f Fetcher) *Collector {
+			collector := NewCollector(f)
+			collector.Sources = enabled
+			collector.ScholarURL = strings.TrimSuffix(*scholarURL, "/")
+			collector.Delay = *delay
+			return collector
+		}
+
+		// Replayed runs are offline and deterministic: no cache and no delay
+		if *replay != "" {
+			fetcher, err := NewReplayFetcher(*replay)
+			if err != nil {
+				return nil, err
+			}
+			collector := newCollector(fetcher)
+			collector.Delay = 0
+			return collector, nil
+		}
+
+		timeouts, err := parseHostDurations(*hostTimeouts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -host-timeouts: %v", err)
+		}
+		var fetcher Fetcher
+		fetcher, err = NewHTTPFetcher(FetcherConfig{
+			UserAgent:    *userAgent,
+			Proxy:        *proxy,
+			Timeout:      *timeout,
+			HostTimeouts: timeouts,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Throttle below the cache, so cache hits aren't delayed
+		if *rateLimits != "" {
+			intervals, err := parseHostDurations(*rateLimits)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -rate-limits: %v", err)
+			}
+			fetcher = NewRateLimitFetcher(fetcher, intervals)
+		}
+
+		if *cacheDir != "" {
+			ttls, err := parseHostDurations(*hostTTLs)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -http-cache-host-ttls: %v", err)
+			}
+			fetcher, err = NewCachingFetcher(fetcher, *cacheDir, *cacheTTL, ttls)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Record outside the cache so cache hits are captured too
+		if *record != "" {
+			fetcher, err = NewRecordingFetcher(fetcher, *record)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return newCollector(fetcher), nil
+	}
+}
+
+// checkReplay fails a replayed run that needed responses which were never recorded
+func checkReplay(collector *Collector) error {
+	if replay, ok := collector.Fetcher.(*ReplayFetcher); ok {
+		if misses := replay.Misses(); len(misses) > 0 {
+			return fmt.Errorf("%w for %d requests, first %s", ErrReplayMiss, len(misses), misses[0])
+		}
+	}
+	return nil
+}
+
+// addFilterFlags registers the flags that select papers from the cache
+func addFilterFlags(fs *flag.FlagSet) func() (PaperFilter, error) {
+	query := fs.String("q", "", "Only papers whose title or abstract contains this text")
+	minCitations := fs.Int("min-citations", 0, "Only papers with at least this many citations")
+	maxCitations := fs.Int("max-citations", 0, "Only papers with at most this many citations")
+	missing := fs.Bool("missing", false, "Only papers without a citation count")
+	pending := fs.Bool("pending", false, "Only papers added through the UI server that haven't been fetched yet")
+	olderThan := fs.Duration("older-than", 0, "Only papers last fetched longer ago than this (e.g. 168h)")
+	collection := fs.String("collection", "", "Only papers listed in this collection, named after its list file (e.g. graph-papers)")
+	sortBy := fs.String("sort", "citations", "Sort order: citations, title, updated or oldest")
+	limit := fs.Int("limit", 0, "Maximum number of papers, 0 for all")
+
+	return func() (PaperFilter, error) {
+		filter := PaperFilter{
+			Query:        *query,
+			MinCitations: *minCitations,
+			MaxCitations: *maxCitations,
+			Missing:      *missing,
+			Pending:      *pending,
+			Collection:   *collection,
+			Sort:         *sortBy,
+			Limit:        *limit,
+		}
+		if *olderThan < 0 {
+			return filter, fmt.Errorf("-older-than must be positive")
+		}
+		if *olderThan > 0 {
+			filter.UpdatedBefore = time.Now().Add(-*olderThan)
+		}
+		return filter, nil
+	}
+}
+
+// runList prints the cached papers matching the given filters
+func runList(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("list")
+	filterFlags := addFilterFlags(fs)
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := filterFlags()
+	if err != nil {
+		return err
+	}
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	papers, err := listPapers(filter)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCITATIONS\tUPDATED\tTITLE")
+	for _, paper := range papers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", paper.ID, formatCitations(paper.Citations), formatDate(paper.UpdatedAt), paper.Title)
+	}
+	tw.Flush()
+	fmt.Printf("\n%d papers\n", len(papers))
+	return nil
+}
+
+// runShow prints everything cached about a single paper
+func runShow(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("show")
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one paper ID or URL")
+	}
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	paper, err := lookupPaper(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if paper == nil {
+		return fmt.Errorf("no paper %q in the cache", fs.Arg(0))
+	}
+
+	fmt.Printf("ID:        %d\n", paper.ID)
+	fmt.Printf("Title:     %s\n", paper.Title)
+	fmt.Printf("URL:       %s\n", paper.URL)
+	if len(paper.Authors) > 0 {
+		fmt.Printf("Authors:   %s\n", strings.Join(paper.Authors, ", "))
+	}
+	if paper.Year > 0 {
+		fmt.Printf("Year:      %d\n", paper.Year)
+	}
+	fmt.Printf("Citations: %s\n", formatCitations(paper.Citations))
+	if paper.CodeURL != "" {
+		fmt.Printf("Code:      %s\n", paper.CodeURL)
+	}
+	if paper.ArxivAbsURL != "" {
+		fmt.Printf("arXiv:     %s\n", paper.ArxivAbsURL)
+	}
+	if paper.GoogleScholarURL != "" {
+		fmt.Printf("Scholar:   %s\n", paper.GoogleScholarURL)
+	}
+	fmt.Printf("Updated:   %s\n", formatDate(paper.UpdatedAt))
+
+	collections, err := getPaperCollections(paper.URL)
+	if err != nil {
+		return err
+	}
+	for _, c := range collections {
+		listed := c.Collection
+		if c.Section != "" {
+			listed += " > " + c.Section
+		}
+		listed += fmt.Sprintf(" (first seen %s, last seen %s", formatDate(c.FirstSeen), formatDate(c.LastSeen))
+		if !c.Removed.IsZero() {
+			listed += ", removed " + formatDate(c.Removed)
+		}
+		fmt.Printf("Listed:    %s)\n", listed)
+	}
+
+	failures, err := getFetchFailures(paper.URL)
+	if err != nil {
+		return err
+	}
+	for _, f := range failures {
+		fmt.Printf("Failed:    %s %s (%d attempts, last %s): %s\n",
+			f.Source, f.Kind, f.Attempts, formatDate(f.LastFailed), f.Error)
+	}
+
+	if paper.ArxivSummary != "" {
+		fmt.Printf("\n%s\n", paper.ArxivSummary)
+	}
+	return nil
+}
+
+// lookupPaper finds a cached paper by row ID or URL
+func lookupPaper(idOrURL string) (*Paper, error) {
+	if id, err := strconv.ParseInt(idOrURL, 10, 64); err == nil {
+		return getPaperByID(id)
+	}
+	return getCachedPaper(canonicalURL(idOrURL))
+}
+
+// runExport writes the cached papers matching the given filters
+func runExport(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("export")
+	filterFlags := addFilterFlags(fs)
+	format := fs.String("format", "csv", "Output format: csv, json or md")
+	output := fs.String("o", "", "Output file (default stdout)")
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := filterFlags()
+	if err != nil {
+		return err
+	}
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	papers, err := listPapers(filter)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return exportPapers(w, papers, *format)
+}
+
+// exportPapers writes papers to w in the given format
+func exportPapers(w io.Writer, papers []Paper, format string) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"title", "url", "citations", "arxiv_abs_url", "google_scholar_url", "updated", "abstract"})
+		for _, paper := range papers {
+			citations := ""
+			if paper.Citations != nil {
+				citations = strconv.Itoa(*paper.Citations)
+			}
+			cw.Write([]string{paper.Title, paper.URL, citations, paper.ArxivAbsURL, paper.GoogleScholarURL, formatDate(paper.UpdatedAt), paper.ArxivSummary})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		type exportedPaper struct {
+			Title            string    `json:"title"`
+			URL              string    `json:"url"`
+			Citations        *int      `json:"citations"`
+			ArxivAbsURL      string    `json:"arxiv_abs_url,omitempty"`
+			GoogleScholarURL string    `json:"google_scholar_url,omitempty"`
+			Abstract         string    `json:"abstract,omitempty"`
+			Updated          time.Time `json:"updated"`
+		}
+		out := make([]exportedPaper, 0, len(papers))
+		for _, paper := range papers {
+			out = append(out, exportedPaper{
+				Title:            paper.Title,
+				URL:              paper.URL,
+				Citations:        paper.Citations,
+				ArxivAbsURL:      paper.ArxivAbsURL,
+				GoogleScholarURL: paper.GoogleScholarURL,
+				Abstract:         paper.ArxivSummary,
+				Updated:          paper.UpdatedAt,
+			})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "md":
+		// Same format parseMarkdownPapers reads, so exports can be fed back to fetch
+		for _, paper := range papers {
+			line := fmt.Sprintf("- %s [[paper](%s)]", paper.Title, paper.URL)
+			if paper.CodeURL != "" {
+				line += fmt.Sprintf(" [[code](%s)]", paper.CodeURL)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// runRefresh refetches the cached papers selected by URL or filters
+func runRefresh(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("refresh")
+	filterFlags := addFilterFlags(fs)
+	all := fs.Bool("all", false, "Refresh every cached paper")
+	fetcherFlags := addFetcherFlags(fs)
+	reportFlags := addReportFlags(fs)
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := filterFlags()
+	if err != nil {
+		return err
+	}
+	collector, err := fetcherFlags()
+	if err != nil {
+		return err
+	}
+	reportOpts, err := reportFlags()
+	if err != nil {
+		return err
+	}
+	for _, url := range fs.Args() {
+		filter.URLs = append(filter.URLs, canonicalURL(url))
+	}
+
+	// Refuse to silently refetch everything when no selection was given
+	if !*all && filter.selectsAll() {
+		fs.Usage()
+		return fmt.Errorf("select papers by URL or filter, or pass -all")
+	}
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	papers, err := listPapers(filter)
+	if err != nil {
+		return err
+	}
+	if len(papers) == 0 {
+		fmt.Println("No papers matched")
+		return nil
+	}
+
+	report, runErr := collector.processPapers(ctx, papers, true)
+	printResults(os.Stdout, papers[:report.Processed])
+
+	if err := reportOpts.write(report); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if err := checkReplay(collector); err != nil {
+		return err
+	}
+	return reportOpts.check(report)
+}
+
+// runStats prints summary statistics about the cache
+func runStats(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("stats")
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	stats, err := getStats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Papers:             %d\n", stats.Papers)
+	fmt.Printf("With citations:     %d\n", stats.WithCitations)
+	fmt.Printf("Missing citations:  %d\n", stats.Papers-stats.WithCitations)
+	fmt.Printf("With abstract:      %d\n", stats.WithAbstract)
+	fmt.Printf("Total citations:    %d\n", stats.TotalCitations)
+	fmt.Printf("Most citations:     %d\n", stats.MaxCitations)
+	fmt.Printf("Oldest update:      %s\n", formatDate(stats.Oldest))
+	fmt.Printf("Newest update:      %s\n", formatDate(stats.Newest))
+
+	kinds := make([]string, 0, len(stats.FailedByKind))
+	for kind := range stats.FailedByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("Failed (%s):%s%d\n", kind, strings.Repeat(" ", max(1, 10-len(kind))), stats.FailedByKind[kind])
+	}
+	return nil
+}
+
+// runPrune removes the cached papers from lists that don't appear in any of
+// the given lists. Papers added through the server are kept.
+func runPrune(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("prune")
+	dryRun := fs.Bool("dry-run", false, "Print the papers that would be removed without removing them")
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no markdown lists specified")
+	}
+
+	listed := make(map[string]bool)
+	for _, file := range fs.Args() {
+		papers, err := parseMarkdownPapers(file)
+		if err != nil {
+			return err
+		}
+		for _, paper := range papers {
+			listed[paper.URL] = true
+		}
+	}
+
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	// Papers added through the server were never in a list, so they are kept
+	cached, err := listPapers(PaperFilter{Collected: true, Sort: "title"})
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, paper := range cached {
+		if !listed[paper.URL] {
+			fmt.Printf("%s\t%s\n", paper.URL, paper.Title)
+			stale = append(stale, paper.URL)
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("\n%d papers would be removed\n", len(stale))
+		return nil
+	}
+
+	deleted, err := deletePapers(stale)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nRemoved %d papers\n", deleted)
+	return nil
+}
+
+// formatCitations formats a citation count for display
+func formatCitations(citations *int) string {
+	if citations == nil {
+		return "N/A"
+	}
+	return strconv.Itoa(*citations)
+}
+
+// formatDate formats a timestamp for display
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// runCache manages the HTTP response cache
+func runCache(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("cache")
+	dir := fs.String("http-cache", defaultHTTPCacheDir, "Directory for cached HTTP responses")
+	host := fs.String("host", "", "Only purge responses from this host, e.g. arxiv.org")
+	olderThan := fs.Duration("older-than", 0, "Only purge responses stored longer ago than this")
+
+	// Accept the action before or after the flags
+	action := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+	if action == "" && fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+	if action != "purge" {
+		fs.Usage()
+		return fmt.Errorf("expected 'purge'")
+	}
+
+	removed, err := purgeHTTPCache(*dir, *host, *olderThan)
+	if err != nil {
+		return fmt.Errorf("failed to purge HTTP cache: %v", err)
+	}
+	fmt.Printf("Removed %d cached responses\n", removed)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportPapers(t *testing.T) {
+	papers := []Paper{
+		{Title: "Paper, with comma", URL: "https://arxiv.org/abs/2301.12345", Citations: intPtr(42)},
+		{Title: "Paper 2", URL: "https://aclanthology.org/2023.acl-long.123", CodeURL: "https://github.com/org/repo"},
+	}
+
+	var buf bytes.Buffer
+	if err := exportPapers(&buf, papers, "csv"); err != nil {
+		t.Fatalf("exportPapers csv failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[1], `"Paper, with comma",https://arxiv.org/abs/2301.12345,42,`) {
+		t.Errorf("Unexpected CSV row %q", lines[1])
+	}
+
+	buf.Reset()
+	if err := exportPapers(&buf, papers, "json"); err != nil {
+		t.Fatalf("exportPapers json failed: %v", err)
+	}
+	var decoded []struct {
+		Title     string `json:"title"`
+		Citations *int   `json:"citations"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON export: %v", err)
+	}
+	if len(decoded) != 2 || *decoded[0].Citations != 42 || decoded[1].Citations != nil {
+		t.Errorf("Unexpected JSON export: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := exportPapers(&buf, papers, "md"); err != nil {
+		t.Fatalf("exportPapers md failed: %v", err)
+	}
+	expected := "- Paper 2 [[paper](https://aclanthology.org/2023.acl-long.123)] [[code](https://github.com/org/repo)]\n"
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("Expected markdown export to end with %q, got %q", expected, buf.String())
+	}
+
+	if err := exportPapers(&buf, papers, "xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"fetch", "list", "show", "export", "refresh", "stats", "prune"} {
+		if findCommand(name) == nil {
+			t.Errorf("Expected command %q", name)
+		}
+	}
+	if findCommand("bogus") != nil {
+		t.Error("Expected nil for unknown command")
+	}
+}
+
+func TestPruneKeepsAddedPapers(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	list := filepath.Join(dir, "papers.md")
+	if err := os.WriteFile(list, []byte("- Kept [[paper](https://example.com/kept)]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := initCache(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"https://example.com/kept", "https://example.com/dropped"} {
+		if err := savePaper(&Paper{Title: url, URL: url}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := syncCollection(list, []Paper{{URL: "https://example.com/kept"}, {URL: "https://example.com/dropped"}}); err != nil {
+		t.Fatal(err)
+	}
+	// What the UI server inserts
+	_, err := cacheDB.Exec(`INSERT INTO paper_cache (url, title, timestamp, pending) VALUES ('https://example.com/added', 'Added', NULL, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeCache()
+
+	if err := runPrune(context.Background(), []string{"-db", dbPath, list}); err != nil {
+		t.Fatalf("runPrune failed: %v", err)
+	}
+
+	if err := initCache(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	defer closeCache()
+	for url, kept := range map[string]bool{
+		"https://example.com/kept":    true,
+		"https://example.com/dropped": false,
+		"https://example.com/added":   true,
+	} {
+		var count int
+		if err := cacheDB.QueryRow("SELECT COUNT(*) FROM paper_cache WHERE url = ?", url).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if (count == 1) != kept {
+			t.Errorf("Expected %s to be kept: %v", url, kept)
+		}
+	}
+}
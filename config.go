@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read when it exists and no other config file is given
+const defaultConfigFile = "most-cited-papers.yaml"
+
+// Config is the YAML configuration of the collector. The UI server reads db
+// and the server section from the same file. Durations are strings like "2s" or "720h". Unset values keep the flag defaults.
+type Config struct {
+	DB           string            `yaml:"db"`
+	Sources      []string          `yaml:"sources"` // enabled sources, highest priority first
+	ScholarURL   string            `yaml:"scholar_url"`
+	Delay        string            `yaml:"delay"` // pause before fetching each paper
+	UserAgent    string            `yaml:"user_agent"`
+	Proxy        string            `yaml:"proxy"`
+	Timeout      string            `yaml:"timeout"`
+	HostTimeouts map[string]string `yaml:"host_timeouts"`
+	RateLimits   map[string]string `yaml:"rate_limits"` // minimum interval between requests to a host
+
+	HTTPCache struct {
+		Dir      *string           `yaml:"dir"` // "" disables the cache
+		TTL      string            `yaml:"ttl"`
+		HostTTLs map[string]string `yaml:"host_ttls"`
+	} `yaml:"http_cache"`
+
+	Daemon struct {
+		Lists         []string `yaml:"lists"`
+		Schedule      string   `yaml:"schedule"`
+		StaleAfter    string   `yaml:"stale_after"`
+		ScholarBudget *int     `yaml:"scholar_budget"`
+	} `yaml:"daemon"`
+
+	Log struct {
+		Level  string `yaml:"level"`
+		Format string `yaml:"format"`
+	} `yaml:"log"`
+
+	Server yaml.Node `yaml:"server"` // read and checked by the UI server
+}
+
+// configEnv maps environment variables to the flags they override
+var configEnv = map[string]string{
+	"MCP_DB":                   "db",
+	"MCP_SOURCES":              "sources",
+	"MCP_SCHOLAR_URL":          "scholar-url",
+	"MCP_DELAY":                "delay",
+	"MCP_USER_AGENT":           "user-agent",
+	"MCP_PROXY":                "proxy",
+	"MCP_TIMEOUT":              "timeout",
+	"MCP_HOST_TIMEOUTS":        "host-timeouts",
+	"MCP_RATE_LIMITS":          "rate-limits",
+	"MCP_HTTP_CACHE":           "http-cache",
+	"MCP_HTTP_CACHE_TTL":       "http-cache-ttl",
+	"MCP_HTTP_CACHE_HOST_TTLS": "http-cache-host-ttls",
+	"MCP_LISTS":                "lists",
+	"MCP_SCHEDULE":             "schedule",
+	"MCP_STALE_AFTER":          "stale-after",
+	"MCP_SCHOLAR_BUDGET":       "scholar-budget",
+	"MCP_LOG_LEVEL":            "log-level",
+	"MCP_LOG_FORMAT":           "log-format",
+}
+
+// loadConfig reads the config file at path. An empty path means $MCP_CONFIG,
+// or most-cited-papers.yaml if it exists; with neither, the config is empty.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		path = os.Getenv("MCP_CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return cfg, nil
+		}
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// flagValues returns the config as flag values, overridden by the MCP_*
+// environment variables
+func (cfg *Config) flagValues() map[string]string {
+	values := map[string]string{
+		"db":                   cfg.DB,
+		"sources":              strings.Join(cfg.Sources, ","),
+		"scholar-url":          cfg.ScholarURL,
+		"delay":                cfg.Delay,
+		"user-agent":           cfg.UserAgent,
+		"proxy":                cfg.Proxy,
+		"timeout":              cfg.Timeout,
+		"host-timeouts":        joinHostValues(cfg.HostTimeouts),
+		"rate-limits":          joinHostValues(cfg.RateLimits),
+		"http-cache-ttl":       cfg.HTTPCache.TTL,
+		"http-cache-host-ttls": joinHostValues(cfg.HTTPCache.HostTTLs),
+		"lists":                strings.Join(cfg.Daemon.Lists, ","),
+		"schedule":             cfg.Daemon.Schedule,
+		"stale-after":          cfg.Daemon.StaleAfter,
+		"log-level":            cfg.Log.Level,
+		"log-format":           cfg.Log.Format,
+	}
+	for name, value := range values {
+		if value == "" {
+			delete(values, name)
+		}
+	}
+	if cfg.HTTPCache.Dir != nil {
+		values["http-cache"] = *cfg.HTTPCache.Dir
+	}
+	if cfg.Daemon.ScholarBudget != nil {
+		values["scholar-budget"] = strconv.Itoa(*cfg.Daemon.ScholarBudget)
+	}
+
+	for env, name := range configEnv {
+		if value, ok := os.LookupEnv(env); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// apply sets every flag of fs that wasn't given on the command line to its
+// value from the config or environment. Flags win over the environment,
+// which wins over the file.
+func (cfg *Config) apply(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	values := cfg.flagValues()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid %s in config: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// joinHostValues formats a host map as "host=value,..." in a stable order
+func joinHostValues(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for host, value := range m {
+		pairs = append(pairs, host+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parseSources parses a comma-separated list of sources, highest priority first
+func parseSources(value string) ([]string, error) {
+	var sources []string
+	seen := make(map[string]bool)
+	for _, source := range strings.Split(value, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source == "" || seen[source] {
+			continue
+		}
+		switch source {
+		case sourceArxiv, sourceACL, sourceScholar:
+		default:
+			return nil, fmt.Errorf("unknown source %q, expected arxiv, acl or scholar", source)
+		}
+		seen[source] = true
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+db: from-file.db
+delay: 5s
+sources: [scholar, arxiv]
+rate_limits:
+  scholar.google.com: 3s
+http_cache:
+  dir: ""
+`)
+	t.Setenv("MCP_DELAY", "7s")
+
+	fs, common := newFlagSet("fetch")
+	addFetcherFlags(fs)
+	if err := common.parse(fs, []string{"-config", path, "-log-level", "warn", "-db", "from-flag.db"}); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	want := map[string]string{
+		"db":          "from-flag.db", // flag beats file
+		"delay":       "7s",           // environment beats file
+		"sources":     "scholar,arxiv",
+		"rate-limits": "scholar.google.com=3s",
+		"http-cache":  "",
+		"timeout":     "10s", // default
+	}
+	for name, value := range want {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("-%s = %q; want %q", name, got, value)
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	path := writeConfig(t, "delay: 1s\ndelays: 2s\n")
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "delays") {
+		t.Errorf("Expected an error about the unknown key, got %v", err)
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	cfg, err := loadConfig("most-cited-papers.example.yaml")
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	fs, _ := newFlagSet("fetch")
+	collectorFlags := addFetcherFlags(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := cfg.apply(fs); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	collector, err := collectorFlags()
+	if err != nil {
+		t.Fatalf("Failed to build collector: %v", err)
+	}
+	if !reflect.DeepEqual(collector.Sources, defaultSources) || collector.Delay != 2*time.Second {
+		t.Errorf("Unexpected collector %+v", collector)
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	sources, err := parseSources("Scholar, arxiv,scholar")
+	if err != nil {
+		t.Fatalf("parseSources failed: %v", err)
+	}
+	if !reflect.DeepEqual(sources, []string{sourceScholar, sourceArxiv}) {
+		t.Errorf("Unexpected sources %v", sources)
+	}
+	if _, err := parseSources("arxiv,semantic-scholar"); err == nil {
+		t.Error("Expected an error for an unknown source")
+	}
+}
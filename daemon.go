@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// daemon refreshes the cache on a schedule
+type daemon struct {
+	collector  *Collector
+	schedule   Schedule
+	lists      []string      // markdown lists re-read before every run
+	staleAfter time.Duration // papers fetched longer ago than this are refreshed
+	budget     int           // papers fetched per day at most, 0 for no limit
+	delay      time.Duration // the collector's delay before the budget spreads it out
+	report     *reportOptions
+	now        func() time.Time
+}
+
+// runDaemon keeps the cache fresh until it is stopped
+func runDaemon(ctx context.Context, args []string) error {
+	fs, common := newFlagSet("daemon")
+	schedule := fs.String("schedule", "@every 6h", "When to run: an interval (6h, @every 30m), @hourly, @daily or a cron expression (\"0 3 * * *\")")
+	lists := fs.String("lists", "", "Comma-separated markdown lists to pick up new papers from, in addition to the arguments")
+	staleAfter := fs.Duration("stale-after", 7*24*time.Hour, "Refresh papers last fetched longer ago than this")
+	budget := fs.Int("scholar-budget", 500, "Papers to fetch from Google Scholar per day at most, spread over the day; 0 for no limit")
+	runAtStart := fs.Bool("run-at-start", true, "Run once immediately instead of waiting for the schedule")
+	fetcherFlags := addFetcherFlags(fs)
+	reportFlags := addReportFlags(fs)
+	if err := common.parse(fs, args); err != nil {
+		return err
+	}
+
+	sched, err := parseSchedule(*schedule)
+	if err != nil {
+		return err
+	}
+	if *budget < 0 {
+		return fmt.Errorf("-scholar-budget must not be negative")
+	}
+	collector, err := fetcherFlags()
+	if err != nil {
+		return err
+	}
+	reportOpts, err := reportFlags()
+	if err != nil {
+		return err
+	}
+
+	d := &daemon{
+		collector:  collector,
+		schedule:   sched,
+		lists:      append(splitList(*lists), fs.Args()...),
+		staleAfter: *staleAfter,
+		budget:     *budget,
+		delay:      collector.Delay,
+		report:     reportOpts,
+		now:        time.Now,
+	}
+
+	// The store stays open for the whole run and is shared with the UI server
+	if err := initCache(common.dbPath); err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	defer closeCache()
+
+	slog.Info("Daemon started", "schedule", *schedule, "lists", len(d.lists), "stale_after", d.staleAfter, "scholar_budget", d.budget)
+	return d.loop(ctx, *runAtStart)
+}
+
+// loop runs the daemon on its schedule until ctx is done, or the schedule
+// has no next run
+func (d *daemon) loop(ctx context.Context, runAtStart bool) error {
+	next := d.now()
+	if !runAtStart {
+		next = d.schedule.Next(next)
+	}
+	for {
+		if next.IsZero() {
+			return errors.New("the schedule has no next run")
+		}
+		if wait := next.Sub(d.now()); wait > 0 {
+			slog.Info("Waiting for next run", "at", next.Format(time.RFC3339))
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				slog.Info("Daemon stopped")
+				return nil
+			}
+		}
+
+		if err := d.run(ctx); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Daemon stopped")
+				return nil
+			}
+			slog.Error("Run failed", "error", err)
+		}
+		next = d.schedule.Next(d.now())
+	}
+}
+
+// run refreshes new and stale papers once, within what is left of today's budget
+func (d *daemon) run(ctx context.Context) error {
+	papers, err := d.selectPapers()
+	if err != nil {
+		return err
+	}
+
+	remaining, err := d.remainingBudget()
+	if err != nil {
+		return err
+	}
+	if remaining == 0 {
+		slog.Warn("Daily Scholar budget used up, skipping run", "budget", d.budget, "due", len(papers))
+		return nil
+	}
+	if remaining > 0 && len(papers) > remaining {
+		slog.Info("Deferring papers over the daily Scholar budget", "due", len(papers), "remaining", remaining)
+		papers = papers[:remaining]
+	}
+	if len(papers) == 0 {
+		slog.Info("Nothing to refresh")
+		return nil
+	}
+
+	// Start every run afresh, a block may have been lifted since the last one
+	d.collector.scholarBlocked = nil
+	d.collector.Delay = d.pace()
+
+	slog.Info("Refreshing papers", "papers", len(papers), "delay", d.collector.Delay)
+	report, err := d.collector.processPapers(ctx, papers, true)
+	slog.Info("Run finished",
+		"fetched", report.Fetched,
+		"failed", report.Failed,
+		"pending", report.Pending,
+		"new", len(report.New),
+		"wall_time", time.Duration(report.WallTime*float64(time.Second)).Round(time.Second))
+	if d.report.path != "" {
+		if err := writeReport(d.report.path, report); err != nil {
+			slog.Error("Failed to write report", "error", err)
+		}
+	}
+	return err
+}
+
+// selectPapers returns the papers due for a fetch: papers from the lists that
+// aren't cached yet, then papers added through the UI server, then stale
+// papers oldest first
+func (d *daemon) selectPapers() ([]Paper, error) {
+	var due []Paper
+	seen := make(map[string]bool)
+
+	for _, file := range d.lists {
+		papers, err := parseMarkdownPapers(file)
+		if err != nil {
+			// A list being edited shouldn't stop refreshes
+			slog.Error("Failed to read list", "file", file, "error", err)
+			continue
+		}
+		added, removed, err := syncCollection(file, papers)
+		if err != nil {
+			return nil, err
+		}
+		if added > 0 || removed > 0 {
+			slog.Info("Synced collection", "collection", collectionName(file), "added", added, "removed", removed)
+		}
+		for _, paper := range papers {
+			if seen[paper.URL] {
+				continue
+			}
+			seen[paper.URL] = true
+
+			cached, err := getCachedPaper(paper.URL)
+			if err != nil {
+				return nil, err
+			}
+			if cached == nil {
+				due = append(due, paper)
+			}
+		}
+	}
+	if len(due) > 0 {
+		slog.Info("Found new papers in lists", "papers", len(due))
+	}
+
+	// Papers added through the UI server haven't been fetched yet either
+	pending, err := listPapers(PaperFilter{Pending: true, Sort: "oldest"})
+	if err != nil {
+		return nil, err
+	}
+	for _, paper := range pending {
+		if !seen[paper.URL] {
+			seen[paper.URL] = true
+			due = append(due, paper)
+		}
+	}
+
+	// Papers dropped from every list aren't worth the Scholar budget
+	stale, err := listPapers(PaperFilter{UpdatedBefore: d.now().Add(-d.staleAfter), Listed: true, Sort: "oldest"})
+	if err != nil {
+		return nil, err
+	}
+	for _, paper := range stale {
+		if !seen[paper.URL] {
+			seen[paper.URL] = true
+			due = append(due, paper)
+		}
+	}
+	return due, nil
+}
+
+// remainingBudget returns how many papers may still be fetched today, or -1
+// without a budget. Papers fetched by other runs today count too.
+func (d *daemon) remainingBudget() (int, error) {
+	if d.budget == 0 {
+		return -1, nil
+	}
+	now := d.now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	fetched, err := countFetchedSince(midnight)
+	if err != nil {
+		return 0, err
+	}
+	return max(d.budget-fetched, 0), nil
+}
+
+// pace returns the delay before each paper that spreads the daily budget
+// over the whole day
+func (d *daemon) pace() time.Duration {
+	if d.budget == 0 {
+		return d.delay
+	}
+	return max(d.delay, 24*time.Hour/time.Duration(d.budget))
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
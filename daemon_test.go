@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDaemonSelectsNewThenStalePapers(t *testing.T) {
+	setupTestCache(t)
+
+	for _, paper := range []Paper{
+		{Title: "Fresh", URL: "https://example.com/fresh"},
+		{Title: "Stale", URL: "https://example.com/stale"},
+		{Title: "Listed", URL: "https://example.com/listed"},
+		{Title: "Dropped", URL: "https://example.com/dropped"},
+	} {
+		if err := savePaper(&paper); err != nil {
+			t.Fatalf("savePaper failed: %v", err)
+		}
+	}
+	_, err := cacheDB.Exec("UPDATE paper_cache SET timestamp = datetime('now', '-30 days') WHERE url IN (?, ?)", "https://example.com/stale", "https://example.com/dropped")
+	if err != nil {
+		t.Fatalf("Failed to age papers: %v", err)
+	}
+	_, err = cacheDB.Exec(`INSERT INTO collection_papers (collection, url, section, first_seen, last_seen, removed)
+		VALUES ('old', 'https://example.com/dropped', '', datetime('now', '-60 days'), datetime('now', '-40 days'), datetime('now', '-40 days'))`)
+	if err != nil {
+		t.Fatalf("Failed to drop paper: %v", err)
+	}
+	_, err = cacheDB.Exec("INSERT INTO paper_cache (url, title, timestamp, pending) VALUES (?, 'Added', NULL, 1)", "https://example.com/added")
+	if err != nil {
+		t.Fatalf("Failed to add pending paper: %v", err)
+	}
+
+	list := filepath.Join(t.TempDir(), "papers.md")
+	content := "- Listed [[paper](https://example.com/listed)]\n- New [[paper](https://example.com/new)]\n"
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+
+	d := &daemon{lists: []string{list, filepath.Join(t.TempDir(), "missing.md")}, staleAfter: 7 * 24 * time.Hour, now: time.Now}
+	papers, err := d.selectPapers()
+	if err != nil {
+		t.Fatalf("selectPapers failed: %v", err)
+	}
+
+	var urls []string
+	for _, paper := range papers {
+		urls = append(urls, paper.URL)
+	}
+	want := []string{"https://example.com/new", "https://example.com/added", "https://example.com/stale"}
+	if strings.Join(urls, " ") != strings.Join(want, " ") {
+		t.Errorf("Unexpected papers %v", urls)
+	}
+}
+
+func TestDaemonBudget(t *testing.T) {
+	setupTestCache(t)
+
+	for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		if err := savePaper(&Paper{Title: "Paper", URL: url}); err != nil {
+			t.Fatalf("savePaper failed: %v", err)
+		}
+	}
+
+	d := &daemon{budget: 3, delay: 2 * time.Second, now: time.Now}
+	remaining, err := d.remainingBudget()
+	if err != nil {
+		t.Fatalf("remainingBudget failed: %v", err)
+	}
+	if remaining != 1 {
+		t.Errorf("Expected 1 paper left in the budget, got %d", remaining)
+	}
+	if pace := d.pace(); pace != 8*time.Hour {
+		t.Errorf("Expected papers 8h apart, got %v", pace)
+	}
+
+	d.budget = 0
+	if remaining, _ := d.remainingBudget(); remaining != -1 {
+		t.Errorf("Expected no limit, got %d", remaining)
+	}
+	if pace := d.pace(); pace != 2*time.Second {
+		t.Errorf("Expected the collector's delay, got %v", pace)
+	}
+}
+
+func TestDaemonRunFetchesDuePapers(t *testing.T) {
+	setupTestCache(t)
+
+	collector := NewCollector(replayFetcher(t))
+	collector.Delay = 0
+	d := &daemon{
+		collector:  collector,
+		lists:      []string{"graph-papers-small.md"},
+		staleAfter: time.Hour,
+		report:     &reportOptions{},
+		now:        time.Now,
+	}
+
+	if err := d.run(context.Background()); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	cached, err := getCachedPaper("https://arxiv.org/abs/2311.09862")
+	if err != nil || cached == nil || cached.Citations == nil || *cached.Citations != 42 {
+		t.Fatalf("Expected the listed paper to be fetched, got %+v, %v", cached, err)
+	}
+
+	// Nothing is due until the paper goes stale
+	papers, err := d.selectPapers()
+	if err != nil || len(papers) != 0 {
+		t.Errorf("Expected nothing due, got %d papers, %v", len(papers), err)
+	}
+}
+
+// neverSchedule is a schedule that has no next run
+type neverSchedule struct{}
+
+func (neverSchedule) Next(time.Time) time.Time { return time.Time{} }
+
+func TestDaemonStopsWithoutNextRun(t *testing.T) {
+	d := &daemon{schedule: neverSchedule{}, now: time.Now}
+	done := make(chan error, 1)
+	go func() { done <- d.loop(context.Background(), false) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error for a schedule without a next run")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the daemon to stop")
+	}
+}
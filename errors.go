@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sources a FetchError can come from
+const (
+	sourceArxiv   = "arxiv"
+	sourceACL     = "acl"
+	sourceScholar = "scholar"
+)
+
+// Kinds of fetch failure. Every FetchError matches exactly one of them with errors.Is.
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrBlocked     = errors.New("blocked")
+	ErrNotFound    = errors.New("not found")
+	ErrParseFailed = errors.New("parse failed")
+	ErrNetwork     = errors.New("network error")
+)
+
+// FetchError is a failure to get something from one source
+type FetchError struct {
+	Source string // arxiv, acl or scholar
+	URL    string // the page that was requested
+	Kind   error  // one of the Err* kinds above
+	Err    error  // the underlying cause, may be nil
+}
+
+func (e *FetchError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Source, e.Kind, e.URL)
+}
+
+// Unwrap lets errors.Is and errors.As see both the kind and the cause
+func (e *FetchError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// newFetchError creates a FetchError whose cause is formatted from format and args
+func newFetchError(source, url string, kind error, format string, args ...any) *FetchError {
+	return &FetchError{Source: source, URL: url, Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// statusKind classifies an unexpected HTTP status
+func statusKind(status int) error {
+	switch status {
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusForbidden:
+		return ErrBlocked
+	case http.StatusNotFound, http.StatusGone:
+		return ErrNotFound
+	default:
+		return ErrNetwork
+	}
+}
+
+// errorKind returns the name of the kind of err, as stored in fetch_failures
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return "rate-limited"
+	case errors.Is(err, ErrBlocked):
+		return "blocked"
+	case errors.Is(err, ErrNotFound):
+		return "not-found"
+	case errors.Is(err, ErrParseFailed):
+		return "parse-failed"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrNetwork):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// fetchErrors flattens err, which may join several failures, into its FetchErrors
+func fetchErrors(err error) []*FetchError {
+	if err == nil {
+		return nil
+	}
+	var fe *FetchError
+	if errors.As(err, &fe) && error(fe) == err {
+		return []*FetchError{fe}
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var all []*FetchError
+		for _, e := range joined.Unwrap() {
+			all = append(all, fetchErrors(e)...)
+		}
+		return all
+	}
+	if errors.As(err, &fe) {
+		return []*FetchError{fe}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{newFetchError(sourceScholar, "u", ErrRateLimited, "Rate limited"), "rate-limited"},
+		{&FetchError{Source: sourceScholar, Kind: ErrBlocked, Err: &ScholarBlockedError{Reason: "captcha"}}, "blocked"},
+		{newFetchError(sourceArxiv, "u", ErrParseFailed, "abstract not found on page"), "parse-failed"},
+		{newFetchError(sourceACL, "u", statusKind(http.StatusNotFound), "status code 404"), "not-found"},
+		{newFetchError(sourceACL, "u", statusKind(http.StatusBadGateway), "status code 502"), "network"},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), "network"},
+		{errors.New("something else"), "other"},
+	}
+
+	for _, tt := range tests {
+		if got := errorKind(tt.err); got != tt.want {
+			t.Errorf("errorKind(%v) = %q; want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFetchErrorsFlattensJoinedErrors(t *testing.T) {
+	arxiv := newFetchError(sourceArxiv, "a", ErrParseFailed, "abstract not found on page")
+	scholar := newFetchError(sourceScholar, "s", ErrNotFound, "no result")
+	err := errors.Join(errors.Join(arxiv, errors.New("not a fetch error")), scholar)
+
+	got := fetchErrors(err)
+	if len(got) != 2 || got[0] != arxiv || got[1] != scholar {
+		t.Errorf("Unexpected failures %v", got)
+	}
+	if fetchErrors(nil) != nil {
+		t.Error("Expected no failures for a nil error")
+	}
+}
+
+func TestSourcesReturnTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("<html><body>No abstract here</body></html>"))
+		}
+	}))
+	defer server.Close()
+
+	_, _, err := GetACLInfo(context.Background(), testFetcher(t), server.URL+"/limited")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+
+	_, err = GetArxivSummary(context.Background(), testFetcher(t), server.URL+"/missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	_, err = GetArxivSummary(context.Background(), testFetcher(t), server.URL+"/abs")
+	if !errors.Is(err, ErrParseFailed) {
+		t.Errorf("Expected ErrParseFailed, got %v", err)
+	}
+
+	_, _, _, err = SearchGoogleScholar(context.Background(), testFetcher(t), "Test Paper", nil, server.URL+"/scholar")
+	var fe *FetchError
+	if !errors.As(err, &fe) || fe.Source != sourceScholar || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a Scholar not-found error, got %v", err)
+	}
+}
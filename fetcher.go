@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultUserAgent mimics a browser, since arXiv and Scholar treat unknown clients with suspicion
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// Fetcher performs the HTTP requests of every source.
+// Implementations may cache, record or replay responses.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// FetcherConfig configures an HTTPFetcher
+type FetcherConfig struct {
+	UserAgent    string                   // sent with every request
+	Proxy        string                   // optional HTTP proxy URL, otherwise HTTP_PROXY and friends apply
+	Timeout      time.Duration            // default timeout for a request, including reading the body
+	HostTimeouts map[string]time.Duration // per-host timeouts overriding Timeout
+}
+
+// HTTPFetcher is a Fetcher that talks to the network through a shared keep-alive transport
+type HTTPFetcher struct {
+	client *http.Client
+	config FetcherConfig
+}
+
+// NewHTTPFetcher creates an HTTPFetcher
+func NewHTTPFetcher(config FetcherConfig) (*HTTPFetcher, error) {
+	if config.UserAgent == "" {
+		config.UserAgent = defaultUserAgent
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 4
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", config.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &HTTPFetcher{
+		client: &http.Client{Transport: transport},
+		config: config,
+	}, nil
+}
+
+// timeout returns the timeout for requests to host
+func (f *HTTPFetcher) timeout(host string) time.Duration {
+	host = strings.ToLower(host)
+	if t, ok := f.config.HostTimeouts[host]; ok {
+		return t
+	}
+	if t, ok := f.config.HostTimeouts[strings.TrimPrefix(host, "www.")]; ok {
+		return t
+	}
+	return f.config.Timeout
+}
+
+// Do sends req with the configured headers and timeout, and logs the host, status and latency
+func (f *HTTPFetcher) Do(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), f.timeout(req.URL.Hostname()))
+	req = req.Clone(ctx)
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", f.config.UserAgent)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+	}
+	if req.Header.Get("Accept-Language") == "" {
+		req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	}
+
+	start := time.Now()
+	resp, err := f.client.Do(req)
+	latency := time.Since(start)
+
+	if err != nil {
+		cancel()
+		slog.Warn("HTTP request failed",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"host", req.URL.Host,
+			"latency", latency,
+			"error", err)
+		return nil, err
+	}
+
+	level := slog.LevelDebug
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		level = slog.LevelWarn
+	}
+	slog.Log(ctx, level, "HTTP request",
+		"method", req.Method,
+		"url", req.URL.String(),
+		"host", req.URL.Host,
+		"status", resp.StatusCode,
+		"latency", latency)
+
+	// The timeout covers reading the body, so release it only once the body is closed
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels a request context when the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// RateLimitFetcher is a Fetcher that spaces out requests to the same host
+type RateLimitFetcher struct {
+	next      Fetcher
+	intervals map[string]time.Duration // minimum time between requests, by host
+
+	mu    sync.Mutex
+	slots map[string]time.Time // earliest time of the next request, by host
+}
+
+// NewRateLimitFetcher creates a RateLimitFetcher with per-host minimum intervals
+func NewRateLimitFetcher(next Fetcher, intervals map[string]time.Duration) *RateLimitFetcher {
+	return &RateLimitFetcher{next: next, intervals: intervals, slots: make(map[string]time.Time)}
+}
+
+// interval returns the minimum time between requests to host
+func (f *RateLimitFetcher) interval(host string) time.Duration {
+	host = strings.ToLower(host)
+	if d, ok := f.intervals[host]; ok {
+		return d
+	}
+	return f.intervals[strings.TrimPrefix(host, "www.")]
+}
+
+// Do waits for the host's slot, then sends req
+func (f *RateLimitFetcher) Do(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	interval := f.interval(host)
+	if interval <= 0 {
+		return f.next.Do(req)
+	}
+
+	// Reserve a slot before waiting, so concurrent requests queue up
+	f.mu.Lock()
+	now := time.Now()
+	slot := f.slots[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	f.slots[host] = slot.Add(interval)
+	f.mu.Unlock()
+
+	if wait := time.Until(slot); wait > 0 {
+		slog.Debug("Rate limiting request", "host", host, "wait", wait)
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return f.next.Do(req)
+}
+
+// parseHostDurations parses "host=duration" pairs separated by commas,
+// e.g. "arxiv.org=20s,scholar.google.com=5s"
+func parseHostDurations(value string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		host, duration, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected host=duration, got %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for %s: %v", host, err)
+		}
+		durations[strings.ToLower(strings.TrimSpace(host))] = d
+	}
+	return durations, nil
+}
+
+// newGetRequest creates a GET request for one of the sources
+func newGetRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	return req, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFetcher returns a fetcher suitable for talking to httptest servers
+func testFetcher(t *testing.T) Fetcher {
+	t.Helper()
+	f, err := NewHTTPFetcher(FetcherConfig{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewHTTPFetcher failed: %v", err)
+	}
+	return f
+}
+
+func TestHTTPFetcherHeaders(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f, err := NewHTTPFetcher(FetcherConfig{UserAgent: "test-agent/1.0"})
+	if err != nil {
+		t.Fatalf("NewHTTPFetcher failed: %v", err)
+	}
+
+	req, _ := newGetRequest(context.Background(), server.URL)
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("Expected body 'ok', got %q", body)
+	}
+	if userAgent != "test-agent/1.0" {
+		t.Errorf("Expected User-Agent 'test-agent/1.0', got %q", userAgent)
+	}
+}
+
+func TestHTTPFetcherHostTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	host := mustParseURL(t, server.URL).Hostname()
+	f, err := NewHTTPFetcher(FetcherConfig{
+		Timeout:      time.Minute,
+		HostTimeouts: map[string]time.Duration{host: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPFetcher failed: %v", err)
+	}
+
+	start := time.Now()
+	req, _ := newGetRequest(context.Background(), server.URL)
+	if _, err := f.Do(req); err == nil {
+		t.Fatal("Expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Per-host timeout not applied, request took %v", elapsed)
+	}
+}
+
+func TestHTTPFetcherProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	f, err := NewHTTPFetcher(FetcherConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPFetcher failed: %v", err)
+	}
+
+	req, _ := newGetRequest(context.Background(), "http://arxiv.example/abs/2301.12345")
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://arxiv.example/abs/2301.12345" {
+		t.Errorf("Expected request through proxy, got %q", proxied)
+	}
+
+	if _, err := NewHTTPFetcher(FetcherConfig{Proxy: "not a url"}); err == nil {
+		t.Error("Expected error for invalid proxy URL")
+	}
+}
+
+func TestHTTPFetcherLogsStatus(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "debug", "json"); err != nil {
+		t.Fatalf("setupLogging failed: %v", err)
+	}
+
+	req, _ := newGetRequest(context.Background(), server.URL)
+	resp, err := testFetcher(t).Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	resp.Body.Close()
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected JSON log line, got %q", buf.String())
+	}
+	if entry["level"] != "WARN" || entry["status"] != float64(http.StatusTooManyRequests) {
+		t.Errorf("Unexpected log entry %v", entry)
+	}
+	if entry["host"] != req.URL.Host {
+		t.Errorf("Expected host %q, got %v", req.URL.Host, entry["host"])
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Error("Expected latency field")
+	}
+}
+
+func TestParseHostDurations(t *testing.T) {
+	durations, err := parseHostDurations("arxiv.org=20s, Scholar.Google.com=5s")
+	if err != nil {
+		t.Fatalf("parseHostDurations failed: %v", err)
+	}
+	if durations["arxiv.org"] != 20*time.Second || durations["scholar.google.com"] != 5*time.Second {
+		t.Errorf("Unexpected durations %v", durations)
+	}
+
+	if _, err := parseHostDurations("arxiv.org"); err == nil {
+		t.Error("Expected error for missing duration")
+	}
+	if _, err := parseHostDurations("arxiv.org=soon"); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
+
+// mustParseURL parses a URL or fails the test
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", rawURL, err)
+	}
+	return u
+}
+
+func TestRateLimitFetcherSpacesRequestsPerHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	// Both servers are on 127.0.0.1, so limit one by its "localhost" name only
+	limited := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	f := NewRateLimitFetcher(testFetcher(t), map[string]time.Duration{"localhost": 50 * time.Millisecond})
+
+	start := time.Now()
+	for _, u := range []string{limited, other.URL, other.URL, limited} {
+		req, _ := http.NewRequest("GET", u, nil)
+		resp, err := f.Do(req)
+		if err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the second request to localhost to wait, took %v", elapsed)
+	}
+
+	// Waiting for a slot gives up when the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", limited, nil)
+	if _, err := f.Do(req); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
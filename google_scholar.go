@@ -1,58 +1,88 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
-var debugMode bool
+// ScholarBlockedError is returned when Google Scholar answers with a CAPTCHA,
+// its "unusual traffic" interstitial or a consent page instead of results.
+// These pages come back with HTTP 200, so they would otherwise look like a
+// search without matches.
+type ScholarBlockedError struct {
+	URL    string
+	Reason string // captcha, unusual-traffic, consent or sorry-page
+}
 
-// SetDebugMode sets whether debug logging is enabled
-func SetDebugMode(enabled bool) {
-	debugMode = enabled
+func (e *ScholarBlockedError) Error() string {
+	return fmt.Sprintf("blocked by Google Scholar (%s) at %s", e.Reason, e.URL)
 }
 
-// debugf prints debug messages only when debug mode is enabled
-func debugf(format string, v ...interface{}) {
-	if debugMode {
-		fmt.Printf(format+"\n", v...)
+// detectScholarBlock checks whether a response is a block or consent page
+// rather than real content, returning nil if it isn't
+func detectScholarBlock(resp *http.Response, doc *goquery.Document) *ScholarBlockedError {
+	finalURL := resp.Request.URL
+	blocked := func(reason string) *ScholarBlockedError {
+		return &ScholarBlockedError{URL: finalURL.String(), Reason: reason}
 	}
-}
 
-// GetGoogleScholarURL extracts the Google Scholar URL from a paper's page
-func GetGoogleScholarURL(url string) (string, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// Redirects to google.com/sorry/... or consent.google.com
+	if strings.HasPrefix(finalURL.Hostname(), "consent.") {
+		return blocked("consent")
+	}
+	if strings.HasPrefix(finalURL.Path, "/sorry/") {
+		return blocked("sorry-page")
 	}
 
+	if doc.Find("#gs_captcha_ccl, #gs_captcha_f, form#captcha-form, #recaptcha").Length() > 0 {
+		return blocked("captcha")
+	}
+
+	text := doc.Text()
+	if strings.Contains(text, "unusual traffic from your computer network") {
+		return blocked("unusual-traffic")
+	}
+	if strings.Contains(text, "Before you continue to Google") {
+		return blocked("consent")
+	}
+
+	return nil
+}
+
+// GetGoogleScholarURL extracts the Google Scholar URL from a paper's page
+func GetGoogleScholarURL(ctx context.Context, f Fetcher, url string) (string, error) {
 	// Make the request
-	resp, err := client.Get(url)
+	req, err := newGetRequest(ctx, url)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch page: %v", err)
+		return "", err
+	}
+	resp, err := f.Do(req)
+	if err != nil {
+		return "", newFetchError(sourceScholar, url, ErrNetwork, "failed to fetch page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check for rate limiting
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return "", fmt.Errorf("Rate limited by %s. Please wait a few minutes before trying again.", url)
+		return "", newFetchError(sourceScholar, url, ErrRateLimited, "Rate limited by %s. Please wait a few minutes before trying again.", url)
 	}
 
 	// Check for other errors
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch page: status code %d", resp.StatusCode)
+		return "", newFetchError(sourceScholar, url, statusKind(resp.StatusCode), "failed to fetch page: status code %d", resp.StatusCode)
 	}
 
 	// Parse the HTML
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse HTML: %v", err)
+		return "", newFetchError(sourceScholar, url, ErrParseFailed, "failed to parse HTML: %w", err)
 	}
 
 	// Try to find the Google Scholar URL in different formats
@@ -75,7 +105,7 @@ func GetGoogleScholarURL(url string) (string, error) {
 	}
 
 	if scholarURL == "" {
-		return "", fmt.Errorf("no Google Scholar URL found on page")
+		return "", newFetchError(sourceScholar, url, ErrNotFound, "no Google Scholar URL found on page")
 	}
 
 	return scholarURL, nil
@@ -83,33 +113,36 @@ func GetGoogleScholarURL(url string) (string, error) {
 
 // FetchCitationsFromScholar gets the citation count from a Google Scholar page
 // Returns nil for citations if not found or error
-func FetchCitationsFromScholar(scholarURL string) (*int, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
+func FetchCitationsFromScholar(ctx context.Context, f Fetcher, scholarURL string) (*int, error) {
 	// Make the request
-	resp, err := client.Get(scholarURL)
+	req, err := newGetRequest(ctx, scholarURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch page: %v", err)
+		return nil, newFetchError(sourceScholar, scholarURL, ErrNetwork, "failed to fetch page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check for rate limiting
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return nil, fmt.Errorf("Rate limited by Google Scholar. Please wait a few minutes before trying again.")
+		return nil, newFetchError(sourceScholar, scholarURL, ErrRateLimited, "Rate limited by Google Scholar. Please wait a few minutes before trying again.")
 	}
 
 	// Check for other errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch page: status code %d", resp.StatusCode)
+		return nil, newFetchError(sourceScholar, scholarURL, statusKind(resp.StatusCode), "failed to fetch page: status code %d", resp.StatusCode)
 	}
 
 	// Parse the HTML
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+		return nil, newFetchError(sourceScholar, scholarURL, ErrParseFailed, "failed to parse HTML: %w", err)
+	}
+
+	if blocked := detectScholarBlock(resp, doc); blocked != nil {
+		return nil, &FetchError{Source: sourceScholar, URL: scholarURL, Kind: ErrBlocked, Err: blocked}
 	}
 
 	// Look for citation count on the page
@@ -142,39 +175,42 @@ func FetchCitationsFromScholar(scholarURL string) (*int, error) {
 
 // SearchGoogleScholar searches Google Scholar directly for a paper title
 // Returns the Google Scholar URL, citation count, and abstract (if available)
-func SearchGoogleScholar(title string, authors []string, baseURL string) (string, *int, string, error) {
+// baseURL is the search endpoint, e.g. https://scholar.google.com/scholar
+func SearchGoogleScholar(ctx context.Context, f Fetcher, title string, authors []string, baseURL string) (string, *int, string, error) {
 	// Create Google Scholar search URL with title in quotes and authors
 	searchQuery := fmt.Sprintf("\"%s\"", title)
 	if len(authors) > 0 {
 		searchQuery = fmt.Sprintf("%s author:\"%s\"", searchQuery, authors[0])
 	}
 	requestURL := fmt.Sprintf("%s?q=%s", baseURL, url.QueryEscape(searchQuery))
-	debugf("GET %s", requestURL)
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
 
 	// Make the request
-	resp, err := client.Get(requestURL)
+	req, err := newGetRequest(ctx, requestURL)
 	if err != nil {
-		return requestURL, nil, "", fmt.Errorf("failed to fetch page: %v", err)
+		return requestURL, nil, "", err
+	}
+	resp, err := f.Do(req)
+	if err != nil {
+		return requestURL, nil, "", newFetchError(sourceScholar, requestURL, ErrNetwork, "failed to fetch page: %w", err)
 	}
 	defer resp.Body.Close()
 
-	debugf("Response: %s", resp.Status)
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return requestURL, nil, "", fmt.Errorf("Rate limited by Google Scholar. Please wait a few minutes before trying again.")
+		return requestURL, nil, "", newFetchError(sourceScholar, requestURL, ErrRateLimited, "Rate limited by Google Scholar. Please wait a few minutes before trying again.")
 	}
 	if resp.StatusCode != http.StatusOK {
-		return requestURL, nil, "", fmt.Errorf("failed to fetch page: status code %d", resp.StatusCode)
+		return requestURL, nil, "", newFetchError(sourceScholar, requestURL, statusKind(resp.StatusCode), "failed to fetch page: status code %d", resp.StatusCode)
 	}
 
 	// Parse the HTML response
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return requestURL, nil, "", fmt.Errorf("failed to parse HTML: %v", err)
+		return requestURL, nil, "", newFetchError(sourceScholar, requestURL, ErrParseFailed, "failed to parse HTML: %w", err)
+	}
+
+	// A block page has no results, so check before reading them as "no match"
+	if blocked := detectScholarBlock(resp, doc); blocked != nil {
+		return requestURL, nil, "", &FetchError{Source: sourceScholar, URL: requestURL, Kind: ErrBlocked, Err: blocked}
 	}
 
 	// Look for citation count and abstract in the search results
@@ -236,14 +272,23 @@ func SearchGoogleScholar(title string, authors []string, baseURL string) (string
 		}
 	})
 
+	if !foundMatch {
+		return requestURL, nil, "", newFetchError(sourceScholar, requestURL, ErrNotFound, "no result matching %q", title)
+	}
+
 	// If we found a good match, use its URL, otherwise use the search URL
 	if bestMatchURL != "" {
 		requestURL = bestMatchURL
 	}
 
 	// If we found a match but no citation count, try to get it from the paper's page
-	if foundMatch && citationPtr == nil && bestMatchURL != "" {
-		citationPtr, _ = FetchCitationsFromScholar(bestMatchURL)
+	if citationPtr == nil && bestMatchURL != "" {
+		var err error
+		citationPtr, err = FetchCitationsFromScholar(ctx, f, bestMatchURL)
+		var blocked *ScholarBlockedError
+		if errors.As(err, &blocked) {
+			return requestURL, nil, abstract, err
+		}
 	}
 
 	return requestURL, citationPtr, abstract, nil
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -26,7 +28,7 @@ func TestGetGoogleScholarURL(t *testing.T) {
 	defer aclServer.Close()
 
 	// Test ACL URL
-	url, err := GetGoogleScholarURL(aclServer.URL)
+	url, err := GetGoogleScholarURL(context.Background(), testFetcher(t), aclServer.URL)
 	if err != nil {
 		t.Fatalf("GetGoogleScholarURL failed for ACL URL: %v", err)
 	}
@@ -51,7 +53,7 @@ func TestGetGoogleScholarURL(t *testing.T) {
 	defer arxivServer.Close()
 
 	// Test arXiv URL
-	url, err = GetGoogleScholarURL(arxivServer.URL)
+	url, err = GetGoogleScholarURL(context.Background(), testFetcher(t), arxivServer.URL)
 	if err != nil {
 		t.Fatalf("GetGoogleScholarURL failed for arXiv URL: %v", err)
 	}
@@ -66,7 +68,7 @@ func TestGetGoogleScholarURL(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	_, err = GetGoogleScholarURL(rateLimitServer.URL)
+	_, err = GetGoogleScholarURL(context.Background(), testFetcher(t), rateLimitServer.URL)
 	if err == nil {
 		t.Error("Expected error for rate limiting, got nil")
 	}
@@ -91,7 +93,7 @@ func TestFetchCitationsFromScholar(t *testing.T) {
 	defer citedServer.Close()
 
 	// Test paper with citations
-	citations, err := FetchCitationsFromScholar(citedServer.URL)
+	citations, err := FetchCitationsFromScholar(context.Background(), testFetcher(t), citedServer.URL)
 	if err != nil {
 		t.Fatalf("FetchCitationsFromScholar failed for cited paper: %v", err)
 	}
@@ -117,7 +119,7 @@ func TestFetchCitationsFromScholar(t *testing.T) {
 	defer uncitedServer.Close()
 
 	// Test paper with no citations
-	citations, err = FetchCitationsFromScholar(uncitedServer.URL)
+	citations, err = FetchCitationsFromScholar(context.Background(), testFetcher(t), uncitedServer.URL)
 	if err != nil {
 		t.Fatalf("FetchCitationsFromScholar failed for uncited paper: %v", err)
 	}
@@ -134,7 +136,7 @@ func TestFetchCitationsFromScholar(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	_, err = FetchCitationsFromScholar(rateLimitServer.URL)
+	_, err = FetchCitationsFromScholar(context.Background(), testFetcher(t), rateLimitServer.URL)
 	if err == nil {
 		t.Error("FetchCitationsFromScholar should fail on rate limit")
 	}
@@ -164,7 +166,7 @@ func TestSearchGoogleScholar(t *testing.T) {
 	defer server.Close()
 
 	// Test successful case
-	url, citations, abstract, err := SearchGoogleScholar("Test Paper Title", []string{"John Doe"}, server.URL)
+	url, citations, abstract, err := SearchGoogleScholar(context.Background(), testFetcher(t), "Test Paper Title", []string{"John Doe"}, server.URL)
 	if err != nil {
 		t.Fatalf("SearchGoogleScholar failed: %v", err)
 	}
@@ -188,8 +190,77 @@ func TestSearchGoogleScholar(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	_, _, _, err = SearchGoogleScholar("Test Paper Title", []string{"John Doe"}, rateLimitServer.URL)
+	_, _, _, err = SearchGoogleScholar(context.Background(), testFetcher(t), "Test Paper Title", []string{"John Doe"}, rateLimitServer.URL)
 	if err == nil {
 		t.Error("Expected error for rate limiting, got nil")
 	}
 }
+
+func TestSearchGoogleScholarDetectsBlockPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		reason string
+	}{
+		{
+			name:   "captcha",
+			body:   `<html><body><form id="gs_captcha_f"><div id="gs_captcha_ccl">Please show you're not a robot</div></form></body></html>`,
+			reason: "captcha",
+		},
+		{
+			name:   "unusual traffic",
+			body:   `<html><body><p>Our systems have detected unusual traffic from your computer network.</p></body></html>`,
+			reason: "unusual-traffic",
+		},
+		{
+			name:   "consent",
+			body:   `<html><body><h1>Before you continue to Google</h1></body></html>`,
+			reason: "consent",
+		},
+		{
+			name:   "sorry redirect",
+			path:   "/sorry/index",
+			body:   `<html><body>Sorry</body></html>`,
+			reason: "sorry-page",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.path != "" && r.URL.Path != tt.path {
+					http.Redirect(w, r, tt.path, http.StatusFound)
+					return
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, citations, _, err := SearchGoogleScholar(context.Background(), testFetcher(t), "Test Paper", nil, server.URL+"/scholar")
+			var blocked *ScholarBlockedError
+			if !errors.As(err, &blocked) {
+				t.Fatalf("Expected a ScholarBlockedError, got %v", err)
+			}
+			if blocked.Reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, blocked.Reason)
+			}
+			if citations != nil {
+				t.Errorf("Expected nil citations, got %d", *citations)
+			}
+		})
+	}
+}
+
+func TestFetchCitationsFromScholarDetectsBlockPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div id="gs_captcha_ccl"></div></body></html>`))
+	}))
+	defer server.Close()
+
+	_, err := FetchCitationsFromScholar(context.Background(), testFetcher(t), server.URL)
+	var blocked *ScholarBlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("Expected a ScholarBlockedError, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultHTTPCacheDir is where response bodies are cached between runs
+const defaultHTTPCacheDir = ".http-cache"
+
+// defaultHostTTLs keeps abstract pages for a month, since they rarely change,
+// and always revalidates Scholar pages, whose citation counts do
+const defaultHostTTLs = "arxiv.org=720h,aclanthology.org=720h,scholar.google.com=0s"
+
+// cachedResponse is a response stored on disk by CachingFetcher
+type cachedResponse struct {
+	URL          string    `json:"url"`
+	Status       int       `json:"status"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	StoredAt     time.Time `json:"stored_at"`
+	Body         []byte    `json:"body"`
+}
+
+// CachingFetcher is a Fetcher that stores successful GET responses on disk.
+// Fresh entries are served without a request; stale ones are revalidated
+// with If-None-Match/If-Modified-Since and reused when the server answers 304.
+type CachingFetcher struct {
+	next     Fetcher
+	dir      string
+	ttl      time.Duration            // how long an entry is fresh
+	hostTTLs map[string]time.Duration // per-host overrides of ttl
+	now      func() time.Time
+}
+
+// NewCachingFetcher creates a CachingFetcher storing entries in dir
+func NewCachingFetcher(next Fetcher, dir string, ttl time.Duration, hostTTLs map[string]time.Duration) (*CachingFetcher, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create HTTP cache directory: %v", err)
+	}
+	return &CachingFetcher{
+		next:     next,
+		dir:      dir,
+		ttl:      ttl,
+		hostTTLs: hostTTLs,
+		now:      time.Now,
+	}, nil
+}
+
+// hostTTL returns how long responses from host stay fresh
+func (f *CachingFetcher) hostTTL(host string) time.Duration {
+	host = strings.ToLower(host)
+	if ttl, ok := f.hostTTLs[host]; ok {
+		return ttl
+	}
+	if ttl, ok := f.hostTTLs[strings.TrimPrefix(host, "www.")]; ok {
+		return ttl
+	}
+	return f.ttl
+}
+
+// cachePath returns the file an entry for rawURL is stored in
+func (f *CachingFetcher) cachePath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Do serves req from the cache when possible
+func (f *CachingFetcher) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return f.next.Do(req)
+	}
+
+	key := req.URL.String()
+	entry, err := readCachedResponse(f.cachePath(key))
+	if err != nil {
+		slog.Warn("Ignoring unreadable HTTP cache entry", "url", key, "error", err)
+		entry = nil
+	}
+
+	if entry != nil && f.now().Sub(entry.StoredAt) < f.hostTTL(req.URL.Hostname()) {
+		slog.Debug("HTTP cache hit", "url", key, "host", req.URL.Host, "age", f.now().Sub(entry.StoredAt))
+		return entry.response(req), nil
+	}
+
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := f.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		slog.Debug("HTTP cache revalidated", "url", key, "host", req.URL.Host)
+		entry.StoredAt = f.now()
+		if err := writeCachedResponse(f.cachePath(key), entry); err != nil {
+			slog.Warn("Failed to update HTTP cache entry", "url", key, "error", err)
+		}
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry = &cachedResponse{
+		URL:          key,
+		Status:       resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StoredAt:     f.now(),
+		Body:         body,
+	}
+	if err := writeCachedResponse(f.cachePath(key), entry); err != nil {
+		slog.Warn("Failed to write HTTP cache entry", "url", key, "error", err)
+	}
+
+	return resp, nil
+}
+
+// response builds an HTTP response from a cache entry
+func (c *cachedResponse) response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if c.ContentType != "" {
+		header.Set("Content-Type", c.ContentType)
+	}
+	if c.ETag != "" {
+		header.Set("ETag", c.ETag)
+	}
+	if c.LastModified != "" {
+		header.Set("Last-Modified", c.LastModified)
+	}
+	header.Set("X-Cache", "HIT")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.Status, http.StatusText(c.Status)),
+		StatusCode:    c.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// readCachedResponse reads a cache entry, returning nil if there is none
+func readCachedResponse(path string) (*cachedResponse, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// writeCachedResponse atomically writes a cache entry
+func writeCachedResponse(path string, entry *cachedResponse) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// purgeHTTPCache removes cache entries from dir. An empty host matches every
+// host; olderThan of zero matches entries of any age. It returns the number
+// of entries removed.
+func purgeHTTPCache(dir, host string, olderThan time.Duration) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	host = strings.ToLower(host)
+	removed := 0
+	for _, file := range files {
+		if host != "" || olderThan > 0 {
+			entry, err := readCachedResponse(file)
+			if err == nil && entry != nil {
+				if host != "" && !matchesHost(entry.URL, host) {
+					continue
+				}
+				if olderThan > 0 && time.Since(entry.StoredAt) < olderThan {
+					continue
+				}
+			}
+		}
+		if err := os.Remove(file); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// matchesHost reports whether rawURL is on host or one of its subdomains
+func matchesHost(rawURL, host string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	h := strings.ToLower(u.Hostname())
+	return h == host || strings.HasSuffix(h, "."+host)
+}
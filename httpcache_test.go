@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fetchBody performs a GET through f and returns the body
+func fetchBody(t *testing.T, f Fetcher, url string) (int, string) {
+	t.Helper()
+	req, _ := newGetRequest(context.Background(), url)
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestCachingFetcher(t *testing.T) {
+	requests := 0
+	conditional := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("abstract page"))
+	}))
+	defer server.Close()
+
+	f, err := NewCachingFetcher(testFetcher(t), t.TempDir(), time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewCachingFetcher failed: %v", err)
+	}
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	// First request goes to the server
+	if status, body := fetchBody(t, f, server.URL+"/abs"); status != 200 || body != "abstract page" {
+		t.Fatalf("Unexpected response %d %q", status, body)
+	}
+
+	// Fresh entry is served from disk
+	if _, body := fetchBody(t, f, server.URL+"/abs"); body != "abstract page" {
+		t.Errorf("Expected cached body, got %q", body)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request while fresh, got %d", requests)
+	}
+
+	// Stale entry is revalidated with a conditional request
+	now = now.Add(2 * time.Hour)
+	if status, body := fetchBody(t, f, server.URL+"/abs"); status != 200 || body != "abstract page" {
+		t.Errorf("Expected cached body after 304, got %d %q", status, body)
+	}
+	if conditional != 1 {
+		t.Errorf("Expected 1 conditional request, got %d", conditional)
+	}
+
+	// Revalidation refreshed the entry
+	fetchBody(t, f, server.URL+"/abs")
+	if requests != 2 {
+		t.Errorf("Expected 2 requests after revalidation, got %d", requests)
+	}
+
+	// Errors are not cached
+	fetchBody(t, f, server.URL+"/missing")
+	if status, _ := fetchBody(t, f, server.URL+"/missing"); status != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", status)
+	}
+	if requests != 4 {
+		t.Errorf("Expected errors to be refetched, got %d requests", requests)
+	}
+}
+
+func TestCachingFetcherHostTTL(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("results"))
+	}))
+	defer server.Close()
+
+	host := mustParseURL(t, server.URL).Hostname()
+	f, err := NewCachingFetcher(testFetcher(t), t.TempDir(), time.Hour, map[string]time.Duration{host: 0})
+	if err != nil {
+		t.Fatalf("NewCachingFetcher failed: %v", err)
+	}
+
+	fetchBody(t, f, server.URL)
+	fetchBody(t, f, server.URL)
+	if requests != 2 {
+		t.Errorf("Expected every request to reach a host with zero TTL, got %d", requests)
+	}
+}
+
+func TestPurgeHTTPCache(t *testing.T) {
+	dir := t.TempDir()
+	for _, url := range []string{"https://arxiv.org/abs/1", "https://arxiv.org/abs/2", "https://aclanthology.org/x"} {
+		entry := &cachedResponse{URL: url, Status: 200, StoredAt: time.Now()}
+		f := &CachingFetcher{dir: dir}
+		if err := writeCachedResponse(f.cachePath(url), entry); err != nil {
+			t.Fatalf("writeCachedResponse failed: %v", err)
+		}
+	}
+
+	removed, err := purgeHTTPCache(dir, "arxiv.org", 0)
+	if err != nil {
+		t.Fatalf("purgeHTTPCache failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 arXiv entries removed, got %d", removed)
+	}
+
+	removed, err = purgeHTTPCache(dir, "", time.Hour)
+	if err != nil {
+		t.Fatalf("purgeHTTPCache failed: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("Expected recent entries to be kept, got %d removed", removed)
+	}
+
+	removed, err = purgeHTTPCache(dir, "", 0)
+	if err != nil {
+		t.Fatalf("purgeHTTPCache failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 remaining entry removed, got %d", removed)
+	}
+}
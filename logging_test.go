@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "info", "json"); err != nil {
+		t.Fatalf("setupLogging failed: %v", err)
+	}
+
+	slog.Debug("hidden")
+	slog.Info("visible", "paper", "https://arxiv.org/abs/2301.12345")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 log line, got %d: %q", len(lines), buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected JSON log line, got %q", lines[0])
+	}
+	if entry["msg"] != "visible" || entry["paper"] != "https://arxiv.org/abs/2301.12345" {
+		t.Errorf("Unexpected log entry %v", entry)
+	}
+
+	if err := setupLogging(&buf, "loud", "text"); err == nil {
+		t.Error("Expected error for invalid level")
+	}
+	if err := setupLogging(&buf, "info", "xml"); err == nil {
+		t.Error("Expected error for invalid format")
+	}
+}
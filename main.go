@@ -2,14 +2,19 @@ package main
 
 import (
 	"bufio"
-	"database/sql"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gomarkdown/markdown/ast"
@@ -24,229 +29,349 @@ type Paper struct {
 	ArxivAbsURL      string
 	GoogleScholarURL string
 	ArxivSummary     string
+	Authors          []string
+	CodeURL          string // link to the code, from the list
+	Section          string // heading the paper is listed under, "" before any
+	Year             int    // year the paper came out, 0 if unknown
+	Published        string // month the paper came out as "2006-01", "" if unknown
 	Citations        *int
 	Processed        bool
+	Pending          bool      // not fetched because Google Scholar blocked the run
+	ID               int64     // row ID in the cache, 0 if not cached
+	UpdatedAt        time.Time // when the paper was last fetched
+
+	abstractSource string // source ArxivSummary came from, empty if loaded from the cache
 }
 
-// CacheDB handles interactions with the SQLite cache
-type CacheDB struct {
-	db *sql.DB
+// defaultScholarURL is the Google Scholar base URL
+const defaultScholarURL = "https://scholar.google.com"
+
+// defaultDelay is the pause before fetching each paper
+const defaultDelay = 2 * time.Second
+
+// defaultSources are the sources a Collector uses, highest priority first
+var defaultSources = []string{sourceArxiv, sourceACL, sourceScholar}
+
+// Collector fetches paper metadata from every source through a single Fetcher
+type Collector struct {
+	Fetcher    Fetcher
+	Sources    []string      // enabled sources; earlier ones win when several have an abstract
+	ScholarURL string        // Google Scholar base URL, overridden in tests
+	Delay      time.Duration // pause before fetching each paper, to avoid being rate-limited
+
+	// scholarBlocked is set once Scholar serves a block page; the rest of
+	// the run leaves uncached papers pending instead of querying it again
+	scholarBlocked *ScholarBlockedError
 }
 
-var cacheDB *sql.DB
+// NewCollector creates a Collector that uses f for all requests
+func NewCollector(f Fetcher) *Collector {
+	return &Collector{
+		Fetcher:    f,
+		Sources:    defaultSources,
+		ScholarURL: defaultScholarURL,
+		Delay:      defaultDelay,
+	}
+}
 
 func main() {
-	// Parse command line flags
-	inputFile := flag.String("input", "", "Input markdown file containing paper titles")
-	force := flag.Bool("force", false, "Force a fresh search, bypassing cache")
-	debug := flag.Bool("debug", false, "Enable debug logging")
-	flag.Parse()
-
-	// Set debug mode for Google Scholar functions
-	SetDebugMode(*debug)
-
-	// Print usage if no input file specified
-	if *inputFile == "" {
-		fmt.Println("Usage: go run *.go -input <input.md> [-force] [-debug]")
-		flag.PrintDefaults()
-		os.Exit(1)
+	// Older scripts invoke the collector with flags only, which means fetch
+	args := os.Args[1:]
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" {
+		args = append([]string{"fetch"}, args...)
+	}
+
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
 
-	debugf("Reading papers from: %s", *inputFile)
-	if *force {
-		debugf("Force flag set - will bypass cache")
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		if args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+			printUsage(os.Stdout)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
 
-	// Initialize cache
-	err := initCache()
+	// Cancel on the first Ctrl-C so the current command can wind down;
+	// a second one kills the process as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := cmd.run(ctx, args[1:])
+	stop()
 	if err != nil {
-		log.Fatalf("Failed to initialize cache: %v", err)
+		if err == flag.ErrHelp {
+			return
+		}
+		if errors.Is(err, context.Canceled) {
+			slog.Warn("Interrupted", "command", cmd.name)
+			os.Exit(130)
+		}
+		var exit *exitError
+		if errors.As(err, &exit) {
+			slog.Error("Command failed", "command", cmd.name, "error", exit.err, "exit_code", exit.code)
+			os.Exit(exit.code)
+		}
+		slog.Error("Command failed", "command", cmd.name, "error", err)
+		os.Exit(1)
 	}
-	defer closeCache()
+}
 
-	papers := parseMarkdownPapers(*inputFile)
-	debugf("Found %d papers to process", len(papers))
+// processPapers fetches abstracts and citation counts for papers, using the
+// cache unless force is set, and saves the results. It stops early when ctx
+// is cancelled; the report says how many papers were handled. Papers that
+// can't be fetched because Scholar blocked the run are marked pending and
+// aren't cached.
+func (c *Collector) processPapers(ctx context.Context, papers []Paper, force bool) (*RunReport, error) {
+	report := newRunReport(len(papers))
+	defer report.finish()
 
-	// Process each paper to get citation count
 	for i := range papers {
-		fmt.Printf("\n[Paper %d/%d] %s\n", i+1, len(papers), papers[i].Title)
-		debugf("Processing: %s", papers[i].URL)
-
-		// Check if we have this paper in cache and force flag is not set
-		var cached *Paper
-		if !*force {
-			cached, err = getCachedPaper(papers[i].URL)
-			if err != nil {
-				log.Printf("Error checking cache for '%s': %v\n", papers[i].URL, err)
-			}
+		if err := ctx.Err(); err != nil {
+			report.stop(i)
+			return report, err
 		}
 
-		if cached != nil && !*force {
+		logger := slog.With("paper", papers[i].URL)
+		logger.Info("Processing paper", "index", i+1, "total", len(papers), "title", papers[i].Title)
+
+		// The cached copy is used unless force is set, and otherwise tells
+		// the report whether the paper is new and how its count changed
+		cached, err := getCachedPaper(papers[i].URL)
+		if err != nil {
+			logger.Error("Error checking cache", "error", err)
+		}
+		if cached != nil && !force {
 			// Use cached data
+			papers[i].ID = cached.ID
 			papers[i].Citations = cached.Citations
 			papers[i].ArxivAbsURL = cached.ArxivAbsURL
 			papers[i].GoogleScholarURL = cached.GoogleScholarURL
 			papers[i].ArxivSummary = cached.ArxivSummary
-		} else {
-			if *force {
-				debugf("Force flag set, performing fresh search")
-			}
-			// Add a delay to avoid being rate-limited
-			time.Sleep(2 * time.Second)
-
-			// Fetch new data
-			if IsArxivURL(papers[i].URL) && !IsArxivPDF(papers[i].URL) {
-				debugf("Processing arXiv paper")
-				err := processArxivPaper(&papers[i])
-				if err != nil {
-					log.Printf("Error processing arXiv paper '%s': %v\n", papers[i].Title, err)
-					debugf("Falling back to direct search")
-					err = processNonArxivPaper(&papers[i])
-					if err != nil {
-						log.Printf("Fallback search also failed for '%s': %v\n", papers[i].Title, err)
-					}
-				}
-			} else {
-				debugf("Using title search for paper")
-				err := processNonArxivPaper(&papers[i])
-				if err != nil {
-					log.Printf("Error searching Google Scholar for '%s': %v\n", papers[i].Title, err)
-				}
-			}
-
-			// Cache the result
-			err = saveCitation(papers[i].URL, *papers[i].Citations, papers[i].ArxivSummary)
-			if err != nil {
-				log.Printf("Error caching data for '%s': %v\n", papers[i].URL, err)
-			}
+			papers[i].UpdatedAt = cached.UpdatedAt
+			logger.Debug("Using cached data")
+			report.CacheHits++
+			continue
 		}
-	}
 
-	// Sort papers by citation count (descending)
-	sort.Slice(papers, func(i, j int) bool {
-		// Handle nil citations (place them at the end)
-		if papers[i].Citations == nil && papers[j].Citations == nil {
-			return false // Keep original order
+		if c.scholarBlocked != nil {
+			papers[i].Pending = true
+			report.Pending++
+			continue
 		}
-		if papers[i].Citations == nil {
-			return false // i goes after j
-		}
-		if papers[j].Citations == nil {
-			return true // i goes before j
+
+		// Add a delay to avoid being rate-limited
+		select {
+		case <-time.After(c.Delay):
+		case <-ctx.Done():
+			report.stop(i)
+			return report, ctx.Err()
 		}
-		return *papers[i].Citations > *papers[j].Citations
-	})
 
-	// Print results
-	fmt.Println("\n[Results] Papers sorted by citation count:")
-	fmt.Println("----------------------------------")
-	for i, paper := range papers {
-		fmt.Printf("%d. Title: %s\n   URL: %s\n   Citations: ",
-			i+1, paper.Title, paper.URL)
+		start := time.Now()
+		err = c.fetchPaper(ctx, logger, &papers[i])
 
-		if paper.Citations != nil {
-			fmt.Printf("%d\n", *paper.Citations)
-		} else {
-			fmt.Printf("N/A\n")
+		// Don't cache whatever was half-fetched when the run was interrupted
+		if ctx.Err() != nil {
+			report.stop(i)
+			return report, ctx.Err()
 		}
 
-		if paper.ArxivAbsURL != "" {
-			fmt.Printf("   arXiv: %s\n", paper.ArxivAbsURL)
+		failures := fetchErrors(err)
+		if papers[i].Citations != nil {
+			// Scholar came through in the end, e.g. by a fallback search
+			failures = slices.DeleteFunc(failures, func(f *FetchError) bool { return f.Source == sourceScholar })
 		}
-
-		if paper.GoogleScholarURL != "" {
-			fmt.Printf("   Scholar: %s\n", paper.GoogleScholarURL)
+		if err := recordFetchFailures(papers[i].URL, failures); err != nil {
+			logger.Error("Error recording failures", "error", err)
 		}
 
-		if paper.ArxivSummary != "" {
-			// Get first sentence of abstract
-			firstSentence := strings.Split(paper.ArxivSummary, ".")[0] + "."
-			fmt.Printf("   Abstract: %s\n", firstSentence)
+		// A block page says nothing about the paper, so don't cache it as a miss
+		if c.scholarBlocked != nil {
+			papers[i].Pending = true
+			report.Pending++
+			continue
 		}
+		logger.Info("Fetched paper", "citations", formatCitations(papers[i].Citations), "failures", len(failures), "latency", time.Since(start))
+		report.addFetched(&papers[i], cached, failures)
 
-		fmt.Println()
+		// Cache the result
+		if err := savePaper(&papers[i]); err != nil {
+			logger.Error("Error caching data", "error", err)
+		}
 	}
 
-	debugf("Processing finished")
+	report.Processed = len(papers)
+	return report, nil
 }
 
-// initCache initializes the SQLite database for caching citations
-func initCache() error {
-	dbPath := "citations.db"
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
-	}
-
-	// Create citations table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS citations (
-			url TEXT PRIMARY KEY,
-			citations INTEGER,
-			abstract TEXT,
-			last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %v", err)
+// fetchPaper looks up the abstract and citation count of a single paper.
+// The returned error joins the FetchErrors of every source that failed.
+func (c *Collector) fetchPaper(ctx context.Context, logger *slog.Logger, paper *Paper) error {
+	var err error
+	if IsArxivURL(paper.URL) && !IsArxivPDF(paper.URL) {
+		logger.Debug("Processing arXiv paper")
+		err = c.processArxivPaper(ctx, paper)
+		if err != nil && paper.Citations == nil && !c.checkBlocked(logger, err) {
+			logger.Warn("Error processing arXiv paper, falling back to direct search", "error", err)
+			fallbackErr := c.processNonArxivPaper(ctx, paper)
+			if fallbackErr != nil && !c.checkBlocked(logger, fallbackErr) {
+				logger.Error("Fallback search also failed", "error", fallbackErr, "kind", errorKind(fallbackErr))
+			}
+			err = errors.Join(err, fallbackErr)
+		}
+	} else {
+		logger.Debug("Using title search for paper")
+		err = c.processNonArxivPaper(ctx, paper)
+		if err != nil && !c.checkBlocked(logger, err) {
+			logger.Error("Error searching Google Scholar", "error", err, "kind", errorKind(err))
+		}
 	}
+	paper.Processed = true
+	return err
+}
 
-	cacheDB = db
-	return nil
+// enabled reports whether source may be queried
+func (c *Collector) enabled(source string) bool {
+	return slices.Contains(c.Sources, source)
 }
 
-// closeCache closes the database connection
-func closeCache() {
-	if cacheDB != nil {
-		cacheDB.Close()
+// setAuthors uses the authors found on a page unless the paper already has some
+func setAuthors(paper *Paper, authors []string) {
+	if len(paper.Authors) == 0 && len(authors) > 0 {
+		paper.Authors = authors
 	}
 }
 
-// getCitation retrieves a citation count from the cache
-func getCitation(url string) (*int, error) {
-	if cacheDB == nil {
-		return nil, nil
+// setArxivTitle uses the title on a paper's arXiv page for papers the server
+// added by their arXiv ID alone, whose title is "arXiv:" and the ID until then
+func setArxivTitle(paper *Paper, title string) {
+	_, id, ok := strings.Cut(paper.URL, "arxiv.org/abs/")
+	if ok && title != "" && paper.Title == "arXiv:"+id {
+		paper.Title = title
 	}
+}
 
-	var citations sql.NullInt64
-	err := cacheDB.QueryRow("SELECT citations FROM citations WHERE url = ?", url).Scan(&citations)
-	if err == sql.ErrNoRows {
-		return nil, nil
+// setAbstract uses abstract from source unless the paper already has one
+// from a source of higher priority
+func (c *Collector) setAbstract(paper *Paper, source, abstract string) {
+	if abstract == "" {
+		return
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to query cache: %v", err)
+	if paper.ArxivSummary != "" {
+		// Scholar only has a snippet, which shouldn't replace a full abstract from an earlier run
+		if paper.abstractSource == "" && source == sourceScholar {
+			return
+		}
+		current := slices.Index(c.Sources, paper.abstractSource)
+		if current >= 0 && current <= slices.Index(c.Sources, source) {
+			return
+		}
 	}
+	paper.ArxivSummary = abstract
+	paper.abstractSource = source
+}
+
+// blockedError is the error returned for papers skipped because Scholar blocked the run
+func (c *Collector) blockedError() error {
+	return &FetchError{Source: sourceScholar, URL: c.scholarBlocked.URL, Kind: ErrBlocked, Err: c.scholarBlocked}
+}
 
-	if !citations.Valid {
-		return nil, nil
+// checkBlocked records err if it is a Scholar block, reporting whether it was
+func (c *Collector) checkBlocked(logger *slog.Logger, err error) bool {
+	var blocked *ScholarBlockedError
+	if !errors.As(err, &blocked) {
+		return false
 	}
+	if c.scholarBlocked == nil {
+		logger.Error("Google Scholar blocked the run, leaving remaining papers pending",
+			"reason", blocked.Reason, "url", blocked.URL)
+		c.scholarBlocked = blocked
+	}
+	return true
+}
+
+// printResults prints papers sorted by citation count
+func printResults(w io.Writer, papers []Paper) {
+	sortPapersByCitations(papers)
+
+	fmt.Fprintln(w, "\n[Results] Papers sorted by citation count:")
+	fmt.Fprintln(w, "----------------------------------")
+	for i, paper := range papers {
+		fmt.Fprintf(w, "%d. Title: %s\n   URL: %s\n   Citations: ",
+			i+1, paper.Title, paper.URL)
 
-	count := int(citations.Int64)
-	return &count, nil
+		if paper.Pending {
+			fmt.Fprintf(w, "pending (Google Scholar blocked)\n")
+		} else if paper.Citations != nil {
+			fmt.Fprintf(w, "%d\n", *paper.Citations)
+		} else {
+			fmt.Fprintf(w, "N/A\n")
+		}
+
+		if paper.ArxivAbsURL != "" {
+			fmt.Fprintf(w, "   arXiv: %s\n", paper.ArxivAbsURL)
+		}
+
+		if paper.GoogleScholarURL != "" {
+			fmt.Fprintf(w, "   Scholar: %s\n", paper.GoogleScholarURL)
+		}
+
+		if paper.ArxivSummary != "" {
+			fmt.Fprintf(w, "   Abstract: %s\n", firstSentence(paper.ArxivSummary))
+		}
+
+		fmt.Fprintln(w)
+	}
 }
 
-// saveCitation saves a citation count and abstract to the cache
-func saveCitation(url string, citations int, abstract string) error {
-	if cacheDB == nil {
-		return nil
+// paperYear returns the year a paper came out, from its arXiv or ACL
+// Anthology ID, or 0 if it has neither
+func paperYear(paper *Paper) int {
+	for _, url := range []string{paper.URL, paper.ArxivAbsURL} {
+		if IsArxivURL(url) {
+			if year := GetArxivYear(url); year > 0 {
+				return year
+			}
+		}
+	}
+	if IsACLURL(paper.URL) {
+		return GetACLYear(paper.URL)
 	}
+	return 0
+}
 
-	_, err := cacheDB.Exec(`
-		INSERT OR REPLACE INTO citations (url, citations, abstract, last_updated)
-		VALUES (?, ?, ?, datetime('now'))
-	`, url, citations, abstract)
-	if err != nil {
-		return fmt.Errorf("failed to save to cache: %v", err)
+// paperMonth returns the month a paper came out as "2006-01", which only
+// arXiv IDs tell, or ""
+func paperMonth(paper *Paper) string {
+	for _, url := range []string{paper.URL, paper.ArxivAbsURL} {
+		if IsArxivURL(url) {
+			if month := GetArxivMonth(url); month != "" {
+				return month
+			}
+		}
 	}
+	return ""
+}
 
-	return nil
+// firstSentence returns the first sentence of an abstract
+func firstSentence(text string) string {
+	return strings.Split(text, ".")[0] + "."
 }
 
 // parseMarkdownPapers extracts paper information from a markdown file
-func parseMarkdownPapers(filePath string) []Paper {
+func parseMarkdownPapers(filePath string) ([]Paper, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Fatalf("Failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
 	defer file.Close()
 
@@ -256,76 +381,104 @@ func parseMarkdownPapers(filePath string) []Paper {
 	// Regular expression to extract paper title and URL
 	// Matches simplified markdown format: "- Title [[paper](url)]"
 	titleRegex := regexp.MustCompile(`-\s+([^\[]+)\[\[paper\]\(([^)]+)\)`)
+	// The code link that may follow: "[[code](url)]"
+	codeRegex := regexp.MustCompile(`\[\[code\]\(([^)]+)\)`)
 
+	var section string
 	for scanner.Scan() {
 		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			section = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
 
 		matches := titleRegex.FindStringSubmatch(line)
 		if len(matches) >= 3 {
 			title := strings.TrimSpace(matches[1])
-			url := strings.TrimSpace(matches[2])
+			url := canonicalURL(matches[2])
 
-			papers = append(papers, Paper{
-				Title: title,
-				URL:   url,
-			})
+			paper := Paper{
+				Title:   title,
+				URL:     url,
+				Section: section,
+			}
+			if code := codeRegex.FindStringSubmatch(line); code != nil {
+				paper.CodeURL = strings.TrimSpace(code[1])
+			}
+			papers = append(papers, paper)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("Error reading file: %v", err)
+		return nil, fmt.Errorf("error reading file: %v", err)
 	}
 
-	return papers
+	return papers, nil
 }
 
 // processArxivPaper fetches citations for an arXiv paper by following the Google Scholar link
-func processArxivPaper(paper *Paper) error {
+func (c *Collector) processArxivPaper(ctx context.Context, paper *Paper) error {
+	var errs []error
+
 	// Store the abstract URL
 	paper.ArxivAbsURL = paper.URL
 
 	// Get arXiv summary if available
-	summary, err := GetArxivSummary(paper.ArxivAbsURL)
-	if err == nil && summary != "" {
-		paper.ArxivSummary = summary
+	if c.enabled(sourceArxiv) {
+		info, err := GetArxivInfo(ctx, c.Fetcher, paper.ArxivAbsURL)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		setArxivTitle(paper, info.Title)
+		c.setAbstract(paper, sourceArxiv, info.Summary)
+		setAuthors(paper, info.Authors)
 	}
 
-	// Delegate to the scholar package
-	scholarURL, err := GetGoogleScholarURL(paper.ArxivAbsURL)
-	if err != nil {
-		// Store URLs but leave citations as nil
-		paper.GoogleScholarURL = scholarURL
-		return nil
+	if !c.enabled(sourceScholar) {
+		return errors.Join(errs...)
+	}
+	if c.scholarBlocked != nil {
+		return errors.Join(append(errs, c.blockedError())...)
+	}
+
+	// Look for a Scholar link on the abstract page
+	var scholarURL string
+	if c.enabled(sourceArxiv) {
+		var err error
+		scholarURL, err = GetGoogleScholarURL(ctx, c.Fetcher, paper.ArxivAbsURL)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+		}
 	}
 
 	if scholarURL == "" {
 		// No Google Scholar link found, try to construct one from the arXiv ID
 		arxivID := GetArxivID(paper.ArxivAbsURL)
-		if arxivID != "" {
-			scholarURL = GetDirectScholarURL(arxivID)
-			paper.GoogleScholarURL = scholarURL
-		} else {
+		if arxivID == "" {
 			// Still couldn't get a scholar URL
-			return fmt.Errorf("couldn't construct Google Scholar URL")
+			return errors.Join(append(errs, newFetchError(sourceScholar, paper.ArxivAbsURL, ErrNotFound, "couldn't construct Google Scholar URL"))...)
 		}
-	} else {
-		// Store the Google Scholar URL
-		paper.GoogleScholarURL = scholarURL
+		scholarURL = GetDirectScholarURL(c.ScholarURL, arxivID)
 	}
+	paper.GoogleScholarURL = scholarURL
 
 	// Now get the citation count
-	citationPtr, err := FetchCitationsFromScholar(paper.GoogleScholarURL)
-	if err != nil || citationPtr == nil {
-		// Unable to fetch citations, leave it as nil
-		return nil
+	citationPtr, err := FetchCitationsFromScholar(ctx, c.Fetcher, paper.GoogleScholarURL)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if citationPtr == nil {
+		return errors.Join(append(errs, newFetchError(sourceScholar, paper.GoogleScholarURL, ErrNotFound, "no citation count on page"))...)
 	}
 
 	paper.Citations = citationPtr
-	return nil
+	return errors.Join(errs...)
 }
 
 // processNonArxivPaper searches Google Scholar directly using the paper title
-func processNonArxivPaper(paper *Paper) error {
+func (c *Collector) processNonArxivPaper(ctx context.Context, paper *Paper) error {
+	var errs []error
+
 	// Try to get abstract from different sources in order of preference
 	if IsArxivURL(paper.URL) {
 		if IsArxivPDF(paper.URL) {
@@ -335,33 +488,47 @@ func processNonArxivPaper(paper *Paper) error {
 		}
 
 		// Try to get the arXiv summary if we have an abs URL
-		if paper.ArxivAbsURL != "" {
-			summary, err := GetArxivSummary(paper.ArxivAbsURL)
-			if err == nil && summary != "" {
-				paper.ArxivSummary = summary
+		if paper.ArxivAbsURL != "" && c.enabled(sourceArxiv) {
+			info, err := GetArxivInfo(ctx, c.Fetcher, paper.ArxivAbsURL)
+			if err != nil {
+				errs = append(errs, err)
 			}
+			setArxivTitle(paper, info.Title)
+			c.setAbstract(paper, sourceArxiv, info.Summary)
+			setAuthors(paper, info.Authors)
 		}
-	} else if IsACLURL(paper.URL) {
+	} else if IsACLURL(paper.URL) && c.enabled(sourceACL) {
 		// Try to get both abstract and authors from ACL Anthology in one request
-		summary, authors, err := GetACLInfo(paper.URL)
-		if err == nil {
-			if summary != "" {
-				paper.ArxivSummary = summary
-			}
-			if len(authors) > 0 {
+		summary, authors, err := GetACLInfo(ctx, c.Fetcher, paper.URL)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			c.setAbstract(paper, sourceACL, summary)
+			setAuthors(paper, authors)
+			if len(authors) > 0 && c.enabled(sourceScholar) {
 				// Use the authors for Google Scholar search
-				scholarURL, citationPtr, scholarAbstract, _ := SearchGoogleScholar(paper.Title, authors, "https://scholar.google.com")
+				scholarURL, citationPtr, scholarAbstract, err := SearchGoogleScholar(ctx, c.Fetcher, paper.Title, authors, c.ScholarURL+"/scholar")
+				if err != nil {
+					errs = append(errs, err)
+				}
+				if errors.Is(err, ErrBlocked) {
+					return errors.Join(errs...)
+				}
 				paper.GoogleScholarURL = scholarURL
 				paper.Citations = citationPtr
-				// If we don't have an abstract from ACL but got one from Google Scholar, use that
-				if paper.ArxivSummary == "" && scholarAbstract != "" {
-					paper.ArxivSummary = scholarAbstract
-				}
-				return nil
+				c.setAbstract(paper, sourceScholar, scholarAbstract)
+				return errors.Join(errs...)
 			}
 		}
 	}
 
+	if !c.enabled(sourceScholar) {
+		return errors.Join(errs...)
+	}
+	if c.scholarBlocked != nil {
+		return errors.Join(append(errs, c.blockedError())...)
+	}
+
 	// If we couldn't get authors from ACL or this isn't an ACL paper, try to extract from title
 	authors := []string{}
 	titleParts := strings.Split(paper.Title, " - ")
@@ -385,28 +552,37 @@ func processNonArxivPaper(paper *Paper) error {
 	}
 
 	// Search Google Scholar by title and authors
-	scholarURL, citationPtr, scholarAbstract, _ := SearchGoogleScholar(paper.Title, authors, "https://scholar.google.com")
+	scholarURL, citationPtr, scholarAbstract, err := SearchGoogleScholar(ctx, c.Fetcher, paper.Title, authors, c.ScholarURL+"/scholar")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if errors.Is(err, ErrBlocked) {
+		return errors.Join(errs...)
+	}
 
 	// Only set Google Scholar URL if it's actually a Google Scholar URL
-	if strings.Contains(scholarURL, "scholar.google.com") {
+	if strings.HasPrefix(scholarURL, c.ScholarURL) {
 		paper.GoogleScholarURL = scholarURL
 	}
 
 	// Store citation count
 	paper.Citations = citationPtr
 
-	// If we don't have an abstract from other sources but got one from Google Scholar, use that
-	if paper.ArxivSummary == "" && scholarAbstract != "" {
-		paper.ArxivSummary = scholarAbstract
-	}
+	// Google Scholar's snippet is used if no source of higher priority had an abstract
+	c.setAbstract(paper, sourceScholar, scholarAbstract)
 
-	// If we still don't have citations, try to get them from the paper's page
-	if paper.Citations == nil && paper.GoogleScholarURL != "" {
-		citationPtr, _ = FetchCitationsFromScholar(paper.GoogleScholarURL)
+	// If the search matched but had no count, try to get it from the paper's page
+	if err == nil && paper.Citations == nil && paper.GoogleScholarURL != "" {
+		citationPtr, err = FetchCitationsFromScholar(ctx, c.Fetcher, paper.GoogleScholarURL)
+		if err != nil {
+			errs = append(errs, err)
+		} else if citationPtr == nil {
+			errs = append(errs, newFetchError(sourceScholar, paper.GoogleScholarURL, ErrNotFound, "no citation count on page"))
+		}
 		paper.Citations = citationPtr
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // processMarkdownFile parses a markdown file and returns a list of papers
@@ -467,38 +643,6 @@ func processMarkdownFile(filename string) ([]Paper, error) {
 	return papers, nil
 }
 
-// getCachedPaper retrieves a paper from the cache
-func getCachedPaper(url string) (*Paper, error) {
-	if cacheDB == nil {
-		return nil, nil
-	}
-
-	var title string
-	var citations sql.NullInt64
-	var abstract sql.NullString
-
-	err := cacheDB.QueryRow("SELECT title, citations, abstract FROM citations WHERE url = ?", url).Scan(&title, &citations, &abstract)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to query cache: %v", err)
-	}
-
-	paper := &Paper{
-		Title:        title,
-		URL:          url,
-		ArxivSummary: abstract.String,
-	}
-
-	if citations.Valid {
-		count := int(citations.Int64)
-		paper.Citations = &count
-	}
-
-	return paper, nil
-}
-
 // sortPapersByCitations sorts papers by citation count in descending order
 func sortPapersByCitations(papers []Paper) {
 	sort.Slice(papers, func(i, j int) bool {
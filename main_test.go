@@ -1,9 +1,12 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -57,10 +60,26 @@ func TestProcessArxivPaper(t *testing.T) {
 	}
 
 	// Test processing the paper
-	err := processArxivPaper(paper)
+	replay := replayFetcher(t)
+	err := NewCollector(replay).processArxivPaper(context.Background(), paper)
 	if err != nil {
 		t.Fatalf("processArxivPaper failed: %v", err)
 	}
+	if misses := replay.Misses(); len(misses) > 0 {
+		t.Errorf("Unrecorded requests: %v", misses)
+	}
+	if paper.ArxivSummary != "A test abstract about graphs. It has two sentences." {
+		t.Errorf("Unexpected summary %q", paper.ArxivSummary)
+	}
+	if paper.Title != "Test Paper" {
+		t.Errorf("Expected the list's title to be kept, got %q", paper.Title)
+	}
+	if paper.Citations == nil || *paper.Citations != 17 {
+		t.Errorf("Expected 17 citations, got %v", paper.Citations)
+	}
+	if paper.GoogleScholarURL != "https://scholar.google.com/scholar?q=arxiv:2301.12345" {
+		t.Errorf("Unexpected Scholar URL %q", paper.GoogleScholarURL)
+	}
 
 	// Check that the paper was processed
 	if paper.Processed {
@@ -68,6 +87,34 @@ func TestProcessArxivPaper(t *testing.T) {
 	}
 }
 
+func TestRefreshReplacesArxivPlaceholderTitle(t *testing.T) {
+	setupTestCache(t)
+
+	// The server stores papers added by their arXiv ID alone this way
+	url := "https://arxiv.org/abs/2301.12345"
+	_, err := cacheDB.Exec(`INSERT INTO paper_cache (url, title, timestamp, pending) VALUES (?, 'arXiv:2301.12345', NULL, 1)`, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	papers, err := listPapers(PaperFilter{URLs: []string{url}})
+	if err != nil || len(papers) != 1 {
+		t.Fatalf("Expected the added paper, got %v %v", papers, err)
+	}
+
+	collector := NewCollector(replayFetcher(t))
+	collector.Delay = 0
+	if _, err := collector.processPapers(context.Background(), papers, true); err != nil {
+		t.Fatalf("processPapers failed: %v", err)
+	}
+	cached, err := getCachedPaper(url)
+	if err != nil || cached == nil {
+		t.Fatalf("Expected the paper to be cached, got %v", err)
+	}
+	if cached.Title != "Learning on Graphs" {
+		t.Errorf("Expected the title from arXiv, got %q", cached.Title)
+	}
+}
+
 func TestProcessNonArxivPaper(t *testing.T) {
 	// Create a test paper
 	paper := &Paper{
@@ -76,10 +123,20 @@ func TestProcessNonArxivPaper(t *testing.T) {
 	}
 
 	// Test processing the paper
-	err := processNonArxivPaper(paper)
+	replay := replayFetcher(t)
+	err := NewCollector(replay).processNonArxivPaper(context.Background(), paper)
 	if err != nil {
 		t.Fatalf("processNonArxivPaper failed: %v", err)
 	}
+	if misses := replay.Misses(); len(misses) > 0 {
+		t.Errorf("Unrecorded requests: %v", misses)
+	}
+	if paper.Citations == nil || *paper.Citations != 3 {
+		t.Errorf("Expected 3 citations, got %v", paper.Citations)
+	}
+	if paper.ArxivSummary != "A test abstract from the ACL Anthology." {
+		t.Errorf("Unexpected summary %q", paper.ArxivSummary)
+	}
 
 	// Check that the paper was processed
 	if paper.Processed {
@@ -87,85 +144,70 @@ func TestProcessNonArxivPaper(t *testing.T) {
 	}
 }
 
-func TestGetCitation(t *testing.T) {
-	// Create a temporary database file
-	tmpfile, err := os.CreateTemp("", "testdb-*.db")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.Remove(tmpfile.Name())
-
-	// Initialize cache with temporary database
-	cacheDB, err = sql.Open("sqlite3", tmpfile.Name())
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer cacheDB.Close()
-
-	// Create the table
-	_, err = cacheDB.Exec(`
-		CREATE TABLE IF NOT EXISTS citations (
-			url TEXT PRIMARY KEY,
-			citations INTEGER,
-			abstract TEXT,
-			last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+func TestGetCachedPaper(t *testing.T) {
+	// Initialize cache
+	err := initCache(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("initCache failed: %v", err)
 	}
+	defer closeCache()
 
-	// Test getting citation for non-existent paper
-	citations, err := getCitation("https://example.com/paper")
+	// Test getting a paper that isn't cached
+	paper, err := getCachedPaper("https://example.com/paper")
 	if err != nil {
-		t.Fatalf("getCitation failed: %v", err)
+		t.Fatalf("getCachedPaper failed: %v", err)
 	}
-	if citations != nil {
-		t.Error("Expected nil citations for non-existent paper")
+	if paper != nil {
+		t.Error("Expected nil for a paper that isn't cached")
 	}
 
-	// Test getting citation for existing paper
-	err = saveCitation("https://example.com/paper", 42, "Test abstract")
+	// Test getting a cached paper
+	citations := 42
+	err = savePaper(&Paper{Title: "Test Paper", URL: "https://example.com/paper", ArxivSummary: "Test abstract", Citations: &citations})
 	if err != nil {
-		t.Fatalf("saveCitation failed: %v", err)
+		t.Fatalf("savePaper failed: %v", err)
 	}
 
-	citations, err = getCitation("https://example.com/paper")
+	paper, err = getCachedPaper("https://example.com/paper")
 	if err != nil {
-		t.Fatalf("getCitation failed: %v", err)
+		t.Fatalf("getCachedPaper failed: %v", err)
 	}
-	if citations == nil {
-		t.Fatal("Expected non-nil citations for existing paper")
+	if paper == nil {
+		t.Fatal("Expected a cached paper")
 	}
-	if *citations != 42 {
-		t.Errorf("Expected 42 citations, got %d", *citations)
+	if paper.Citations == nil || *paper.Citations != 42 {
+		t.Errorf("Expected 42 citations, got %v", paper.Citations)
 	}
 }
 
-func TestSaveCitation(t *testing.T) {
+func TestSavePaper(t *testing.T) {
 	// Initialize cache
-	err := initCache()
+	err := initCache(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
 		t.Fatalf("initCache failed: %v", err)
 	}
 	defer closeCache()
 
-	// Test saving citation
-	err = saveCitation("https://example.com/paper", 42, "Test abstract")
+	// Test saving a paper
+	citations := 42
+	err = savePaper(&Paper{Title: "Test Paper", URL: "https://example.com/paper", ArxivSummary: "Test abstract", Citations: &citations})
 	if err != nil {
-		t.Fatalf("saveCitation failed: %v", err)
+		t.Fatalf("savePaper failed: %v", err)
 	}
 
-	// Verify citation was saved
-	citations, err := getCitation("https://example.com/paper")
+	// Verify the paper was saved
+	paper, err := getCachedPaper("https://example.com/paper")
 	if err != nil {
-		t.Fatalf("getCitation failed: %v", err)
+		t.Fatalf("getCachedPaper failed: %v", err)
+	}
+	if paper == nil {
+		t.Fatal("Expected a cached paper")
 	}
-	if citations == nil {
-		t.Fatal("Expected non-nil citations")
+	if paper.Title != "Test Paper" || paper.ArxivSummary != "Test abstract" || paper.Pending {
+		t.Errorf("Unexpected cached paper %+v", paper)
 	}
-	if *citations != 42 {
-		t.Errorf("Expected 42 citations, got %d", *citations)
+	if paper.Citations == nil || *paper.Citations != 42 {
+		t.Errorf("Expected 42 citations, got %v", paper.Citations)
 	}
 }
 
@@ -194,3 +236,192 @@ func TestSortPapersByCitations(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestProcessPapersStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	papers := []Paper{
+		{Title: "Test Paper", URL: "https://arxiv.org/abs/2301.12345"},
+	}
+	report, err := NewCollector(testFetcher(t)).processPapers(ctx, papers, true)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if report.Processed != 0 {
+		t.Errorf("Expected 0 processed papers, got %d", report.Processed)
+	}
+}
+
+func TestCollectorUsesScholarURL(t *testing.T) {
+	var searched string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searched = r.URL.Path + "?" + r.URL.RawQuery
+		w.Write([]byte(`
+			<html>
+				<body>
+					<div class="gs_ri">
+						<h3 class="gs_rt">Test Paper</h3>
+						<div class="gs_fl"><a href="#">Cited by 7</a></div>
+					</div>
+				</body>
+			</html>
+		`))
+	}))
+	defer server.Close()
+
+	collector := NewCollector(testFetcher(t))
+	collector.ScholarURL = server.URL
+
+	paper := &Paper{Title: "Test Paper", URL: server.URL + "/paper.pdf"}
+	if err := collector.processNonArxivPaper(context.Background(), paper); err != nil {
+		t.Fatalf("processNonArxivPaper failed: %v", err)
+	}
+
+	if !strings.HasPrefix(searched, "/scholar?q=") {
+		t.Errorf("Expected a Scholar search request, got %q", searched)
+	}
+	if paper.Citations == nil || *paper.Citations != 7 {
+		t.Errorf("Expected 7 citations, got %v", paper.Citations)
+	}
+	if !strings.HasPrefix(paper.GoogleScholarURL, server.URL) {
+		t.Errorf("Expected Scholar URL on the test server, got %q", paper.GoogleScholarURL)
+	}
+}
+
+func TestProcessPapersLeavesBlockedPapersPending(t *testing.T) {
+	setupTestCache(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`<html><body><p>Our systems have detected unusual traffic from your computer network.</p></body></html>`))
+	}))
+	defer server.Close()
+
+	collector := NewCollector(testFetcher(t))
+	collector.ScholarURL = server.URL
+	collector.Delay = 0
+
+	papers := []Paper{
+		{Title: "First Paper", URL: server.URL + "/first.pdf"},
+		{Title: "Second Paper", URL: server.URL + "/second.pdf"},
+	}
+	report, err := collector.processPapers(context.Background(), papers, true)
+	if err != nil {
+		t.Fatalf("processPapers failed: %v", err)
+	}
+	if report.Processed != len(papers) {
+		t.Errorf("Expected %d processed papers, got %d", len(papers), report.Processed)
+	}
+	if requests != 1 {
+		t.Errorf("Expected Scholar to be queried once, got %d requests", requests)
+	}
+
+	for _, paper := range papers {
+		if !paper.Pending {
+			t.Errorf("Expected %s to be pending", paper.URL)
+		}
+		cached, err := getCachedPaper(paper.URL)
+		if err != nil {
+			t.Fatalf("getCachedPaper failed: %v", err)
+		}
+		if cached != nil {
+			t.Errorf("Expected %s not to be cached", paper.URL)
+		}
+
+	}
+
+	// Only the paper that hit the block page was attempted
+	failures, err := getFetchFailures(papers[0].URL)
+	if err != nil {
+		t.Fatalf("getFetchFailures failed: %v", err)
+	}
+	if len(failures) != 1 || failures[0].Kind != "blocked" {
+		t.Errorf("Expected a blocked failure, got %+v", failures)
+	}
+}
+
+func TestProcessPapersRecordsFailures(t *testing.T) {
+	setupTestCache(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>No results</body></html>`))
+	}))
+	defer server.Close()
+
+	collector := NewCollector(testFetcher(t))
+	collector.ScholarURL = server.URL
+	collector.Delay = 0
+
+	papers := []Paper{{Title: "Unknown Paper", URL: server.URL + "/unknown.pdf"}}
+	if _, err := collector.processPapers(context.Background(), papers, true); err != nil {
+		t.Fatalf("processPapers failed: %v", err)
+	}
+
+	cached, err := getCachedPaper(papers[0].URL)
+	if err != nil || cached == nil {
+		t.Fatalf("Expected the paper to be cached, got %v, %v", cached, err)
+	}
+	if cached.Citations != nil {
+		t.Errorf("Expected no citations, got %d", *cached.Citations)
+	}
+
+	failures, err := getFetchFailures(papers[0].URL)
+	if err != nil {
+		t.Fatalf("getFetchFailures failed: %v", err)
+	}
+	if len(failures) != 1 || failures[0].Source != sourceScholar || failures[0].Kind != "not-found" {
+		t.Errorf("Expected a Scholar not-found failure, got %+v", failures)
+	}
+}
+
+func TestCollectorSkipsDisabledSources(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write([]byte(`
+			<html><body>
+				<div class="gs_ri">
+					<h3 class="gs_rt">Test Paper</h3>
+					<div class="gs_fma_snp">A snippet from Scholar.</div>
+					<div class="gs_fl"><a href="#">Cited by 7</a></div>
+				</div>
+			</body></html>
+		`))
+	}))
+	defer server.Close()
+
+	collector := NewCollector(testFetcher(t))
+	collector.ScholarURL = server.URL
+
+	// Without Scholar there is nothing to query for a title-only paper
+	collector.Sources = []string{sourceArxiv, sourceACL}
+	paper := &Paper{Title: "Test Paper", URL: server.URL + "/paper.pdf"}
+	if err := collector.processNonArxivPaper(context.Background(), paper); err != nil {
+		t.Fatalf("processNonArxivPaper failed: %v", err)
+	}
+	if len(requested) != 0 || paper.Citations != nil {
+		t.Errorf("Expected no requests, got %v", requested)
+	}
+
+	// Scholar's snippet doesn't replace an abstract from an earlier run
+	collector.Sources = defaultSources
+	paper = &Paper{Title: "Test Paper", URL: server.URL + "/paper.pdf", ArxivSummary: "A cached abstract."}
+	if err := collector.processNonArxivPaper(context.Background(), paper); err != nil {
+		t.Fatalf("processNonArxivPaper failed: %v", err)
+	}
+	if paper.ArxivSummary != "A cached abstract." {
+		t.Errorf("Unexpected abstract %q", paper.ArxivSummary)
+	}
+
+	// but is used when Scholar has priority over the source of the current abstract
+	collector.Sources = []string{sourceScholar, sourceArxiv}
+	paper = &Paper{Title: "Test Paper", URL: server.URL + "/paper.pdf", ArxivSummary: "An arXiv abstract.", abstractSource: sourceArxiv}
+	if err := collector.processNonArxivPaper(context.Background(), paper); err != nil {
+		t.Fatalf("processNonArxivPaper failed: %v", err)
+	}
+	if paper.ArxivSummary != "A snippet from Scholar." {
+		t.Errorf("Unexpected abstract %q", paper.ArxivSummary)
+	}
+}
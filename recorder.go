@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrReplayMiss is returned by ReplayFetcher for requests that were never recorded
+var ErrReplayMiss = errors.New("no recorded response")
+
+// recordedExchange is a request/response pair saved by RecordingFetcher
+type recordedExchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// exchangePath returns the file the exchange for method and rawURL is stored in.
+// The host prefix keeps recordings browsable.
+func exchangePath(dir, method, rawURL string) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL))
+	host := "unknown"
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		host = strings.ReplaceAll(u.Hostname(), ":", "_")
+	}
+	return filepath.Join(dir, host+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// RecordingFetcher is a Fetcher that saves every request/response pair to a directory
+type RecordingFetcher struct {
+	next Fetcher
+	dir  string
+}
+
+// NewRecordingFetcher creates a RecordingFetcher writing to dir
+func NewRecordingFetcher(next Fetcher, dir string) (*RecordingFetcher, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %v", err)
+	}
+	return &RecordingFetcher{next: next, dir: dir}, nil
+}
+
+// Do sends req and records the response
+func (f *RecordingFetcher) Do(req *http.Request) (*http.Response, error) {
+	resp, err := f.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	exchange := recordedExchange{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: make(http.Header),
+		Body:   string(body),
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Last-Modified", "Location"} {
+		if value := resp.Header.Get(name); value != "" {
+			exchange.Header.Set(name, value)
+		}
+	}
+
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := exchangePath(f.dir, req.Method, exchange.URL)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record %s: %v", exchange.URL, err)
+	}
+	slog.Debug("Recorded response", "url", exchange.URL, "file", path)
+
+	return resp, nil
+}
+
+// ReplayFetcher is a Fetcher that serves responses saved by RecordingFetcher
+// and never touches the network
+type ReplayFetcher struct {
+	dir string
+
+	mu     sync.Mutex
+	misses []string
+}
+
+// NewReplayFetcher creates a ReplayFetcher reading from dir
+func NewReplayFetcher(dir string) (*ReplayFetcher, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay directory: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("replay path %s is not a directory", dir)
+	}
+	return &ReplayFetcher{dir: dir}, nil
+}
+
+// Do serves the recorded response for req, or fails with ErrReplayMiss
+func (f *ReplayFetcher) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	rawURL := req.URL.String()
+	data, err := os.ReadFile(exchangePath(f.dir, req.Method, rawURL))
+	if os.IsNotExist(err) {
+		f.mu.Lock()
+		f.misses = append(f.misses, req.Method+" "+rawURL)
+		f.mu.Unlock()
+		slog.Warn("No recorded response", "method", req.Method, "url", rawURL)
+		return nil, fmt.Errorf("%w for %s %s", ErrReplayMiss, req.Method, rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var exchange recordedExchange
+	if err := json.Unmarshal(data, &exchange); err != nil {
+		return nil, fmt.Errorf("invalid recording for %s: %v", rawURL, err)
+	}
+
+	header := exchange.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	slog.Debug("Replayed response", "url", rawURL, "status", exchange.Status)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(exchange.Body)),
+		ContentLength: int64(len(exchange.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Misses returns the requests that had no recording
+func (f *ReplayFetcher) Misses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.misses...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// replayFetcher serves the recordings in testdata/replay
+func replayFetcher(t *testing.T) *ReplayFetcher {
+	t.Helper()
+	f, err := NewReplayFetcher("testdata/replay")
+	if err != nil {
+		t.Fatalf("NewReplayFetcher failed: %v", err)
+	}
+	return f
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/limited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("page " + r.URL.Path))
+	}))
+
+	dir := t.TempDir()
+	recorder, err := NewRecordingFetcher(testFetcher(t), dir)
+	if err != nil {
+		t.Fatalf("NewRecordingFetcher failed: %v", err)
+	}
+	if _, body := fetchBody(t, recorder, server.URL+"/a"); body != "page /a" {
+		t.Fatalf("Unexpected body while recording: %q", body)
+	}
+	fetchBody(t, recorder, server.URL+"/limited")
+
+	// Replay must not need the server
+	server.Close()
+
+	replay, err := NewReplayFetcher(dir)
+	if err != nil {
+		t.Fatalf("NewReplayFetcher failed: %v", err)
+	}
+	status, body := fetchBody(t, replay, server.URL+"/a")
+	if status != http.StatusOK || body != "page /a" {
+		t.Errorf("Unexpected replayed response %d %q", status, body)
+	}
+	if status, _ := fetchBody(t, replay, server.URL+"/limited"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected replayed 429, got %d", status)
+	}
+
+	req, _ := newGetRequest(context.Background(), server.URL+"/b")
+	if _, err := replay.Do(req); !errors.Is(err, ErrReplayMiss) {
+		t.Errorf("Expected ErrReplayMiss, got %v", err)
+	}
+	if misses := replay.Misses(); len(misses) != 1 || misses[0] != "GET "+server.URL+"/b" {
+		t.Errorf("Unexpected misses %v", misses)
+	}
+}
+
+// TestReplaySmallList runs the whole collector over graph-papers-small.md offline
+func TestReplaySmallList(t *testing.T) {
+	setupTestCache(t)
+
+	papers, err := parseMarkdownPapers("graph-papers-small.md")
+	if err != nil {
+		t.Fatalf("parseMarkdownPapers failed: %v", err)
+	}
+
+	replay := replayFetcher(t)
+	collector := NewCollector(replay)
+	collector.Delay = 0
+
+	report, err := collector.processPapers(context.Background(), papers, true)
+	if err != nil {
+		t.Fatalf("processPapers failed: %v", err)
+	}
+	if report.Processed != len(papers) {
+		t.Errorf("Expected %d processed papers, got %d", len(papers), report.Processed)
+	}
+	if misses := replay.Misses(); len(misses) > 0 {
+		t.Fatalf("Unrecorded requests: %v", misses)
+	}
+
+	cached, err := getCachedPaper("https://arxiv.org/abs/2311.09862")
+	if err != nil || cached == nil {
+		t.Fatalf("Expected cached paper, got %v, %v", cached, err)
+	}
+	if cached.Citations == nil || *cached.Citations != 42 {
+		t.Errorf("Expected 42 citations, got %v", cached.Citations)
+	}
+	if cached.ArxivAbsURL != "https://arxiv.org/abs/2311.09862" {
+		t.Errorf("Unexpected arXiv URL %q", cached.ArxivAbsURL)
+	}
+	if cached.Year != 2023 {
+		t.Errorf("Expected the year from the arXiv ID, got %d", cached.Year)
+	}
+	if firstSentence(cached.ArxivSummary) != "Our research integrates graph data with Large Language Models (LLMs), which, despite their advancements in various fields using large text corpora, face limitations in encoding entire graphs due to context size constraints." {
+		t.Errorf("Unexpected abstract %q", cached.ArxivSummary)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReportChanges is how many citation changes a RunReport keeps
+const maxReportChanges = 10
+
+// RunReport summarizes a run of processPapers
+type RunReport struct {
+	Started      time.Time        `json:"started"`
+	WallTime     float64          `json:"wall_time_seconds"`
+	Total        int              `json:"total"`
+	Processed    int              `json:"processed"` // papers handled before the run stopped
+	CacheHits    int              `json:"cache_hits"`
+	Fetched      int              `json:"fetched"`
+	Failed       int              `json:"failed"`  // fetched papers that ended without a citation count
+	Pending      int              `json:"pending"` // papers left unfetched by a Scholar block
+	FailedByKind map[string]int   `json:"failed_by_kind"`
+	Interrupted  bool             `json:"interrupted"`
+	New          []ReportPaper    `json:"new_papers"`
+	Changes      []CitationChange `json:"citation_changes"` // biggest changes first
+}
+
+// ReportPaper is a paper mentioned in a RunReport
+type ReportPaper struct {
+	URL       string `json:"url"`
+	Title     string `json:"title"`
+	Citations *int   `json:"citations"`
+}
+
+// CitationChange is a change in a paper's citation count since it was last fetched
+type CitationChange struct {
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+	Delta  int    `json:"delta"`
+}
+
+// newRunReport starts a report for a run over total papers
+func newRunReport(total int) *RunReport {
+	return &RunReport{
+		Started:      time.Now(),
+		Total:        total,
+		FailedByKind: make(map[string]int),
+		New:          []ReportPaper{},
+		Changes:      []CitationChange{},
+	}
+}
+
+// addFetched accounts for a paper fetched from the network. before is the
+// cached copy from an earlier run, nil if the paper is new.
+func (r *RunReport) addFetched(paper *Paper, before *Paper, failures []*FetchError) {
+	r.Fetched++
+
+	if before == nil {
+		r.New = append(r.New, ReportPaper{URL: paper.URL, Title: paper.Title, Citations: paper.Citations})
+	}
+
+	// A missing count without a failure means Scholar is disabled
+	if paper.Citations == nil && len(failures) > 0 {
+		r.Failed++
+		r.FailedByKind[primaryFailureKind(failures)]++
+		return
+	}
+
+	if paper.Citations != nil && before != nil && before.Citations != nil && *before.Citations != *paper.Citations {
+		r.Changes = append(r.Changes, CitationChange{
+			URL:    paper.URL,
+			Title:  paper.Title,
+			Before: *before.Citations,
+			After:  *paper.Citations,
+			Delta:  *paper.Citations - *before.Citations,
+		})
+	}
+}
+
+// primaryFailureKind returns the kind of failure that explains a missing count,
+// preferring Scholar's since that's where counts come from. failures must not be empty.
+func primaryFailureKind(failures []*FetchError) string {
+	for _, f := range failures {
+		if f.Source == sourceScholar {
+			return errorKind(f)
+		}
+	}
+	return errorKind(failures[0])
+}
+
+// stop marks the run as interrupted after processed papers
+func (r *RunReport) stop(processed int) {
+	r.Processed = processed
+	r.Interrupted = true
+	slog.Warn("Stopping early", "processed", processed, "total", r.Total)
+}
+
+// finish records the wall time and keeps only the biggest citation changes
+func (r *RunReport) finish() {
+	r.WallTime = time.Since(r.Started).Seconds()
+
+	sort.SliceStable(r.Changes, func(i, j int) bool {
+		return abs(r.Changes[i].Delta) > abs(r.Changes[j].Delta)
+	})
+	if len(r.Changes) > maxReportChanges {
+		r.Changes = r.Changes[:maxReportChanges]
+	}
+
+	if r.Pending > 0 {
+		slog.Error("Papers left pending after Google Scholar block; retry later or through another proxy",
+			"pending", r.Pending, "total", r.Total)
+	}
+}
+
+// Failures is the number of papers that didn't get a citation count because
+// of an error, including those left pending
+func (r *RunReport) Failures() int {
+	return r.Failed + r.Pending
+}
+
+// printReport prints a human-readable summary of a run
+func printReport(w io.Writer, r *RunReport) {
+	fmt.Fprintln(w, "[Summary]")
+	fmt.Fprintln(w, "----------------------------------")
+	fmt.Fprintf(w, "Papers:        %d\n", r.Total)
+	fmt.Fprintf(w, "Cache hits:    %d\n", r.CacheHits)
+	fmt.Fprintf(w, "Fetched:       %d\n", r.Fetched)
+	fmt.Fprintf(w, "New papers:    %d\n", len(r.New))
+	fmt.Fprintf(w, "Failed:        %d", r.Failed)
+	if len(r.FailedByKind) > 0 {
+		kinds := make([]string, 0, len(r.FailedByKind))
+		for kind, count := range r.FailedByKind {
+			kinds = append(kinds, fmt.Sprintf("%s %d", kind, count))
+		}
+		sort.Strings(kinds)
+		fmt.Fprintf(w, " (%s)", strings.Join(kinds, ", "))
+	}
+	fmt.Fprintln(w)
+	if r.Pending > 0 {
+		fmt.Fprintf(w, "Pending:       %d\n", r.Pending)
+	}
+	if r.Interrupted {
+		fmt.Fprintf(w, "Interrupted:   after %d of %d papers\n", r.Processed, r.Total)
+	}
+	fmt.Fprintf(w, "Wall time:     %s\n", (time.Duration(r.WallTime * float64(time.Second))).Round(time.Millisecond))
+
+	if len(r.Changes) > 0 {
+		fmt.Fprintln(w, "\nBiggest citation changes:")
+		for _, change := range r.Changes {
+			fmt.Fprintf(w, "  %+6d  %s (%d -> %d)\n", change.Delta, change.Title, change.Before, change.After)
+		}
+	}
+}
+
+// writeReport writes r as JSON to path
+func writeReport(path string, r *RunReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
+
+// failureThreshold is the -max-failures limit, either a count or a
+// percentage of the papers in the run
+type failureThreshold struct {
+	value   float64
+	percent bool
+}
+
+// parseFailureThreshold parses "N" or "N%"
+func parseFailureThreshold(s string) (*failureThreshold, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t := &failureThreshold{}
+	number, percent := strings.CutSuffix(s, "%")
+	t.percent = percent
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid failure threshold %q, expected a count or a percentage", s)
+	}
+	t.value = v
+	return t, nil
+}
+
+// exceeded reports whether the failures in r are over the threshold
+func (t *failureThreshold) exceeded(r *RunReport) bool {
+	if t == nil {
+		return false
+	}
+	limit := t.value
+	if t.percent {
+		limit = t.value / 100 * float64(r.Total)
+	}
+	return float64(r.Failures()) > limit
+}
+
+func (t *failureThreshold) String() string {
+	if t.percent {
+		return strconv.FormatFloat(t.value, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(t.value, 'f', -1, 64)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReportCountsPapers(t *testing.T) {
+	report := newRunReport(4)
+
+	report.CacheHits++
+	report.addFetched(&Paper{URL: "new", Title: "New Paper", Citations: intPtr(5)}, nil, nil)
+	report.addFetched(&Paper{URL: "up", Title: "Rising Paper", Citations: intPtr(30)}, &Paper{Citations: intPtr(10)}, nil)
+	report.addFetched(&Paper{URL: "fail", Title: "Missing Paper"}, &Paper{Citations: intPtr(3)}, []*FetchError{
+		newFetchError(sourceArxiv, "a", ErrParseFailed, "abstract not found on page"),
+		newFetchError(sourceScholar, "s", ErrRateLimited, "Rate limited"),
+	})
+	report.Processed = 4
+	report.finish()
+
+	if report.Fetched != 3 || report.Failed != 1 || report.CacheHits != 1 {
+		t.Errorf("Unexpected counts %+v", report)
+	}
+	if report.FailedByKind["rate-limited"] != 1 {
+		t.Errorf("Expected the Scholar failure to explain the missing count, got %v", report.FailedByKind)
+	}
+	if len(report.New) != 1 || report.New[0].URL != "new" {
+		t.Errorf("Unexpected new papers %+v", report.New)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].Delta != 20 {
+		t.Errorf("Unexpected changes %+v", report.Changes)
+	}
+
+	var out bytes.Buffer
+	printReport(&out, report)
+	for _, want := range []string{"Fetched:       3", "Failed:        1 (rate-limited 1)", "+20  Rising Paper (10 -> 30)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in report:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunReportKeepsBiggestChanges(t *testing.T) {
+	report := newRunReport(maxReportChanges + 2)
+	for i := 0; i < maxReportChanges+2; i++ {
+		report.addFetched(&Paper{URL: "p", Citations: intPtr(100)}, &Paper{Citations: intPtr(100 - i - 1)}, nil)
+	}
+	report.addFetched(&Paper{URL: "down", Citations: intPtr(0)}, &Paper{Citations: intPtr(50)}, nil)
+	report.finish()
+
+	if len(report.Changes) != maxReportChanges {
+		t.Fatalf("Expected %d changes, got %d", maxReportChanges, len(report.Changes))
+	}
+	if report.Changes[0].Delta != -50 {
+		t.Errorf("Expected the biggest drop first, got %+v", report.Changes[0])
+	}
+}
+
+func TestFailureThreshold(t *testing.T) {
+	report := &RunReport{Total: 20, Failed: 2, Pending: 1}
+
+	tests := []struct {
+		value    string
+		exceeded bool
+	}{
+		{"", false},
+		{"3", false},
+		{"2", true},
+		{"15%", false},
+		{"10%", true},
+	}
+	for _, tt := range tests {
+		threshold, err := parseFailureThreshold(tt.value)
+		if err != nil {
+			t.Fatalf("parseFailureThreshold(%q) failed: %v", tt.value, err)
+		}
+		if got := threshold.exceeded(report); got != tt.exceeded {
+			t.Errorf("threshold %q exceeded = %v; want %v", tt.value, got, tt.exceeded)
+		}
+	}
+
+	for _, invalid := range []string{"many", "-1", "%"} {
+		if _, err := parseFailureThreshold(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestProcessPapersReport(t *testing.T) {
+	setupTestCache(t)
+
+	papers, err := parseMarkdownPapers("graph-papers-small.md")
+	if err != nil {
+		t.Fatalf("parseMarkdownPapers failed: %v", err)
+	}
+	url := papers[0].URL
+
+	// An earlier run found fewer citations
+	if err := savePaper(&Paper{Title: papers[0].Title, URL: url, Citations: intPtr(40)}); err != nil {
+		t.Fatalf("savePaper failed: %v", err)
+	}
+
+	collector := NewCollector(replayFetcher(t))
+	collector.Delay = 0
+
+	report, err := collector.processPapers(context.Background(), papers, true)
+	if err != nil {
+		t.Fatalf("processPapers failed: %v", err)
+	}
+	if report.Fetched != 1 || len(report.New) != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].Before != 40 || report.Changes[0].After != 42 {
+		t.Errorf("Unexpected changes %+v", report.Changes)
+	}
+
+	report, err = collector.processPapers(context.Background(), papers, false)
+	if err != nil {
+		t.Fatalf("processPapers failed: %v", err)
+	}
+	if report.CacheHits != 1 || report.Fetched != 0 {
+		t.Errorf("Expected a cache hit, got %+v", report)
+	}
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := writeReport(path, report); err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Invalid JSON report: %v", err)
+	}
+	if decoded["cache_hits"] != float64(1) {
+		t.Errorf("Expected cache_hits 1 in %s", data)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2025, 3, 14, 10, 17, 30, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"6h", start.Add(6 * time.Hour)},
+		{"@every 30m", start.Add(30 * time.Minute)},
+		{"@hourly", time.Date(2025, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, 3, 15, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2025, 3, 17, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", time.Date(2025, 3, 16, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("parseSchedule(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(start); !got.Equal(tt.want) {
+			t.Errorf("parseSchedule(%q).Next = %v; want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "10s", "* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "soon", "0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		if _, err := parseSchedule(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
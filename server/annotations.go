@@ -0,0 +1,319 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// userCookie keeps the name the UI annotates as
+const userCookie = "user"
+
+// Limits of annotations
+const (
+	maxUserLength = 64
+	maxNoteLength = 10000
+)
+
+// Annotation is what a user marked a paper as
+type Annotation struct {
+	User    string `json:"user"`
+	URL     string `json:"url"`
+	Read    bool   `json:"read"`
+	Starred bool   `json:"starred"`
+	Note    string `json:"note"`
+	Updated string `json:"updated,omitempty"`
+}
+
+// annotationChange sets the fields of an annotation that aren't nil
+type annotationChange struct {
+	Read    *bool
+	Starred *bool
+	Note    *string
+}
+
+// annotationConditions select papers by the requesting user's annotations,
+// the user being their argument
+var annotationConditions = map[string]string{
+	"read":    `EXISTS (SELECT 1 FROM annotations a WHERE a.url = paper_cache.url AND a.user = ? AND a.read)`,
+	"unread":  `NOT EXISTS (SELECT 1 FROM annotations a WHERE a.url = paper_cache.url AND a.user = ? AND a.read)`,
+	"starred": `EXISTS (SELECT 1 FROM annotations a WHERE a.url = paper_cache.url AND a.user = ? AND a.starred)`,
+	"noted":   `EXISTS (SELECT 1 FROM annotations a WHERE a.url = paper_cache.url AND a.user = ? AND a.note != '')`,
+}
+
+// mineFilters are the keys of annotationConditions, in the order the index
+// offers them
+var mineFilters = []string{"unread", "read", "starred", "noted"}
+
+// starsColumn is the number of users who starred a paper
+const starsColumn = `(SELECT COUNT(*) FROM annotations a WHERE a.url = paper_cache.url AND a.starred)`
+
+// requestUser returns who a request annotates as: with auth, the user it
+// authenticated as; without, the X-User header of API clients, else the name
+// the UI keeps in its cookie. "" for none.
+func (s *UIServer) requestUser(r *http.Request) string {
+	if s.auth.enabled() {
+		return requestPrincipal(r).Name
+	}
+	name := r.Header.Get("X-User")
+	if name == "" {
+		if cookie, err := r.Cookie(userCookie); err == nil {
+			name = cookie.Value
+		}
+	}
+	user, err := normalizeUser(name)
+	if err != nil {
+		return ""
+	}
+	return user
+}
+
+// normalizeUser trims a user name, which must be printable and short
+func normalizeUser(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) > maxUserLength || strings.ContainsFunc(name, func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return "", fmt.Errorf("invalid user name %q, expected up to %d printable characters", name, maxUserLength)
+	}
+	return name, nil
+}
+
+// canAnnotate reports whether the user of a request may annotate papers,
+// which every reader with a name may do in a database that isn't read-only
+func (s *UIServer) canAnnotate(r *http.Request) bool {
+	return !s.readOnly && s.requestUser(r) != ""
+}
+
+// handleSetUser sets the name the UI annotates as, or forgets it when empty,
+// and goes back to the page the form was on
+func (s *UIServer) handleSetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := normalizeUser(r.FormValue("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     userCookie,
+		Value:    user,
+		Path:     s.url("/"),
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if user == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+	s.redirectBack(w, r)
+}
+
+// handleAnnotate handles the annotation forms of the index and detail pages
+func (s *UIServer) handleAnnotate(w http.ResponseWriter, r *http.Request) {
+	if _, status, err := s.annotate(r); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	s.redirectBack(w, r)
+}
+
+// handleAnnotateAPI sets the requesting user's annotation of a paper from
+// the read, starred and note parameters given, and responds with it
+func (s *UIServer) handleAnnotateAPI(w http.ResponseWriter, r *http.Request) {
+	annotation, status, err := s.annotate(r)
+	if err != nil {
+		writeAPIError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotation)
+}
+
+// handleAnnotationsAPI responds with every user's annotation of a paper
+func (s *UIServer) handleAnnotationsAPI(w http.ResponseWriter, r *http.Request) {
+	paper, status, err := s.pathPaper(r)
+	if err != nil {
+		writeAPIError(w, status, err.Error())
+		return
+	}
+	annotations, err := s.getAnnotations(paper.URL)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to fetch annotations: "+err.Error())
+		return
+	}
+	if annotations == nil {
+		annotations = []Annotation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Annotations []Annotation `json:"annotations"`
+	}{annotations})
+}
+
+// annotate saves the change r makes to its user's annotation of the paper in
+// its path, returning the HTTP status to respond with on error
+func (s *UIServer) annotate(r *http.Request) (Annotation, int, error) {
+	user := s.requestUser(r)
+	if user == "" {
+		return Annotation{}, http.StatusBadRequest, errors.New("set your name, or the X-User header, to annotate papers")
+	}
+	paper, status, err := s.pathPaper(r)
+	if err != nil {
+		return Annotation{}, status, err
+	}
+	change, err := parseAnnotationChange(r)
+	if err != nil {
+		return Annotation{}, http.StatusBadRequest, err
+	}
+	annotation, err := s.setAnnotation(user, paper.URL, change)
+	if err != nil {
+		return Annotation{}, http.StatusInternalServerError, fmt.Errorf("failed to save annotation: %v", err)
+	}
+	return annotation, http.StatusOK, nil
+}
+
+// pathPaper fetches the paper of the id in the request's path
+func (s *UIServer) pathPaper(r *http.Request) (PaperView, int, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return PaperView{}, http.StatusBadRequest, errors.New("invalid paper ID")
+	}
+	paper, err := s.getPaper(id)
+	if err == sql.ErrNoRows {
+		return PaperView{}, http.StatusNotFound, errors.New("paper not found")
+	}
+	if err != nil {
+		return PaperView{}, http.StatusInternalServerError, fmt.Errorf("failed to fetch paper: %v", err)
+	}
+	return paper, http.StatusOK, nil
+}
+
+// parseAnnotationChange reads the read, starred and note parameters, at
+// least one of which must be given
+func parseAnnotationChange(r *http.Request) (annotationChange, error) {
+	var change annotationChange
+	if err := r.ParseForm(); err != nil {
+		return change, err
+	}
+	for name, field := range map[string]**bool{"read": &change.Read, "starred": &change.Starred} {
+		if _, ok := r.Form[name]; !ok {
+			continue
+		}
+		value, err := strconv.ParseBool(r.Form.Get(name))
+		if err != nil {
+			return change, fmt.Errorf("invalid %s %q, expected true or false", name, r.Form.Get(name))
+		}
+		*field = &value
+	}
+	if _, ok := r.Form["note"]; ok {
+		note := strings.TrimSpace(r.Form.Get("note"))
+		if len(note) > maxNoteLength {
+			return change, fmt.Errorf("notes are up to %d characters", maxNoteLength)
+		}
+		change.Note = &note
+	}
+	if change.Read == nil && change.Starred == nil && change.Note == nil {
+		return change, errors.New("give read, starred or note")
+	}
+	return change, nil
+}
+
+// setAnnotation changes a user's annotation of a paper and returns it. An
+// annotation with nothing marked is deleted.
+func (s *UIServer) setAnnotation(user, url string, change annotationChange) (Annotation, error) {
+	now := time.Now().UTC().Format(time.DateTime)
+	_, err := s.db.Exec(`INSERT INTO annotations (user, url, read, starred, note, updated)
+		VALUES (?, ?, COALESCE(?, 0), COALESCE(?, 0), COALESCE(?, ''), ?)
+		ON CONFLICT(user, url) DO UPDATE SET read = COALESCE(?, read), starred = COALESCE(?, starred),
+			note = COALESCE(?, note), updated = excluded.updated`,
+		user, url, change.Read, change.Starred, change.Note, now, change.Read, change.Starred, change.Note)
+	if err != nil {
+		return Annotation{}, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM annotations WHERE user = ? AND url = ? AND NOT read AND NOT starred AND note = ''`, user, url); err != nil {
+		return Annotation{}, err
+	}
+
+	annotation := Annotation{User: user, URL: url}
+	var updated time.Time
+	err = s.db.QueryRow(`SELECT read, starred, note, updated FROM annotations WHERE user = ? AND url = ?`, user, url).
+		Scan(&annotation.Read, &annotation.Starred, &annotation.Note, &updated)
+	if err == sql.ErrNoRows {
+		return annotation, nil
+	}
+	annotation.Updated = updated.UTC().Format(time.RFC3339)
+	return annotation, err
+}
+
+// getAnnotations fetches every user's annotation of a paper, by user
+func (s *UIServer) getAnnotations(url string) ([]Annotation, error) {
+	rows, err := s.db.Query(`SELECT user, read, starred, note, updated FROM annotations WHERE url = ? ORDER BY user`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var annotations []Annotation
+	for rows.Next() {
+		annotation := Annotation{URL: url}
+		var updated time.Time
+		if err := rows.Scan(&annotation.User, &annotation.Read, &annotation.Starred, &annotation.Note, &updated); err != nil {
+			return nil, err
+		}
+		annotation.Updated = updated.UTC().Format(time.RFC3339)
+		annotations = append(annotations, annotation)
+	}
+	return annotations, rows.Err()
+}
+
+// annotatePapers fills in how many users starred each paper, and the user's
+// own annotations of them
+func (s *UIServer) annotatePapers(user string, papers []PaperView) error {
+	if len(papers) == 0 {
+		return nil
+	}
+	byURL := make(map[string][]int)
+	var args []interface{}
+	for i, paper := range papers {
+		if _, ok := byURL[paper.URL]; !ok {
+			args = append(args, paper.URL)
+		}
+		byURL[paper.URL] = append(byURL[paper.URL], i)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	rows, err := s.db.Query(`SELECT url, user, read, starred, note FROM annotations WHERE url IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch annotations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var annotation Annotation
+		if err := rows.Scan(&annotation.URL, &annotation.User, &annotation.Read, &annotation.Starred, &annotation.Note); err != nil {
+			return err
+		}
+		for _, i := range byURL[annotation.URL] {
+			paper := &papers[i]
+			if annotation.Starred {
+				paper.Stars++
+			}
+			if annotation.User == user {
+				paper.Read, paper.Starred, paper.Note = annotation.Read, annotation.Starred, annotation.Note
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// redirectBack goes back to the page a form was posted from, else the index
+func (s *UIServer) redirectBack(w http.ResponseWriter, r *http.Request) {
+	back := s.url("/")
+	if referer := r.Referer(); referer != "" {
+		back = referer
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
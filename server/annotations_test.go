@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, err := server.db.Exec(`INSERT INTO paper_cache (url, title, citations) VALUES
+		('http://gnn', 'Graph Networks', 30), ('http://rag', 'Retrieval', 20)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := server.Handler()
+
+	request := func(method, target, user string, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	titles := func(params, user string) string {
+		t.Helper()
+		w := request("GET", "/api/v1/papers?"+params, user, nil)
+		var response struct{ Papers []PaperView }
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+		}
+		var titles []string
+		for _, paper := range response.Papers {
+			titles = append(titles, paper.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+
+	// Annotating takes a user, and at least one valid field
+	for _, tc := range []struct {
+		target, user string
+		form         url.Values
+		status       int
+	}{
+		{"/api/v1/papers/1/annotations", "", url.Values{"starred": {"true"}}, http.StatusBadRequest},
+		{"/api/v1/papers/1/annotations", "alice", url.Values{}, http.StatusBadRequest},
+		{"/api/v1/papers/1/annotations", "alice", url.Values{"read": {"maybe"}}, http.StatusBadRequest},
+		{"/api/v1/papers/9/annotations", "alice", url.Values{"read": {"true"}}, http.StatusNotFound},
+	} {
+		if w := request("POST", tc.target, tc.user, tc.form); w.Code != tc.status {
+			t.Errorf("Expected %d for %s as %q with %v, got %d", tc.status, tc.target, tc.user, tc.form, w.Code)
+		}
+	}
+
+	w := request("POST", "/api/v1/papers/1/annotations", "alice", url.Values{"starred": {"true"}, "note": {"Read section 3 "}})
+	var annotation Annotation
+	if err := json.Unmarshal(w.Body.Bytes(), &annotation); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if !annotation.Starred || annotation.Read || annotation.Note != "Read section 3" || annotation.Updated == "" {
+		t.Errorf("Unexpected annotation %+v", annotation)
+	}
+	request("POST", "/api/v1/papers/1/annotations", "bob", url.Values{"read": {"true"}, "starred": {"true"}})
+	request("POST", "/api/v1/papers/2/annotations", "bob", url.Values{"read": {"1"}})
+
+	// Fields left out are kept
+	w = request("POST", "/api/v1/papers/1/annotations", "alice", url.Values{"read": {"true"}})
+	json.Unmarshal(w.Body.Bytes(), &annotation)
+	if !annotation.Read || !annotation.Starred || annotation.Note != "Read section 3" {
+		t.Errorf("Unexpected annotation after marking it read %+v", annotation)
+	}
+
+	w = request("GET", "/api/v1/papers/1/annotations", "", nil)
+	var list struct{ Annotations []Annotation }
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Annotations) != 2 || list.Annotations[0].User != "alice" || list.Annotations[1].User != "bob" {
+		t.Errorf("Unexpected annotations %s", w.Body.String())
+	}
+
+	// Papers come with their stars and the user's own annotations
+	papers, _, err := server.getPapers(PaperQuery{Page: 1, PageSize: 10, User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if papers[0].Stars != 2 || !papers[0].Starred || !papers[0].Read || papers[0].Note != "Read section 3" || papers[1].Stars != 0 || papers[1].Read {
+		t.Errorf("Unexpected annotated papers %+v", papers)
+	}
+
+	// The mine filters are the requesting user's
+	if got := titles("mine=starred", "alice"); got != "Graph Networks" {
+		t.Errorf("Unexpected papers starred by alice %s", got)
+	}
+	if got := titles("mine=unread", "alice"); got != "Retrieval" {
+		t.Errorf("Unexpected papers alice hasn't read %s", got)
+	}
+	if got := titles("mine=read,noted", "bob"); got != "" {
+		t.Errorf("Unexpected papers bob read and noted %s", got)
+	}
+	if got := titles("sort=stars&order=asc", ""); got != "Retrieval,Graph Networks" {
+		t.Errorf("Unexpected papers by stars %s", got)
+	}
+
+	// An annotation with nothing left marked is deleted
+	request("POST", "/api/v1/papers/1/annotations", "alice", url.Values{"read": {"false"}, "starred": {"false"}, "note": {""}})
+	w = request("GET", "/api/v1/papers/1/annotations", "", nil)
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Annotations) != 1 || list.Annotations[0].User != "bob" {
+		t.Errorf("Unexpected annotations after clearing alice's %s", w.Body.String())
+	}
+
+	// The UI keeps the user in a cookie and annotates with forms
+	w = request("POST", "/user", "", url.Values{"user": {" carol "}})
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || len(cookies) != 1 || cookies[0].Value != "carol" {
+		t.Fatalf("Expected the user cookie to be set, got %d %v", w.Code, cookies)
+	}
+	get := func(target string) string {
+		req := httptest.NewRequest("GET", target, nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	body := get("/")
+	if !strings.Contains(body, `value="carol"`) || !strings.Contains(body, `action="/paper/1/annotations"`) || !strings.Contains(body, "★ 1") {
+		t.Errorf("Expected annotation controls on the index")
+	}
+
+	req := httptest.NewRequest("POST", "/paper/2/annotations", strings.NewReader("starred=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", "/?q=retrieval")
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?q=retrieval" {
+		t.Errorf("Expected a redirect back, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	body = get("/paper/2")
+	if !strings.Contains(body, "As carol:") || !strings.Contains(body, "checked> Starred") {
+		t.Errorf("Expected the annotations on the detail page: %s", body)
+	}
+	if !strings.Contains(body, `<span class="font-medium">bob</span>`) {
+		t.Errorf("Expected bob's annotation on the detail page")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// apiPrefixes are where the JSON API is served. /api is the unversioned
+// alias of the current version, kept for existing clients.
+var apiPrefixes = []string{"/api/v1", "/api"}
+
+// maxPageSize bounds the limit parameter
+const maxPageSize = 500
+
+// apiError is the body of every JSON API error response
+type apiError struct {
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+// writeAPIError responds with status and a JSON body explaining the error
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: message, Status: status})
+}
+
+// handleAPINotFound answers API paths that don't exist
+func (s *UIServer) handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "no API endpoint "+r.URL.Path)
+}
+
+// apiPrefix returns the API prefix r was sent to, so links in responses
+// stay in the same version
+func apiPrefix(r *http.Request) string {
+	for _, prefix := range apiPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return prefix
+		}
+	}
+	return apiPrefixes[0]
+}
+
+// paperCursor is the position after the last paper of a page. Listings
+// sorted on a column continue after its value and rowid, so papers added or
+// updated meanwhile don't shift the pages; relevance-ranked searches
+// continue at an offset.
+type paperCursor struct {
+	Sort   string      `json:"s"`
+	Desc   bool        `json:"d,omitempty"`
+	Value  interface{} `json:"v,omitempty"` // the sort value, a number or text, nil for NULL
+	RowID  int64       `json:"r,omitempty"`
+	Offset int         `json:"o,omitempty"`
+}
+
+// encode returns the cursor as an opaque string
+func (c paperCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor returned as nextCursor
+func decodeCursor(s string) (paperCursor, error) {
+	var c paperCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.Sort == "" {
+		return c, &QueryError{"invalid cursor, pass the nextCursor of a previous response"}
+	}
+	return c, nil
+}
+
+// parseAPIPage reads the limit and cursor parameters of the papers API
+func parseAPIPage(r *http.Request, query *PaperQuery) error {
+	params := r.URL.Query()
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid limit %q, expected a number up to %d", value, maxPageSize)
+		}
+		query.PageSize = min(n, maxPageSize)
+	}
+	if value := params.Get("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return err
+		}
+		query.cursor = &cursor
+	}
+	return nil
+}
+
+// paperFields maps the lowercased JSON fields of PaperView to their names
+var paperFields = func() map[string]string {
+	data, _ := json.Marshal(PaperView{})
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	names := make(map[string]string)
+	for name := range fields {
+		names[strings.ToLower(name)] = name
+	}
+	return names
+}()
+
+// parseFields reads the fields parameter, a comma-separated list of PaperView
+// fields in any case. It returns nil when every field is wanted.
+func parseFields(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		name, ok := paperFields[strings.ToLower(field)]
+		if !ok {
+			known := make([]string, 0, len(paperFields))
+			for _, name := range paperFields {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown field %q, expected some of %s", field, strings.Join(known, ", "))
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// projectPapers keeps only the given fields of each paper
+func projectPapers(papers []PaperView, fields []string) ([]map[string]json.RawMessage, error) {
+	projected := make([]map[string]json.RawMessage, 0, len(papers))
+	for _, paper := range papers {
+		data, err := json.Marshal(paper)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		kept := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			kept[field] = all[field]
+		}
+		projected = append(projected, kept)
+	}
+	return projected, nil
+}
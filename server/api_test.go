@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// papersResponse is the part of the papers API response the tests check
+type papersResponse struct {
+	Papers     []map[string]interface{} `json:"papers"`
+	Count      int                      `json:"count"`
+	Limit      int                      `json:"limit"`
+	NextCursor string                   `json:"nextCursor"`
+}
+
+func getPapersAPI(t *testing.T, server *UIServer, target string) (int, papersResponse, apiError) {
+	t.Helper()
+	req := httptest.NewRequest("GET", target, nil)
+	w := httptest.NewRecorder()
+	server.handlePapersAPI(w, req)
+	var response papersResponse
+	var apiErr apiError
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode %s: %v", w.Body, err)
+		}
+	} else if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("Expected a JSON error, got %s", w.Body)
+	}
+	return w.Code, response, apiErr
+}
+
+// cursorTestPapers have ties and missing values, which cursors must page through
+const cursorTestPapers = `
+	INSERT INTO paper_cache (url, title, citations, year, timestamp, added) VALUES
+		('http://a', 'alpha', 300, 2016, '2024-03-01 10:00:00', '2024-01-01 10:00:00'),
+		('http://b', 'Beta', 50, 2023, '2024-03-01 10:00:00', '2024-01-02 10:00:00'),
+		('http://c', 'gamma', 50, NULL, '2024-03-01 10:00:00', '2024-01-03 10:00:00'),
+		('http://d', 'Delta', NULL, 2023, '2024-03-01 10:00:00', '2024-01-04 10:00:00'),
+		('http://e', 'beta', NULL, NULL, '2024-03-01 10:00:00', '2024-01-05 10:00:00'),
+		('http://f', 'Epsilon', 9, 2016, '2024-03-01 10:00:00', '2024-01-06 10:00:00'),
+		('http://g', 'Zeta', 50, 2020, '2024-03-01 10:00:00', '2024-01-07 10:00:00')
+`
+
+func TestPapersAPICursor(t *testing.T) {
+	var server *UIServer
+	for _, params := range []string{"", "sort=citations&order=asc", "sort=title", "sort=title&order=desc", "sort=year", "sort=year&order=asc", "sort=added", "sort=velocity", "sort=velocity&order=asc", "sort=gain30"} {
+		server, _ = newTestServer(t)
+		if _, err := server.db.Exec(cursorTestPapers); err != nil {
+			t.Fatal(err)
+		}
+		query, _ := url.ParseQuery(params)
+		want, _, err := server.getPapers(PaperQuery{Page: 1, PageSize: 100, Sort: query.Get("sort"), Order: query.Get("order")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wantURLs, gotURLs []string
+		for _, paper := range want {
+			wantURLs = append(wantURLs, paper.URL)
+		}
+
+		target := "/api/v1/papers?limit=2&" + params
+		for pages := 0; target != ""; pages++ {
+			if pages > len(want) {
+				t.Fatalf("%s: expected the cursors to end", params)
+			}
+			code, response, apiErr := getPapersAPI(t, server, target)
+			if code != http.StatusOK {
+				t.Fatalf("%s: got status %d: %s", params, code, apiErr.Error)
+			}
+			if response.Count != len(want)-min(pages, 1) || response.Limit != 2 || len(response.Papers) > 2 {
+				t.Errorf("%s: unexpected page %+v", params, response)
+			}
+			for _, paper := range response.Papers {
+				gotURLs = append(gotURLs, paper["URL"].(string))
+			}
+
+			// Papers removed meanwhile don't shift the pages
+			if pages == 0 {
+				if _, err := server.db.Exec(`DELETE FROM paper_cache WHERE url = ?`, gotURLs[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			target = ""
+			if response.NextCursor != "" {
+				target = "/api/v1/papers?limit=2&" + params + "&cursor=" + url.QueryEscape(response.NextCursor)
+			}
+		}
+		if strings.Join(gotURLs, " ") != strings.Join(wantURLs, " ") {
+			t.Errorf("%s: paged through %v; want %v", params, gotURLs, wantURLs)
+		}
+	}
+
+	// A cursor only continues the order it was returned for
+	_, response, _ := getPapersAPI(t, server, "/api/v1/papers?limit=2&sort=title")
+	for _, invalid := range []string{"sort=year&cursor=" + response.NextCursor, "sort=title&order=desc&cursor=" + response.NextCursor, "cursor=bogus"} {
+		code, _, apiErr := getPapersAPI(t, server, "/api/v1/papers?"+invalid)
+		if code != http.StatusBadRequest || apiErr.Status != http.StatusBadRequest || !strings.Contains(apiErr.Error, "cursor") {
+			t.Errorf("%s: expected a 400 about the cursor; got %d %+v", invalid, code, apiErr)
+		}
+	}
+}
+
+func TestPapersAPILimitAndFields(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	_, err := server.db.Exec(`INSERT INTO paper_cache (url, title, citations, year, timestamp) VALUES ('http://a', 'Alpha', 3, 2016, '2024-03-01 10:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, response, _ := getPapersAPI(t, server, "/api/v1/papers?limit=100000")
+	if response.Limit != maxPageSize || response.NextCursor != "" {
+		t.Errorf("Expected the limit capped at %d and no next page, got %+v", maxPageSize, response)
+	}
+	_, response, _ = getPapersAPI(t, server, "/api/v1/papers")
+	if response.Limit != defaultPageSize {
+		t.Errorf("Expected the default limit, got %d", response.Limit)
+	}
+
+	_, response, _ = getPapersAPI(t, server, "/api/v1/papers?fields=title,url,YEAR")
+	if len(response.Papers) != 1 || fmt.Sprint(response.Papers[0]) != "map[Title:Alpha URL:http://a Year:2016]" {
+		t.Errorf("Expected the title, URL and year only, got %v", response.Papers)
+	}
+
+	for _, invalid := range []string{"limit=0", "limit=ten", "fields=title,venue"} {
+		code, _, apiErr := getPapersAPI(t, server, "/api/v1/papers?"+invalid)
+		if code != http.StatusBadRequest || apiErr.Status != http.StatusBadRequest || apiErr.Error == "" {
+			t.Errorf("%s: expected a JSON 400; got %d %+v", invalid, code, apiErr)
+		}
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/nothing", nil)
+	w := httptest.NewRecorder()
+	server.handleAPINotFound(w, req)
+	var apiErr apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil || w.Code != http.StatusNotFound || apiErr.Status != http.StatusNotFound {
+		t.Errorf("Expected a JSON 404; got %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected a JSON content type, got %q", got)
+	}
+
+	// Responses link to the version they were requested from
+	for path, want := range map[string]string{"/api/v1/refresh": "/api/v1/jobs/", "/api/refresh": "/api/jobs/"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader("url=http://missing"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.handleRefreshAPI(w, req)
+		if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"status":404`) {
+			t.Errorf("Expected a JSON 404 for a missing paper; got %d: %s", w.Code, w.Body)
+		}
+		if got := apiPrefix(req) + "/jobs/"; got != want {
+			t.Errorf("apiPrefix(%s) links to %s; want %s", path, got, want)
+		}
+	}
+}
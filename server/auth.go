@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// role is what a user may do, each role allowing what the ones before it do
+type role int
+
+const (
+	roleNone   role = iota // anonymous, when reads need a user
+	roleReader             // browse, search, export, follow feeds and annotate
+	roleEditor             // also add and refresh papers
+	roleAdmin              // also import lists and refresh every paper
+)
+
+// roleNames are the names of the roles, by role
+var roleNames = []string{"none", "reader", "editor", "admin"}
+
+func (r role) String() string {
+	return roleNames[r]
+}
+
+// parseRole parses the name of a role a user can be given
+func parseRole(name string) (role, error) {
+	for r, roleName := range roleNames {
+		if r != int(roleNone) && strings.EqualFold(strings.TrimSpace(name), roleName) {
+			return role(r), nil
+		}
+	}
+	return roleNone, fmt.Errorf("unknown role %q, expected reader, editor or admin", name)
+}
+
+// principal is who made a request
+type principal struct {
+	Name string // "" when anonymous
+	Role role
+}
+
+// errInvalidCredentials is returned for credentials that don't match a user
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// authenticator checks one kind of credentials. It reports ok false when a
+// request has none of its kind.
+type authenticator interface {
+	authenticate(r *http.Request) (p principal, ok bool, err error)
+}
+
+// authOptions are the settings of the server's authentication
+type authOptions struct {
+	Tokens          string // file of name:role:token lines
+	Htpasswd        string // htpasswd file, with an optional role after each hash
+	ProxyUserHeader string // header a trusted proxy gives the user in
+	ProxyRoleHeader string // header it gives their role in, reader without it
+	TrustedProxies  string // comma-separated addresses or CIDRs of the proxies
+	AnonymousReads  bool   // whether reading needs no user
+}
+
+// authConfig is how the server authenticates requests. Without
+// authenticators anyone may do anything, as before there was auth.
+type authConfig struct {
+	authenticators []authenticator
+	anonymousReads bool
+	basic          bool // whether to ask browsers for a password
+}
+
+// loadAuth sets up the authenticators the options configure
+func loadAuth(options authOptions) (*authConfig, error) {
+	auth := &authConfig{anonymousReads: options.AnonymousReads}
+	if options.Tokens != "" {
+		tokens, err := loadTokens(options.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		auth.authenticators = append(auth.authenticators, tokens)
+	}
+	if options.Htpasswd != "" {
+		users, err := loadHtpasswd(options.Htpasswd)
+		if err != nil {
+			return nil, err
+		}
+		auth.authenticators = append(auth.authenticators, users)
+		auth.basic = true
+	}
+	if options.ProxyUserHeader != "" {
+		proxy, err := newProxyAuth(options.ProxyUserHeader, options.ProxyRoleHeader, options.TrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		auth.authenticators = append(auth.authenticators, proxy)
+	} else if options.ProxyRoleHeader != "" || options.TrustedProxies != "" {
+		return nil, errors.New("trusted proxies need the header they give the user in")
+	}
+	return auth, nil
+}
+
+// enabled reports whether requests are authenticated at all
+func (a *authConfig) enabled() bool {
+	return a != nil && len(a.authenticators) > 0
+}
+
+// principalOf authenticates a request with the first authenticator its
+// credentials are for. Without credentials it is anonymous, a reader if
+// reads are open.
+func (a *authConfig) principalOf(r *http.Request) (principal, error) {
+	if !a.enabled() {
+		return principal{Role: roleAdmin}, nil
+	}
+	for _, auth := range a.authenticators {
+		p, ok, err := auth.authenticate(r)
+		if err != nil {
+			return principal{}, err
+		}
+		if ok {
+			return p, nil
+		}
+	}
+	if a.anonymousReads {
+		return principal{Role: roleReader}, nil
+	}
+	return principal{}, nil
+}
+
+// refuse answers a request its user can't make: 401 asking for credentials
+// when anonymous, else 403
+func (a *authConfig) refuse(w http.ResponseWriter, r *http.Request, p principal, message string) {
+	status := http.StatusForbidden
+	if p.Name == "" {
+		status = http.StatusUnauthorized
+		if a.basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Most Cited Papers", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Most Cited Papers"`)
+		}
+	}
+	writeError(w, r, status, message)
+}
+
+// principalKey is the context key of the principal of a request
+type principalKey struct{}
+
+// requestPrincipal returns who made a request, as authenticate found
+func requestPrincipal(r *http.Request) principal {
+	p, _ := r.Context().Value(principalKey{}).(principal)
+	return p
+}
+
+// authenticate records who made each request, refusing bad credentials
+func (s *UIServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := s.auth.principalOf(r)
+		if err != nil {
+			s.auth.refuse(w, r, principal{}, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// sameOrigin refuses requests that change something when a browser says
+// they come from another site, so other pages can't post the forms with the
+// credentials the browser sends by itself. Clients that aren't browsers send
+// neither Sec-Fetch-Site nor Origin and are let through.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed := true
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+			allowed = site == "same-origin" || site == "none"
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			allowed = err == nil && strings.EqualFold(u.Host, r.Host)
+		}
+		if !allowed {
+			writeError(w, r, http.StatusForbidden, "Cross-origin requests are refused")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// require refuses requests to handler from users without the role. Only
+// reads are served from a read-only database.
+func (s *UIServer) require(needed role, handler http.HandlerFunc) http.HandlerFunc {
+	if s.readOnly && needed > roleReader {
+		return s.handleReadOnly
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth.enabled() {
+			if p := requestPrincipal(r); p.Role < needed {
+				s.auth.refuse(w, r, p, "This needs the "+needed.String()+" role")
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// requireUser refuses requests to handler from anonymous users when there
+// is auth, as handler changes what is the user's own. Like every change,
+// they are refused from a read-only database.
+func (s *UIServer) requireUser(handler http.HandlerFunc) http.HandlerFunc {
+	if s.readOnly {
+		return s.handleReadOnly
+	}
+	return s.require(roleReader, func(w http.ResponseWriter, r *http.Request) {
+		if p := requestPrincipal(r); s.auth.enabled() && p.Name == "" {
+			s.auth.refuse(w, r, p, "Sign in to annotate papers")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// hasRole reports whether the user of a request has a role, always true
+// without auth
+func (s *UIServer) hasRole(r *http.Request, needed role) bool {
+	return !s.auth.enabled() || requestPrincipal(r).Role >= needed
+}
+
+// canEdit reports whether the user of a request may change papers, for
+// the pages to offer them the controls
+func (s *UIServer) canEdit(r *http.Request) bool {
+	return !s.readOnly && s.hasRole(r, roleEditor)
+}
+
+// writeError writes an error as JSON for the API and as text for pages
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, status, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// tokenAuth authenticates API clients by the bearer token in their
+// Authorization header
+type tokenAuth struct {
+	tokens []tokenEntry
+}
+
+type tokenEntry struct {
+	principal
+	token []byte
+}
+
+// loadTokens reads a file of name:role:token lines. Blank lines and lines
+// starting with # are skipped.
+func loadTokens(path string) (*tokenAuth, error) {
+	auth := &tokenAuth{}
+	err := readCredentials(path, func(line string) error {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[0] == "" || len(fields[2]) < 16 {
+			return errors.New("expected name:role:token, with a token of at least 16 characters")
+		}
+		r, err := parseRole(fields[1])
+		if err != nil {
+			return err
+		}
+		auth.tokens = append(auth.tokens, tokenEntry{principal{Name: fields[0], Role: r}, []byte(fields[2])})
+		return nil
+	})
+	return auth, err
+}
+
+func (a *tokenAuth) authenticate(r *http.Request) (principal, bool, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return principal{}, false, nil
+	}
+	// Every token is compared, so the time taken doesn't tell which matched
+	var found *tokenEntry
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(a.tokens[i].token, []byte(strings.TrimSpace(token))) == 1 {
+			found = &a.tokens[i]
+		}
+	}
+	if found == nil {
+		return principal{}, false, errInvalidCredentials
+	}
+	return found.principal, true, nil
+}
+
+// basicAuth authenticates users by HTTP basic auth against a htpasswd file
+type basicAuth struct {
+	users map[string]htpasswdEntry
+}
+
+type htpasswdEntry struct {
+	hash string
+	role role
+}
+
+// loadHtpasswd reads a htpasswd file of user:hash lines, with bcrypt
+// (htpasswd -B) or SHA-1 (htpasswd -s) hashes. A role can follow the hash
+// as user:hash:role; users are readers without one.
+func loadHtpasswd(path string) (*basicAuth, error) {
+	auth := &basicAuth{users: make(map[string]htpasswdEntry)}
+	err := readCredentials(path, func(line string) error {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return errors.New("expected user:hash")
+		}
+		entry := htpasswdEntry{hash: rest, role: roleReader}
+		// bcrypt and SHA-1 hashes have no colons
+		if hash, roleName, ok := strings.Cut(rest, ":"); ok {
+			r, err := parseRole(roleName)
+			if err != nil {
+				return err
+			}
+			entry = htpasswdEntry{hash: hash, role: r}
+		}
+		if !isBcryptHash(entry.hash) && !strings.HasPrefix(entry.hash, "{SHA}") {
+			return fmt.Errorf("unsupported hash for %s, use htpasswd -B", name)
+		}
+		auth.users[name] = entry
+		return nil
+	})
+	return auth, err
+}
+
+func (a *basicAuth) authenticate(r *http.Request) (principal, bool, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return principal{}, false, nil
+	}
+	entry, ok := a.users[name]
+	if !ok || !checkPassword(entry.hash, password) {
+		return principal{}, false, errInvalidCredentials
+	}
+	return principal{Name: name, Role: entry.role}, true, nil
+}
+
+// isBcryptHash reports whether a htpasswd hash is a bcrypt one
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// checkPassword checks a password against a htpasswd hash
+func checkPassword(hash, password string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	sum := sha1.Sum([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(hash), []byte("{SHA}"+base64.StdEncoding.EncodeToString(sum[:]))) == 1
+}
+
+// proxyAuth trusts the user, and their role, a reverse proxy in front of
+// the server authenticated and passed in headers. Headers from anywhere
+// else are ignored.
+type proxyAuth struct {
+	userHeader string
+	roleHeader string
+	trusted    []*net.IPNet
+}
+
+// newProxyAuth trusts the headers of the proxies at the comma-separated
+// addresses or CIDRs, by default only those on the same host
+func newProxyAuth(userHeader, roleHeader, trusted string) (*proxyAuth, error) {
+	auth := &proxyAuth{userHeader: userHeader, roleHeader: roleHeader}
+	if strings.TrimSpace(trusted) == "" {
+		trusted = "127.0.0.1,::1"
+	}
+	for _, value := range strings.Split(trusted, ",") {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", value, err)
+		}
+		auth.trusted = append(auth.trusted, network)
+	}
+	return auth, nil
+}
+
+func (a *proxyAuth) authenticate(r *http.Request) (principal, bool, error) {
+	name := strings.TrimSpace(r.Header.Get(a.userHeader))
+	if name == "" || !a.isTrusted(r.RemoteAddr) {
+		return principal{}, false, nil
+	}
+	p := principal{Name: name, Role: roleReader}
+	if a.roleHeader != "" {
+		if roleName := r.Header.Get(a.roleHeader); roleName != "" {
+			userRole, err := parseRole(roleName)
+			if err != nil {
+				return principal{}, false, err
+			}
+			p.Role = userRole
+		}
+	}
+	return p, true, nil
+}
+
+// isTrusted reports whether a request's remote address is a trusted proxy
+func (a *proxyAuth) isTrusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range a.trusted {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// readCredentials calls parse with each line of a credentials file that
+// isn't blank or a comment
+func readCredentials(path string, parse func(line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parse(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
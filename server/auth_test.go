@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCredentials writes a tokens or htpasswd file and returns its path
+func writeCredentials(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuth(t *testing.T) {
+	server, ran := newTestServer(t)
+	_, err := server.db.Exec(`INSERT INTO paper_cache (url, title, citations) VALUES ('http://gnn', 'Graph Networks', 30)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.auth, err = loadAuth(authOptions{
+		Tokens: writeCredentials(t, "tokens", "# CI\nci:editor:0123456789abcdef\nops:admin:fedcba9876543210\n"),
+		Htpasswd: writeCredentials(t, "htpasswd", "alice:"+string(hash)+":editor\n"+
+			"bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), // "secret"
+		ProxyUserHeader: "X-Forwarded-User",
+		ProxyRoleHeader: "X-Forwarded-Role",
+		TrustedProxies:  "10.0.0.0/8",
+		AnonymousReads:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := server.Handler()
+
+	request := func(method, target, body string, headers ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		if req.Header.Get("X-Forwarded-User") != "" {
+			req.RemoteAddr = "10.1.2.3:4567"
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	basic := func(name, password string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(name, password)
+		return req.Header.Get("Authorization")
+	}
+
+	for _, tc := range []struct {
+		name, method, target, body string
+		headers                    []string
+		status                     int
+	}{
+		{"anonymous read", "GET", "/api/v1/papers", "", nil, http.StatusOK},
+		{"anonymous page", "GET", "/", "", nil, http.StatusOK},
+		{"anonymous refresh", "POST", "/api/v1/refresh", "url=http://gnn", nil, http.StatusUnauthorized},
+		{"bad token", "GET", "/api/v1/papers", "", []string{"Authorization", "Bearer wrong"}, http.StatusUnauthorized},
+		{"editor token", "POST", "/api/v1/refresh", "url=http://gnn", []string{"Authorization", "Bearer 0123456789abcdef"}, http.StatusAccepted},
+		{"editor refreshing all", "POST", "/api/v1/refresh", "all=true", []string{"Authorization", "Bearer 0123456789abcdef"}, http.StatusForbidden},
+		{"admin refreshing all", "POST", "/api/v1/refresh", "all=true", []string{"Authorization", "Bearer fedcba9876543210"}, http.StatusAccepted},
+		{"editor import", "POST", "/api/v1/papers/import?format=md", "", []string{"Authorization", "Bearer 0123456789abcdef"}, http.StatusForbidden},
+		{"bcrypt editor", "POST", "/api/v1/papers/1/annotations", "starred=true", []string{"Authorization", basic("alice", "secret")}, http.StatusOK},
+		{"wrong password", "GET", "/", "", []string{"Authorization", basic("alice", "wrong")}, http.StatusUnauthorized},
+		{"SHA reader", "GET", "/api/v1/papers", "", []string{"Authorization", basic("bob", "secret")}, http.StatusOK},
+		{"SHA reader annotating", "POST", "/api/v1/papers/1/annotations", "read=true", []string{"Authorization", basic("bob", "secret")}, http.StatusOK},
+		{"anonymous annotating", "POST", "/api/v1/papers/1/annotations", "read=true", []string{"X-User", "bob"}, http.StatusUnauthorized},
+		{"proxy editor", "POST", "/api/v1/papers/1/annotations", "read=true", []string{"X-Forwarded-User", "carol", "X-Forwarded-Role", "editor"}, http.StatusOK},
+		{"proxy with a bad role", "GET", "/", "", []string{"X-Forwarded-User", "carol", "X-Forwarded-Role", "owner"}, http.StatusUnauthorized},
+	} {
+		if w := request(tc.method, tc.target, tc.body, tc.headers...); w.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+	}
+	for range 2 {
+		<-ran
+	}
+
+	// Anonymous users are asked to sign in, others told what they lack
+	w := request("POST", "/refresh", "url=http://gnn")
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("Expected a basic auth challenge, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	w = request("POST", "/api/v1/refresh", "url=http://gnn", "Authorization", basic("bob", "secret"))
+	if w.Code != http.StatusForbidden || w.Header().Get("WWW-Authenticate") != "" || !strings.Contains(w.Body.String(), "editor role") {
+		t.Errorf("Unexpected refusal of a reader %q: %s", w.Header().Get("WWW-Authenticate"), w.Body.String())
+	}
+
+	// Headers from untrusted addresses are ignored
+	req := httptest.NewRequest("POST", "/api/v1/papers/1/annotations", strings.NewReader("read=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-User", "mallory")
+	req.Header.Set("X-Forwarded-Role", "admin")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected proxy headers from %s to be ignored, got %d", req.RemoteAddr, w.Code)
+	}
+
+	// Users annotate as who they signed in as, whatever X-User says
+	w = request("POST", "/api/v1/papers/1/annotations", "note=mine", "Authorization", basic("alice", "secret"), "X-User", "bob")
+	if !strings.Contains(w.Body.String(), `"user":"alice"`) {
+		t.Errorf("Expected alice's annotation, got %s", w.Body.String())
+	}
+	annotations, err := server.getAnnotations("http://gnn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 3 || annotations[0].User != "alice" || annotations[1].User != "bob" || annotations[2].User != "carol" {
+		t.Errorf("Unexpected annotations %+v", annotations)
+	}
+
+	// Pages only offer what the user may do
+	if body := request("GET", "/", "").Body.String(); strings.Contains(body, "addPaperForm") || !strings.Contains(body, "data-read-only") || strings.Contains(body, "annotate-form") {
+		t.Errorf("Expected no write controls for anonymous users")
+	}
+	body := request("GET", "/", "", "Authorization", basic("bob", "secret")).Body.String()
+	if strings.Contains(body, "refresh-form") || !strings.Contains(body, "annotate-form") || !strings.Contains(body, `data-user="bob"`) {
+		t.Errorf("Expected a reader to annotate papers but not refresh them")
+	}
+	body = request("GET", "/", "", "Authorization", basic("alice", "secret")).Body.String()
+	if !strings.Contains(body, "addPaperForm") || !strings.Contains(body, "Signed in as") || !strings.Contains(body, `action="/paper/1/annotations"`) {
+		t.Errorf("Expected write controls for an editor")
+	}
+
+	// Other sites can't post the forms with the browser's credentials
+	for _, headers := range [][]string{{"Sec-Fetch-Site", "cross-site"}, {"Sec-Fetch-Site", "same-site"}, {"Origin", "https://evil.example"}} {
+		w := request("POST", "/refresh", "url=http://gnn", append(headers, "Authorization", basic("alice", "secret"))...)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected a refresh with %v to be refused, got %d", headers, w.Code)
+		}
+	}
+	for _, headers := range [][]string{{"Sec-Fetch-Site", "same-origin"}, {"Origin", "http://example.com"}} {
+		w := request("POST", "/refresh", "url=http://gnn", append(headers, "Authorization", basic("alice", "secret"))...)
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("Expected a refresh with %v to be queued, got %d", headers, w.Code)
+		}
+		<-ran
+	}
+
+	// Without anonymous reads every request needs a user
+	server.auth.anonymousReads = false
+	if w := request("GET", "/api/v1/papers", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an anonymous read, got %d", w.Code)
+	}
+	if w := request("GET", "/api/v1/papers", "", "Authorization", basic("bob", "secret")); w.Code != http.StatusOK {
+		t.Errorf("Expected a reader to read, got %d", w.Code)
+	}
+}
+
+func TestLoadAuth(t *testing.T) {
+	// Without authenticators everyone is an admin, as before auth
+	auth, err := loadAuth(authOptions{AnonymousReads: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := auth.principalOf(httptest.NewRequest("GET", "/", nil)); auth.enabled() || p.Role != roleAdmin {
+		t.Errorf("Expected open access without auth, got %+v", p)
+	}
+
+	for name, options := range map[string]authOptions{
+		"short token":      {Tokens: writeCredentials(t, "tokens", "ci:editor:short\n")},
+		"unknown role":     {Tokens: writeCredentials(t, "tokens", "ci:owner:0123456789abcdef\n")},
+		"plaintext":        {Htpasswd: writeCredentials(t, "htpasswd", "alice:secret\n")},
+		"missing file":     {Htpasswd: filepath.Join(t.TempDir(), "missing")},
+		"bad proxy":        {ProxyUserHeader: "X-Forwarded-User", TrustedProxies: "proxy.local"},
+		"proxy, no header": {TrustedProxies: "10.0.0.0/8"},
+	} {
+		if _, err := loadAuth(options); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+)
+
+// collectionCondition selects the papers listed in a collection
+const collectionCondition = `EXISTS (SELECT 1 FROM collection_papers c WHERE c.url = paper_cache.url AND c.collection = ? AND c.removed IS NULL)`
+
+// listedCondition selects the papers still listed in a collection, or never
+// listed in one like those added through the server, leaving out the papers
+// dropped from every list they were in
+const listedCondition = `(EXISTS (SELECT 1 FROM collection_papers c WHERE c.url = paper_cache.url AND c.removed IS NULL)
+	OR NOT EXISTS (SELECT 1 FROM collection_papers c WHERE c.url = paper_cache.url))`
+
+// firstSeenColumn is when a paper first showed up in a list it is still in,
+// else when it was added
+const firstSeenColumn = `COALESCE((SELECT MIN(c.first_seen) FROM collection_papers c WHERE c.url = paper_cache.url AND c.removed IS NULL), paper_cache.added)`
+
+// newDays is the period of the "new this week" view
+const newDays = 7
+
+// collectionSummary is a collection with the number of papers listed in it
+type collectionSummary struct {
+	Name   string
+	Source string // the list file it was last read from
+	Papers int
+}
+
+// paperCollection is a collection a paper is or was listed in
+type paperCollection struct {
+	Collection string
+	Source     string
+	Section    string
+	FirstSeen  string
+	LastSeen   string
+	Removed    string // when it was dropped from the list, "" while listed
+}
+
+// handleNew shows the papers first seen in the last week, newest first, in
+// the index with the filters of the request
+func (s *UIServer) handleNew(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if params.Get("new_days") == "" {
+		params.Set("new_days", strconv.Itoa(newDays))
+	}
+	if params.Get("sort") == "" {
+		params.Set("sort", "first_seen")
+	}
+	http.Redirect(w, r, s.url("/?")+params.Encode(), http.StatusFound)
+}
+
+// getCollections fetches the collections by name, with the number of their
+// papers
+func (s *UIServer) getCollections() ([]collectionSummary, error) {
+	rows, err := s.db.Query(`
+		SELECT name, source, (SELECT COUNT(*) FROM collection_papers p JOIN paper_cache ON paper_cache.url = p.url
+			WHERE p.collection = collections.name AND p.removed IS NULL)
+		FROM collections ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []collectionSummary
+	for rows.Next() {
+		var c collectionSummary
+		if err := rows.Scan(&c.Name, &c.Source, &c.Papers); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// getPaperCollections fetches the collections a paper is or was listed in
+func (s *UIServer) getPaperCollections(url string) ([]paperCollection, error) {
+	rows, err := s.db.Query(`
+		SELECT p.collection, c.source, p.section, p.first_seen, p.last_seen, p.removed
+		FROM collection_papers p JOIN collections c ON c.name = p.collection
+		WHERE p.url = ? ORDER BY p.collection`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []paperCollection
+	for rows.Next() {
+		var c paperCollection
+		var removed sql.NullString
+		if err := rows.Scan(&c.Collection, &c.Source, &c.Section, &c.FirstSeen, &c.LastSeen, &removed); err != nil {
+			return nil, err
+		}
+		c.FirstSeen, c.LastSeen = formatTimestamp(c.FirstSeen), formatTimestamp(c.LastSeen)
+		if removed.Valid {
+			c.Removed = formatTimestamp(removed.String)
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollections(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	recent := time.Now().UTC().AddDate(0, 0, -2).Format(time.DateTime)
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, added) VALUES
+			('http://gnn', 'Listed GNN', 30, '2024-01-01 10:00:00'),
+			('http://rag', 'Recent RAG', 20, '2024-01-01 10:00:00'),
+			('http://gone', 'Dropped', 10, '2024-01-01 10:00:00'),
+			('http://ui', 'Added in the UI', 5, '2024-01-01 10:00:00');
+		INSERT INTO collections (name, source) VALUES ('graph-papers', '/lists/graph-papers.md'), ('rag-papers', '/lists/rag-papers.md');
+		INSERT INTO collection_papers (collection, url, section, first_seen, last_seen, removed) VALUES
+			('graph-papers', 'http://gnn', 'Surveys', '2024-01-01 10:00:00', ?, NULL),
+			('rag-papers', 'http://rag', '', ?, ?, NULL),
+			('graph-papers', 'http://gone', '', '2024-01-01 10:00:00', '2024-02-01 10:00:00', '2024-03-01 10:00:00');
+	`, recent, recent, recent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles := func(query PaperQuery) string {
+		t.Helper()
+		query.Page, query.PageSize = 1, 10
+		papers, _, err := server.getPapers(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, paper := range papers {
+			titles = append(titles, paper.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+
+	// Papers dropped from every list they were in are left out
+	if got := titles(PaperQuery{}); got != "Listed GNN,Recent RAG,Added in the UI" {
+		t.Errorf("Unexpected papers %s", got)
+	}
+	if got := titles(PaperQuery{Collection: "graph-papers"}); got != "Listed GNN" {
+		t.Errorf("Unexpected papers in graph-papers %s", got)
+	}
+	week := 7
+	if got := titles(PaperQuery{NewDays: &week, Sort: "first_seen"}); got != "Recent RAG" {
+		t.Errorf("Unexpected new papers %s", got)
+	}
+
+	// The index switches between collections
+	req := httptest.NewRequest("GET", "/?collection=graph-papers&min_citations=1", nil)
+	w := httptest.NewRecorder()
+	server.handleIndex(w, req)
+	body := w.Body.String()
+	for _, want := range []string{
+		`<a href="?min_citations=1" class="ml-1 hover:text-gray-900">All</a>`,
+		`href="?collection=rag-papers&amp;min_citations=1" title="/lists/rag-papers.md" class="hover:text-gray-900">rag-papers (1)</a>`,
+		`class="font-medium text-gray-900">graph-papers (1)</a>`,
+		`<input type="hidden" name="collection" value="graph-papers">`,
+		`href="/new?collection=graph-papers"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the index to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "Recent RAG") {
+		t.Error("Expected only papers of graph-papers")
+	}
+
+	// The new view is the index of papers first seen in the last week
+	req = httptest.NewRequest("GET", "/new?collection=rag-papers", nil)
+	w = httptest.NewRecorder()
+	server.handleNew(w, req)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "/?collection=rag-papers&new_days=7&sort=first_seen" {
+		t.Errorf("Unexpected redirect %d to %q", w.Code, location)
+	}
+
+	// The paper's page shows the lists it was in
+	req = httptest.NewRequest("GET", "/paper/3", nil)
+	req.SetPathValue("id", "3")
+	w = httptest.NewRecorder()
+	server.handlePaper(w, req)
+	if want := "first seen Jan 01, 2024 10:00, last seen Feb 01, 2024 10:00, removed Mar 01, 2024 10:00"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected the paper's page to contain %q", want)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read when it exists and no other config file is given
+const defaultConfigFile = "most-cited-papers.yaml"
+
+// Config is the part of the YAML config the server uses: the database, and
+// the server section, which only the server reads
+type Config struct {
+	DB     string
+	Server serverConfig
+}
+
+// serverConfig is the server section of the config
+type serverConfig struct {
+	Addr      string            `yaml:"addr"`
+	PageSize  int               `yaml:"page_size"`
+	Collector string            `yaml:"collector"` // command the server runs for refresh jobs
+	PublicURL string            `yaml:"public_url"`
+	Databases map[string]string `yaml:"databases"` // databases served read-only, by name
+	Auth      struct {
+		Tokens   string `yaml:"tokens"`
+		Htpasswd string `yaml:"htpasswd"`
+		Proxy    struct {
+			UserHeader string   `yaml:"user_header"`
+			RoleHeader string   `yaml:"role_header"`
+			Trusted    []string `yaml:"trusted"`
+		} `yaml:"proxy"`
+		AnonymousReads *bool `yaml:"anonymous_reads"` // true when unset
+	} `yaml:"auth"` // who may use the server
+}
+
+// configEnv maps environment variables to the flags they override
+var configEnv = map[string]string{
+	"MCP_DB":         "db",
+	"MCP_ADDR":       "addr",
+	"MCP_PAGE_SIZE":  "page-size",
+	"MCP_COLLECTOR":  "collector",
+	"MCP_PUBLIC_URL": "public-url",
+	"MCP_DATABASES":  "databases",
+
+	"MCP_TOKENS":            "tokens",
+	"MCP_HTPASSWD":          "htpasswd",
+	"MCP_PROXY_USER_HEADER": "proxy-user-header",
+	"MCP_PROXY_ROLE_HEADER": "proxy-role-header",
+	"MCP_TRUSTED_PROXIES":   "trusted-proxies",
+	"MCP_ANONYMOUS_READS":   "anonymous-reads",
+}
+
+// loadConfig reads the config file at path. An empty path means $MCP_CONFIG,
+// or most-cited-papers.yaml if it exists; with neither, the config is empty.
+// Keys that only the collector uses are left to it.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		path = os.Getenv("MCP_CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return cfg, nil
+		}
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	var file struct {
+		DB     string    `yaml:"db"`
+		Server yaml.Node `yaml:"server"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	cfg.DB = file.DB
+
+	// The collector checks its own keys, the server those of its section
+	if file.Server.Kind != 0 {
+		section, err := yaml.Marshal(&file.Server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config %s: %v", path, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(section))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg.Server); err != nil {
+			return nil, fmt.Errorf("invalid server config in %s: %v", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// apply sets every flag of fs that wasn't given on the command line to its
+// value from the config or environment. Flags win over the environment,
+// which wins over the file.
+func (cfg *Config) apply(fs *flag.FlagSet) error {
+	values := make(map[string]string)
+	if cfg.DB != "" {
+		values["db"] = cfg.DB
+	}
+	if cfg.Server.Addr != "" {
+		values["addr"] = cfg.Server.Addr
+	}
+	if cfg.Server.PageSize != 0 {
+		values["page-size"] = fmt.Sprint(cfg.Server.PageSize)
+	}
+	if cfg.Server.Collector != "" {
+		values["collector"] = cfg.Server.Collector
+	}
+	if cfg.Server.PublicURL != "" {
+		values["public-url"] = cfg.Server.PublicURL
+	}
+	if len(cfg.Server.Databases) > 0 {
+		values["databases"] = formatDatabases(cfg.Server.Databases)
+	}
+	auth := cfg.Server.Auth
+	if auth.Tokens != "" {
+		values["tokens"] = auth.Tokens
+	}
+	if auth.Htpasswd != "" {
+		values["htpasswd"] = auth.Htpasswd
+	}
+	if auth.Proxy.UserHeader != "" {
+		values["proxy-user-header"] = auth.Proxy.UserHeader
+	}
+	if auth.Proxy.RoleHeader != "" {
+		values["proxy-role-header"] = auth.Proxy.RoleHeader
+	}
+	if len(auth.Proxy.Trusted) > 0 {
+		values["trusted-proxies"] = strings.Join(auth.Proxy.Trusted, ",")
+	}
+	if auth.AnonymousReads != nil {
+		values["anonymous-reads"] = fmt.Sprint(*auth.AnonymousReads)
+	}
+	for env, name := range configEnv {
+		if value, ok := os.LookupEnv(env); ok {
+			values[name] = value
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range values {
+		if set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in config: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// configDatabases reads the databases to serve from the config file at path
+// and the environment again, for a reload
+func configDatabases(path string) (string, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return "", err
+	}
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	databases := fs.String("databases", "", "")
+	if err := cfg.apply(fs); err != nil {
+		return "", err
+	}
+	return *databases, nil
+}
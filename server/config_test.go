@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "db: papers.db\ndelay: 2s\nserver:\n  addr: \":8080\"\n  page_size: 50\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("MCP_ADDR", ":9090")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	db := fs.String("db", "paper_cache.db", "")
+	addr := fs.String("addr", ":9001", "")
+	pageSize := fs.Int("page-size", defaultPageSize, "")
+	if err := fs.Parse([]string{"-db", "flag.db"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := cfg.apply(fs); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	if *db != "flag.db" || *addr != ":9090" || *pageSize != 50 {
+		t.Errorf("Unexpected settings db=%q addr=%q page-size=%d", *db, *addr, *pageSize)
+	}
+}
+
+func TestConfigDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "server:\n  databases:\n    vision: vision.db\n    graphs: graphs.db\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	databases, err := configDatabases(path)
+	if err != nil {
+		t.Fatalf("configDatabases failed: %v", err)
+	}
+	if databases != "graphs=graphs.db,vision=vision.db" {
+		t.Errorf("Unexpected databases %q", databases)
+	}
+
+	// The environment wins over the file
+	t.Setenv("MCP_DATABASES", "other=other.db")
+	if databases, _ := configDatabases(path); databases != "other=other.db" {
+		t.Errorf("Unexpected databases %q", databases)
+	}
+}
+
+func TestLoadConfigChecksServerSection(t *testing.T) {
+	cfg, err := loadConfig("../most-cited-papers.example.yaml")
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.Server.PageSize != 25 {
+		t.Errorf("Expected page size 25, got %d", cfg.Server.PageSize)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("delay: 2s\nserver:\n  page_sise: 50\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "page_sise") {
+		t.Errorf("Expected an error about the unknown key, got %v", err)
+	}
+}
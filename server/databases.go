@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// databaseNameRegex matches the names databases are mounted under
+var databaseNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// parseDatabases parses a list of named databases like
+// "graphs=graphs.db,vision=/data/vision.db" into paths by name
+func parseDatabases(value string) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(entry, "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid database %q, expected name=path", entry)
+		}
+		if !databaseNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid database name %q, expected lowercase letters, digits, - and _", name)
+		}
+		if _, ok := paths[name]; ok {
+			return nil, fmt.Errorf("database %s is given twice", name)
+		}
+		paths[name] = path
+	}
+	return paths, nil
+}
+
+// formatDatabases formats paths by name as parseDatabases reads them
+func formatDatabases(paths map[string]string) string {
+	var entries []string
+	for _, name := range slices.Sorted(maps.Keys(paths)) {
+		entries = append(entries, name+"="+paths[name])
+	}
+	return strings.Join(entries, ",")
+}
+
+// NewReadOnlyUIServer serves a database the collector keeps elsewhere,
+// mounted at base. It is opened read-only with its own connection pool, so
+// the server can't add, import or refresh papers in it.
+func NewReadOnlyUIServer(dbFilePath, base string) (*UIServer, error) {
+	// SQLite would make a missing file a read-only error on the first query
+	if _, err := os.Stat(dbFilePath); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbFilePath+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	search, err := checkSchema(db, false)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &UIServer{
+		db:         db,
+		dbFilePath: dbFilePath,
+		pageSize:   defaultPageSize,
+		collector:  defaultCollector,
+		search:     search,
+		base:       base,
+		readOnly:   true,
+	}
+	if err := s.parseTemplates(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.jobs = newJobQueue(s.runCollector)
+	return s, nil
+}
+
+// mountedDatabase is a database of a databaseSet and the handler serving it
+type mountedDatabase struct {
+	path     string
+	server   *UIServer
+	handler  http.Handler
+	requests sync.WaitGroup // requests being served, which a reload waits for
+}
+
+// databaseSet serves several databases read-only, each at /{name}/, with a
+// landing page listing them at /. The set can be reloaded while serving.
+type databaseSet struct {
+	mu        sync.RWMutex
+	databases map[string]*mountedDatabase
+	pageSize  int
+	auth      *authConfig // how the databases authenticate requests
+	publicURL string      // scheme and host of the links in feeds, from the request when ""
+	landing   *template.Template
+}
+
+// newDatabaseSet creates an empty set of databases showing pageSize papers
+// per page
+func newDatabaseSet(pageSize int) *databaseSet {
+	return &databaseSet{
+		databases: make(map[string]*mountedDatabase),
+		pageSize:  pageSize,
+		landing:   template.Must(template.New("landing").Parse(landingTemplate)),
+	}
+}
+
+// load makes the set serve the databases at paths by name. Databases that
+// are new or moved are opened first, so if one fails the set is unchanged;
+// then those no longer served are closed in the background, once their
+// requests finish.
+func (d *databaseSet) load(paths map[string]string) error {
+	d.mu.RLock()
+	current := d.databases
+	d.mu.RUnlock()
+
+	databases := make(map[string]*mountedDatabase)
+	var opened []*UIServer
+	for name, path := range paths {
+		if db, ok := current[name]; ok && db.path == path {
+			databases[name] = db
+			continue
+		}
+		server, err := NewReadOnlyUIServer(path, "/"+name)
+		if err != nil {
+			for _, server := range opened {
+				server.Close()
+			}
+			return fmt.Errorf("failed to open database %s at %s: %v", name, path, err)
+		}
+		server.pageSize = d.pageSize
+		server.auth = d.auth
+		server.publicURL = d.publicURL
+		opened = append(opened, server)
+		databases[name] = &mountedDatabase{path: path, server: server, handler: http.StripPrefix("/"+name, server.Handler())}
+	}
+
+	d.mu.Lock()
+	d.databases = databases
+	d.mu.Unlock()
+
+	// No request can start on the databases no longer served, so waiting for
+	// them is safe
+	for name, db := range current {
+		if databases[name] != db {
+			go func() {
+				db.requests.Wait()
+				db.server.Close()
+			}()
+		}
+	}
+	return nil
+}
+
+// Close closes every database of the set
+func (d *databaseSet) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, db := range d.databases {
+		db.server.Close()
+	}
+	d.databases = make(map[string]*mountedDatabase)
+	return nil
+}
+
+// ServeHTTP serves the landing page at / and each database under its name.
+// The routes change on reload, so they are matched here rather than
+// registered on a mux.
+func (d *databaseSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		d.handleLanding(w, r)
+		return
+	}
+	name, _, mounted := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	databases := d.acquire(name)
+	db, ok := databases[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	defer db.requests.Done()
+	if !mounted {
+		target := "/" + name + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+	db.handler.ServeHTTP(w, r)
+}
+
+// acquire returns the databases of the set named names, or all of them when
+// none are given, counting a request on each so a reload doesn't close them
+// until it calls Done. The lock is only held for the lookup, so a slow
+// request doesn't hold up a reload, nor the requests queued behind it.
+func (d *databaseSet) acquire(names ...string) map[string]*mountedDatabase {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	databases := d.databases
+	if len(names) > 0 {
+		databases = make(map[string]*mountedDatabase)
+		for _, name := range names {
+			if db, ok := d.databases[name]; ok {
+				databases[name] = db
+			}
+		}
+	}
+	for _, db := range databases {
+		db.requests.Add(1)
+	}
+	return databases
+}
+
+// handleLanding lists the databases with their number of papers and when
+// they were last fetched. Paths stay private.
+func (d *databaseSet) handleLanding(w http.ResponseWriter, r *http.Request) {
+	p, err := d.auth.principalOf(r)
+	if err != nil || p.Role < roleReader {
+		message := "This needs the reader role"
+		if err != nil {
+			message = err.Error()
+		}
+		d.auth.refuse(w, r, p, message)
+		return
+	}
+
+	type databaseSummary struct {
+		Name    string
+		Papers  int
+		Fetched string
+		Error   string
+	}
+	databases := d.acquire()
+	defer func() {
+		for _, db := range databases {
+			db.requests.Done()
+		}
+	}()
+	var summaries []databaseSummary
+	for _, name := range slices.Sorted(maps.Keys(databases)) {
+		summary := databaseSummary{Name: name}
+		var fetched sql.NullString
+		err := databases[name].server.db.QueryRow("SELECT COUNT(*), MAX(timestamp) FROM paper_cache").Scan(&summary.Papers, &fetched)
+		if err != nil {
+			log.Printf("Error reading database %s: %v", name, err)
+			summary.Error = "Failed to read the database"
+		}
+		if fetched.Valid {
+			summary.Fetched = formatTimestamp(fetched.String)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := d.landing.Execute(w, summaries); err != nil {
+		http.Error(w, "Template execution failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDatabase creates a database the collector has run on, with a paper
+// titled title, and returns its path
+func newTestDatabase(t *testing.T, title string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "papers.db")
+	createSchema(t, path)
+	server, err := NewUIServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	_, err = server.db.Exec(`INSERT INTO paper_cache (url, title, citations, timestamp) VALUES ('http://paper', ?, 10, '2024-03-23 10:00:00')`, title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDatabaseSet(t *testing.T) {
+	graphs, vision := newTestDatabase(t, "Graph Paper"), newTestDatabase(t, "Vision Paper")
+	set := newDatabaseSet(defaultPageSize)
+	defer set.Close()
+	if err := set.load(map[string]string{"graphs": graphs, "vision": vision}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(method, url string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		set.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	// The landing page lists the databases, without their paths
+	w := get("GET", "/")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `href="/graphs/"`) || !strings.Contains(body, `href="/vision/"`) {
+		t.Errorf("Unexpected landing page %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, "Mar 23, 2024 10:00") || strings.Contains(body, graphs) {
+		t.Errorf("Unexpected database summaries: %s", body)
+	}
+
+	// Each database is served under its name, linking within it
+	w = get("GET", "/graphs/")
+	body = w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Graph Paper") || strings.Contains(body, "Vision Paper") {
+		t.Errorf("Unexpected index of graphs %d: %s", w.Code, body)
+	}
+	for _, link := range []string{`href="/graphs/paper/1"`, `src="/graphs/static/js/search.js"`, `href="/graphs/trending"`, `data-base="/graphs"`, `href="/graphs/export.csv?`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("Index of graphs is missing %s", link)
+		}
+	}
+	if strings.Contains(body, "addPaperForm") || strings.Contains(body, "refresh-form") {
+		t.Errorf("Read-only index has write controls")
+	}
+	if w := get("GET", "/vision/api/v1/papers?q=vision"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"count":1`) {
+		t.Errorf("Unexpected API response %d: %s", w.Code, w.Body.String())
+	}
+	if w := get("GET", "/graphs"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/graphs/" {
+		t.Errorf("Expected a redirect to /graphs/, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("GET", "/graphs/new"); !strings.HasPrefix(w.Header().Get("Location"), "/graphs/?") {
+		t.Errorf("Expected a redirect within graphs, got %s", w.Header().Get("Location"))
+	}
+	if w := get("GET", "/other/"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown database, got %d", w.Code)
+	}
+
+	// Nothing can be written to them
+	if w := get("POST", "/graphs/refresh"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a refresh, got %d", w.Code)
+	}
+	if w := get("POST", "/graphs/api/v1/papers"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("Expected a JSON 403 for an added paper, got %d: %s", w.Code, w.Body.String())
+	}
+	set.mu.RLock()
+	server := set.databases["graphs"].server
+	set.mu.RUnlock()
+	if _, err := server.db.Exec("DELETE FROM paper_cache"); err == nil {
+		t.Errorf("Expected the database to be opened read-only")
+	}
+
+	// A reload opens new databases and closes removed ones
+	if err := set.load(map[string]string{"graphs": graphs, "more": vision}); err != nil {
+		t.Fatal(err)
+	}
+	if w := get("GET", "/vision/"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a removed database, got %d", w.Code)
+	}
+	if w := get("GET", "/more/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Vision Paper") {
+		t.Errorf("Unexpected index of an added database %d", w.Code)
+	}
+	set.mu.RLock()
+	kept := set.databases["graphs"].server
+	set.mu.RUnlock()
+	if kept != server {
+		t.Errorf("Expected an unchanged database to stay open")
+	}
+
+	// A list that fails to load leaves the set as it was
+	if err := set.load(map[string]string{"missing": filepath.Join(t.TempDir(), "missing.db")}); err == nil {
+		t.Errorf("Expected an error for a missing database")
+	}
+	if w := get("GET", "/graphs/"); w.Code != http.StatusOK {
+		t.Errorf("Expected graphs to be served after a failed reload, got %d", w.Code)
+	}
+}
+
+func TestDatabaseSetReloadDuringRequest(t *testing.T) {
+	graphs, vision := newTestDatabase(t, "Graph Paper"), newTestDatabase(t, "Vision Paper")
+	set := newDatabaseSet(defaultPageSize)
+	defer set.Close()
+	if err := set.load(map[string]string{"graphs": graphs}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A slow client holds a request to graphs open
+	set.mu.RLock()
+	old := set.databases["graphs"]
+	set.mu.RUnlock()
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := old.handler
+	old.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		handler.ServeHTTP(w, r)
+	})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		set.ServeHTTP(w, httptest.NewRequest("GET", "/graphs/", nil))
+		done <- w
+	}()
+	<-started
+
+	// A reload moving graphs elsewhere neither waits for it nor closes it
+	// under it, and other requests go on
+	if err := set.load(map[string]string{"graphs": vision}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	set.ServeHTTP(w, httptest.NewRequest("GET", "/graphs/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Vision Paper") {
+		t.Errorf("Expected the reloaded database to be served, got %d", w.Code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Graph Paper") {
+		t.Errorf("Expected the slow request to finish on the old database, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Then the old database is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for old.server.db.Ping() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the replaced database to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadOnlyOldSchema(t *testing.T) {
+	// A database of an older collector lacks columns the server reads
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE paper_cache (url TEXT PRIMARY KEY, title TEXT NOT NULL, citations INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewReadOnlyUIServer(path, "/old")
+	if err == nil || !strings.Contains(err.Error(), "run the collector") {
+		t.Errorf("Expected an error asking to run the collector, got %v", err)
+	}
+}
+
+func TestParseDatabases(t *testing.T) {
+	paths, err := parseDatabases(" graphs=graphs.db, vision = /data/vision.db ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatDatabases(paths); got != "graphs=graphs.db,vision=/data/vision.db" {
+		t.Errorf("Unexpected databases %s", got)
+	}
+	for _, value := range []string{"graphs", "graphs=", "Graphs=a.db", "../x=a.db", "a=a.db,a=b.db"} {
+		if _, err := parseDatabases(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// citationSnapshot is a count from citation_history
+type citationSnapshot struct {
+	Source    string
+	Citations int
+	Fetched   time.Time
+}
+
+// sourceCount is the latest count of a paper from one source
+type sourceCount struct {
+	Source    string
+	Citations int
+	Fetched   string
+}
+
+// fetchFailure is the latest failure of a source for a paper, from the
+// collector's fetch_failures
+type fetchFailure struct {
+	Source     string
+	Kind       string
+	Error      string
+	Attempts   int
+	LastFailed string
+}
+
+// Size of the citation chart and the margins around its plot, in pixels
+const (
+	chartWidth  = 640
+	chartHeight = 220
+	chartLeft   = 56
+	chartRight  = 16
+	chartTop    = 12
+	chartBottom = 28
+)
+
+// chartColors are the line colors of the sources in the chart, in turn
+var chartColors = []string{"#2563eb", "#dc2626", "#16a34a", "#9333ea"}
+
+// handlePaper shows a paper with its full abstract, every link, the latest
+// count of each source, a chart of its citation history, the lists it is in,
+// why its last fetches failed and what each user marked it as
+func (s *UIServer) handlePaper(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid paper ID", http.StatusBadRequest)
+		return
+	}
+
+	paper, err := s.getPaper(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Paper not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch paper: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	history, err := s.getCitationHistory(paper.URL)
+	if err != nil {
+		http.Error(w, "Failed to fetch citation history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	failures, err := s.getFetchFailures(paper.URL)
+	if err != nil {
+		http.Error(w, "Failed to fetch failures: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	collections, err := s.getPaperCollections(paper.URL)
+	if err != nil {
+		http.Error(w, "Failed to fetch lists: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := s.requestUser(r)
+	papers := []PaperView{paper}
+	if err := s.annotatePapers(user, papers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	annotations, err := s.getAnnotations(paper.URL)
+	if err != nil {
+		http.Error(w, "Failed to fetch annotations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Paper       PaperView
+		Counts      []sourceCount
+		History     []citationSnapshot
+		Chart       template.HTML
+		Failures    []fetchFailure
+		Collections []paperCollection
+		User        string // who annotates, "" if unknown
+		CanEdit     bool
+		CanAnnotate bool
+		Annotations []Annotation
+	}{
+		Paper:       papers[0],
+		Counts:      latestCounts(history),
+		History:     history,
+		Chart:       citationChart(history),
+		Failures:    failures,
+		Collections: collections,
+		User:        user,
+		CanEdit:     s.canEdit(r),
+		CanAnnotate: s.canAnnotate(r),
+		Annotations: annotations,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := s.tmpl.ExecuteTemplate(w, "paper", data); err != nil {
+		http.Error(w, "Template execution failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// getPaper fetches the paper with the given rowid, or sql.ErrNoRows
+func (s *UIServer) getPaper(id int64) (PaperView, error) {
+	row := s.db.QueryRow(`SELECT `+paperViewColumns+` FROM paper_cache WHERE rowid = ?`, id)
+	return scanPaperView(row)
+}
+
+// getCitationHistory fetches the counts fetched for a paper, oldest first
+func (s *UIServer) getCitationHistory(url string) ([]citationSnapshot, error) {
+	rows, err := s.db.Query(`SELECT source, citations, fetched FROM citation_history WHERE url = ? ORDER BY fetched, rowid`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []citationSnapshot
+	for rows.Next() {
+		var snapshot citationSnapshot
+		if err := rows.Scan(&snapshot.Source, &snapshot.Citations, &snapshot.Fetched); err != nil {
+			return nil, err
+		}
+		history = append(history, snapshot)
+	}
+	return history, rows.Err()
+}
+
+// getFetchFailures fetches the failures of the latest fetches of a paper
+func (s *UIServer) getFetchFailures(url string) ([]fetchFailure, error) {
+	rows, err := s.db.Query(`SELECT source, kind, error, attempts, last_failed FROM fetch_failures WHERE url = ? ORDER BY source`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []fetchFailure
+	for rows.Next() {
+		var failure fetchFailure
+		var lastFailed sql.NullString
+		if err := rows.Scan(&failure.Source, &failure.Kind, &failure.Error, &failure.Attempts, &lastFailed); err != nil {
+			return nil, err
+		}
+		failure.LastFailed = formatTimestamp(lastFailed.String)
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+// latestCounts returns the latest count of each source in a history, by source
+func latestCounts(history []citationSnapshot) []sourceCount {
+	latest := make(map[string]citationSnapshot)
+	for _, snapshot := range history {
+		latest[snapshot.Source] = snapshot
+	}
+	var counts []sourceCount
+	for source, snapshot := range latest {
+		counts = append(counts, sourceCount{
+			Source:    source,
+			Citations: snapshot.Citations,
+			Fetched:   snapshot.Fetched.Format("Jan 02, 2006 15:04"),
+		})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Source < counts[j].Source })
+	return counts
+}
+
+// citationChart draws a citation history as an SVG line chart, a line per
+// source over time from zero to the highest count. It's empty without history.
+func citationChart(history []citationSnapshot) template.HTML {
+	if len(history) == 0 {
+		return ""
+	}
+
+	first, last := history[0].Fetched, history[0].Fetched
+	maxCount := 1
+	var sources []string
+	points := make(map[string][]citationSnapshot)
+	for _, snapshot := range history {
+		if snapshot.Fetched.Before(first) {
+			first = snapshot.Fetched
+		}
+		if snapshot.Fetched.After(last) {
+			last = snapshot.Fetched
+		}
+		maxCount = max(maxCount, snapshot.Citations)
+		if _, ok := points[snapshot.Source]; !ok {
+			sources = append(sources, snapshot.Source)
+		}
+		points[snapshot.Source] = append(points[snapshot.Source], snapshot)
+	}
+
+	plotWidth := float64(chartWidth - chartLeft - chartRight)
+	plotHeight := float64(chartHeight - chartTop - chartBottom)
+	x := func(t time.Time) float64 {
+		// A single fetch time is drawn in the middle
+		if !last.After(first) {
+			return chartLeft + plotWidth/2
+		}
+		return chartLeft + plotWidth*float64(t.Sub(first))/float64(last.Sub(first))
+	}
+	y := func(count int) float64 {
+		return chartTop + plotHeight*(1-float64(count)/float64(maxCount))
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg class="citation-chart" viewBox="0 0 %d %d" width="%d" height="%d" role="img" aria-label="Citations over time">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#d1d5db"/>`, chartLeft, chartTop, chartLeft, chartHeight-chartBottom)
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#d1d5db"/>`, chartLeft, chartHeight-chartBottom, chartWidth-chartRight, chartHeight-chartBottom)
+	fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end" font-size="12" fill="#6b7280">%d</text>`, chartLeft-6, y(maxCount)+4, maxCount)
+	fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end" font-size="12" fill="#6b7280">0</text>`, chartLeft-6, y(0)+4)
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" font-size="12" fill="#6b7280">%s</text>`, chartLeft, chartHeight-8, first.Format("2006-01-02"))
+	if last.After(first) {
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end" font-size="12" fill="#6b7280">%s</text>`, chartWidth-chartRight, chartHeight-8, last.Format("2006-01-02"))
+	}
+
+	for i, source := range sources {
+		color := chartColors[i%len(chartColors)]
+		var line []string
+		for _, snapshot := range points[source] {
+			line = append(line, fmt.Sprintf("%.1f,%.1f", x(snapshot.Fetched), y(snapshot.Citations)))
+		}
+		fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(line, " "), color)
+		for _, snapshot := range points[source] {
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %d citations on %s</title></circle>`,
+				x(snapshot.Fetched), y(snapshot.Citations), color, html.EscapeString(source), snapshot.Citations, snapshot.Fetched.Format("Jan 02, 2006"))
+		}
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlePaper(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, arxiv_abs_url, google_scholar_url, arxiv_summary, authors, code_url, year, timestamp) VALUES
+			('https://arxiv.org/abs/1609.02907', 'Graph Convolutional Networks', 120, 'https://arxiv.org/abs/1609.02907', 'https://scholar.google.com/scholar?cluster=1',
+				'First sentence. The <full> abstract.', 'Thomas N. Kipf, Max Welling', 'https://github.com/tkipf/gcn', 2016, '2024-03-01 10:00:00');
+		INSERT INTO paper_tags (url, tag) VALUES ('https://arxiv.org/abs/1609.02907', 'gnn');
+		INSERT INTO citation_history (url, source, citations, fetched) VALUES
+			('https://arxiv.org/abs/1609.02907', 'scholar', 100, '2024-01-01 10:00:00'),
+			('https://arxiv.org/abs/1609.02907', 'scholar', 120, '2024-03-01 10:00:00');
+		INSERT INTO fetch_failures (url, source, kind, error, attempts) VALUES
+			('https://arxiv.org/abs/1609.02907', 'arxiv', 'rate limited', 'arxiv: status 429', 2);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/paper/"+id, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		server.handlePaper(w, req)
+		return w
+	}
+
+	w := get("1")
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, body)
+	}
+	for _, want := range []string{
+		"Graph Convolutional Networks",
+		"The &lt;full&gt; abstract.",
+		"Thomas N. Kipf, Max Welling · 2016",
+		`<span class="tag text-xs text-gray-600">gnn</span>`,
+		`href="https://github.com/tkipf/gcn"`,
+		`href="https://scholar.google.com/scholar?cluster=1"`,
+		"Last fetched Mar 01, 2024 10:00",
+		`<td class="citation-count pr-4">120</td><td class="text-gray-500">as of Mar 01, 2024 10:00</td>`,
+		`<polyline points="56.0,42.0 624.0,12.0"`,
+		"arxiv: status 429",
+		"2 attempts",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+
+	if w := get("2"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing paper, got %d", w.Code)
+	}
+	if w := get("gcn"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid ID, got %d", w.Code)
+	}
+
+	// The index links to the page
+	req := httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	server.handleIndex(w, req)
+	if !strings.Contains(w.Body.String(), `href="/paper/1"`) {
+		t.Errorf("Expected the index to link to the paper's page")
+	}
+}
+
+func TestCitationChart(t *testing.T) {
+	if chart := citationChart(nil); chart != "" {
+		t.Errorf("Expected no chart without history, got %q", chart)
+	}
+
+	// A single count is drawn in the middle, at the top
+	fetched := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	chart := string(citationChart([]citationSnapshot{{Source: "scholar", Citations: 42, Fetched: fetched}}))
+	if !strings.Contains(chart, `<circle cx="340.0" cy="12.0"`) || !strings.Contains(chart, "scholar: 42 citations on Mar 01, 2024") {
+		t.Errorf("Unexpected chart %s", chart)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// exportLimit bounds the papers in an export
+const exportLimit = 10000
+
+// exportFormats are the content types of the export formats, in the order
+// /export falls back on them
+var exportFormats = []struct {
+	name, contentType string
+}{
+	{"csv", "text/csv"},
+	{"json", "application/json"},
+	{"bib", "application/x-bibtex"},
+	{"md", "text/markdown"},
+}
+
+// handleExport serves the papers of the listing the query parameters select,
+// every page of it, as /export.csv, /export.json, /export.bib or /export.md,
+// or at /export in the format the Accept header asks for
+func (s *UIServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	format, contentType := "", ""
+	if name, ok := strings.CutPrefix(r.URL.Path, "/export."); ok {
+		for _, f := range exportFormats {
+			if f.name == name {
+				format, contentType = f.name, f.contentType
+			}
+		}
+		if format == "" {
+			http.NotFound(w, r)
+			return
+		}
+	} else if format, contentType = negotiateExport(r.Header.Get("Accept")); format == "" {
+		http.Error(w, "Exports are text/csv, application/json, application/x-bibtex or text/markdown", http.StatusNotAcceptable)
+		return
+	}
+
+	query, err := s.parsePaperQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Page, query.PageSize = 1, exportLimit
+	papers, _, err := s.getPapers(query)
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch papers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "papers." + format}))
+	w.Header().Add("Vary", "Accept")
+	if err := exportPapers(w, papers, format); err != nil {
+		log.Printf("Error writing export: %v", err)
+	}
+}
+
+// negotiateExport picks the export format of an Accept header: its first
+// acceptable type an export has, CSV for any type or without a header
+func negotiateExport(accept string) (format, contentType string) {
+	if strings.TrimSpace(accept) == "" {
+		return exportFormats[0].name, exportFormats[0].contentType
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		for _, f := range exportFormats {
+			if mediaType == f.contentType || mediaType == "*/*" || mediaType == strings.Split(f.contentType, "/")[0]+"/*" {
+				return f.name, f.contentType
+			}
+		}
+	}
+	return "", ""
+}
+
+// exportPapers writes papers in an export format. CSV, BibTeX and markdown
+// exports can be imported again.
+func exportPapers(w io.Writer, papers []PaperView, format string) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"title", "url", "citations", "authors", "year", "tags", "code_url", "arxiv_abs_url", "google_scholar_url", "updated", "abstract"})
+		for _, paper := range papers {
+			citations, year := "", ""
+			if paper.HasCitations && !paper.Pending {
+				citations = strconv.Itoa(paper.Citations)
+			}
+			if paper.Year != 0 {
+				year = strconv.Itoa(paper.Year)
+			}
+			cw.Write([]string{paper.Title, paper.URL, citations, paper.Authors, year, strings.Join(paper.Tags, ","), paper.CodeURL,
+				paper.ArxivAbsURL, paper.GoogleScholarURL, exportedUpdate(paper), paper.ArxivSummary})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		type exportedPaper struct {
+			Title            string   `json:"title"`
+			URL              string   `json:"url"`
+			Citations        *int     `json:"citations"`
+			Authors          string   `json:"authors,omitempty"`
+			Year             int      `json:"year,omitempty"`
+			Tags             []string `json:"tags,omitempty"`
+			CodeURL          string   `json:"code_url,omitempty"`
+			ArxivAbsURL      string   `json:"arxiv_abs_url,omitempty"`
+			GoogleScholarURL string   `json:"google_scholar_url,omitempty"`
+			Abstract         string   `json:"abstract,omitempty"`
+			Updated          string   `json:"updated,omitempty"`
+		}
+		out := make([]exportedPaper, 0, len(papers))
+		for _, paper := range papers {
+			exported := exportedPaper{
+				Title:            paper.Title,
+				URL:              paper.URL,
+				Authors:          paper.Authors,
+				Year:             paper.Year,
+				Tags:             paper.Tags,
+				CodeURL:          paper.CodeURL,
+				ArxivAbsURL:      paper.ArxivAbsURL,
+				GoogleScholarURL: paper.GoogleScholarURL,
+				Abstract:         paper.ArxivSummary,
+				Updated:          exportedUpdate(paper),
+			}
+			if paper.HasCitations && !paper.Pending {
+				exported.Citations = &paper.Citations
+			}
+			out = append(out, exported)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "bib":
+		keys := make(map[string]bool)
+		for _, paper := range papers {
+			if _, err := io.WriteString(w, bibTeXEntryOf(paper, keys)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "md":
+		// The collector's list format, so exports can be fetched or imported again
+		for _, paper := range papers {
+			line := fmt.Sprintf("- %s [[paper](%s)]", paper.Title, paper.URL)
+			if paper.CodeURL != "" {
+				line += fmt.Sprintf(" [[code](%s)]", paper.CodeURL)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// exportedUpdate formats when a paper was last fetched like the collector's
+// export does, empty if it wasn't
+func exportedUpdate(paper PaperView) string {
+	t, err := time.Parse("Jan 02, 2006 15:04", paper.LastUpdate)
+	if err != nil {
+		return paper.LastUpdate
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// arxivEprintRegex matches the arXiv ID of an abstract URL
+var arxivEprintRegex = regexp.MustCompile(`arxiv\.org/abs/(.+)$`)
+
+// bibTeXEscaper escapes the characters special to LaTeX in BibTeX values
+var bibTeXEscaper = strings.NewReplacer(`\`, "", "{", "", "}", "", "&", `\&`, "%", `\%`, "#", `\#`, "$", `\$`, "_", `\_`)
+
+// bibTeXEntryOf formats a paper as a @misc BibTeX entry, with a key unique
+// among keys
+func bibTeXEntryOf(paper PaperView, keys map[string]bool) string {
+	base := bibTeXKey(paper)
+	key := base
+	for suffix := 'a'; keys[key]; suffix++ {
+		key = base + string(suffix)
+	}
+	keys[key] = true
+
+	var fields [][2]string
+	field := func(name, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+	field("title", "{"+bibTeXEscaper.Replace(paper.Title)+"}")
+	var authors []string
+	for _, author := range strings.Split(paper.Authors, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			authors = append(authors, bibTeXEscaper.Replace(author))
+		}
+	}
+	field("author", strings.Join(authors, " and "))
+	if paper.Year != 0 {
+		field("year", strconv.Itoa(paper.Year))
+	}
+	if matches := arxivEprintRegex.FindStringSubmatch(paper.URL); matches != nil {
+		field("eprint", matches[1])
+		field("archiveprefix", "arXiv")
+	}
+	field("url", paper.URL)
+	field("keywords", strings.Join(paper.Tags, ", "))
+	if paper.HasCitations && !paper.Pending {
+		field("note", fmt.Sprintf("Cited by %d", paper.Citations))
+	}
+
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "@misc{%s,\n", key)
+	for i, f := range fields {
+		fmt.Fprintf(&entry, "  %s = {%s}", f[0], f[1])
+		if i < len(fields)-1 {
+			entry.WriteString(",")
+		}
+		entry.WriteString("\n")
+	}
+	entry.WriteString("}\n\n")
+	return entry.String()
+}
+
+// keyStopWords are skipped at the start of a title in citation keys
+var keyStopWords = map[string]bool{"a": true, "an": true, "the": true, "on": true, "of": true, "in": true, "to": true, "for": true}
+
+// bibTeXKey makes a citation key of the first author's last name, the year
+// and the first word of the title, like kipf2016semi
+func bibTeXKey(paper PaperView) string {
+	words := func(text string) []string {
+		// Letters beyond ASCII are dropped rather than split words
+		text = strings.Map(func(r rune) rune {
+			if r > unicode.MaxASCII && unicode.IsLetter(r) {
+				return -1
+			}
+			return unicode.ToLower(r)
+		}, text)
+		return strings.FieldsFunc(text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+
+	var key string
+	firstAuthor, _, _ := strings.Cut(paper.Authors, ",")
+	if names := words(firstAuthor); len(names) > 0 {
+		key = names[len(names)-1]
+	}
+	if paper.Year != 0 {
+		key += strconv.Itoa(paper.Year)
+	}
+	for _, word := range words(paper.Title) {
+		if !keyStopWords[word] {
+			key += word
+			break
+		}
+	}
+	if key == "" {
+		key = fmt.Sprintf("paper%d", paper.ID)
+	}
+	return key
+}
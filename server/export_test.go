@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleExport(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, authors, year, code_url, arxiv_summary, timestamp) VALUES
+			('https://arxiv.org/abs/1609.02907', 'Semi-Supervised Classification with Graph Convolutional Networks', 120,
+				'Thomas N. Kipf, Max Welling', 2016, 'https://github.com/tkipf/gcn', 'Graphs.', '2024-03-01 10:00:00'),
+			('https://doi.org/10.1/q&a', 'Q&A over 100% of graphs', 40, 'Ann Other', 2020, NULL, NULL, '2024-03-01 10:00:00'),
+			('http://few', 'Few Citations', 3, NULL, NULL, NULL, NULL, '2024-03-01 10:00:00'),
+			('http://uncounted', 'Uncounted', NULL, NULL, NULL, NULL, NULL, '2024-03-01 10:00:00');
+		INSERT INTO paper_tags (url, tag) VALUES ('https://arxiv.org/abs/1609.02907', 'gnn');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		server.handleExport(w, req)
+		return w
+	}
+
+	// Exports take the filters of the listing, and every page of it
+	w := get("/export.csv?min_citations=10&page=2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=papers.csv` {
+		t.Errorf("Unexpected Content-Disposition %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 || lines[1] != "Semi-Supervised Classification with Graph Convolutional Networks,https://arxiv.org/abs/1609.02907,120,"+
+		`"Thomas N. Kipf, Max Welling",2016,gnn,https://github.com/tkipf/gcn,,,2024-03-01 10:00,Graphs.` {
+		t.Errorf("Unexpected CSV %q", lines)
+	}
+	papers, err := parseCSVList(strings.NewReader(w.Body.String()))
+	if err != nil || len(papers) != 2 || papers[1].URL != "https://doi.org/10.1/q&a" {
+		t.Errorf("Expected the CSV to import again, got %+v, %v", papers, err)
+	}
+
+	w = get("/export.json?tag=gnn", "")
+	var exported []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || exported[0]["citations"] != 120.0 || exported[0]["code_url"] != "https://github.com/tkipf/gcn" {
+		t.Errorf("Unexpected JSON %s", w.Body)
+	}
+
+	w = get("/export.bib?min_citations=10", "")
+	for _, want := range []string{
+		"@misc{kipf2016semi,\n  title = {{Semi-Supervised Classification with Graph Convolutional Networks}},\n  author = {Thomas N. Kipf and Max Welling},\n" +
+			"  year = {2016},\n  eprint = {1609.02907},\n  archiveprefix = {arXiv},\n  url = {https://arxiv.org/abs/1609.02907},\n  keywords = {gnn},\n  note = {Cited by 120}\n}",
+		"@misc{other2020q,\n  title = {{Q\\&A over 100\\% of graphs}},",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected the BibTeX to contain %q, got %s", want, w.Body)
+		}
+	}
+	papers, err = parseBibTeXList(strings.NewReader(w.Body.String()))
+	if err != nil || len(papers) != 2 || papers[1].Title != "Q&A over 100% of graphs" || papers[0].Tags[0] != "gnn" {
+		t.Errorf("Expected the BibTeX to import again, got %+v, %v", papers, err)
+	}
+
+	w = get("/export.md?q=graph&sort=title", "")
+	if got := w.Body.String(); got != "- Q&A over 100% of graphs [[paper](https://doi.org/10.1/q&a)]\n"+
+		"- Semi-Supervised Classification with Graph Convolutional Networks [[paper](https://arxiv.org/abs/1609.02907)] [[code](https://github.com/tkipf/gcn)]\n" {
+		t.Errorf("Unexpected markdown %q", got)
+	}
+
+	// A fetched paper no source gave citations for has none, rather than 0
+	if lines := strings.Split(strings.TrimSpace(get("/export.csv?missing=citations", "").Body.String()), "\n"); len(lines) != 2 || lines[1] != "Uncounted,http://uncounted,,,,,,,,2024-03-01 10:00," {
+		t.Errorf("Unexpected CSV without citations %q", lines)
+	}
+	w = get("/export.json?missing=citations", "")
+	exported = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if citations, ok := exported[0]["citations"]; len(exported) != 1 || !ok || citations != nil {
+		t.Errorf("Expected null citations in the JSON, got %s", w.Body)
+	}
+	if w := get("/export.bib?missing=citations", ""); !strings.Contains(w.Body.String(), "Uncounted") || strings.Contains(w.Body.String(), "note") {
+		t.Errorf("Expected no citation note in the BibTeX, got %s", w.Body)
+	}
+
+	// /export picks the format of the Accept header
+	for accept, want := range map[string]string{
+		"":                                  "text/csv; charset=utf-8",
+		"application/x-bibtex":              "application/x-bibtex; charset=utf-8",
+		"text/html;q=0.9, application/json": "application/json; charset=utf-8",
+		"text/*":                            "text/csv; charset=utf-8",
+		"text/csv;q=0, text/markdown":       "text/markdown; charset=utf-8",
+	} {
+		if got := get("/export", accept).Header().Get("Content-Type"); got != want {
+			t.Errorf("Accept %q: expected %q, got %q", accept, want, got)
+		}
+	}
+	if w := get("/export", "image/png"); w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406 for an image, got %d", w.Code)
+	}
+	if w := get("/export.csv?sort=popularity", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid query, got %d", w.Code)
+	}
+}
+
+func TestBibTeXKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, test := range []struct {
+		paper PaperView
+		want  string
+	}{
+		{PaperView{Title: "Attention Is All You Need", Authors: "Ashish Vaswani, Noam Shazeer", Year: 2017}, "vaswani2017attention"},
+		{PaperView{Title: "Attention, again", Authors: "A. Vaswani", Year: 2017}, "vaswani2017attentiona"},
+		{PaperView{Title: "The Müller Method", Authors: "Jörg Müller"}, "mllermller"},
+		{PaperView{ID: 7, Title: "?"}, "paper7"},
+	} {
+		entry := bibTeXEntryOf(test.paper, keys)
+		if key := strings.TrimSuffix(strings.SplitN(entry, "\n", 2)[0], ","); key != "@misc{"+test.want {
+			t.Errorf("Expected key %s for %q, got %s", test.want, test.paper.Title, key)
+		}
+	}
+}
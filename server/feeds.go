@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// feedSize is the number of entries in a feed
+const feedSize = 50
+
+// atomFeed is an Atom feed (RFC 4287)
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry is an entry of an Atom feed
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// feedPaper is a paper in a feed with the count its entry reports: the first
+// count fetched for new papers, the latest for trending ones
+type feedPaper struct {
+	PaperView
+	Added   time.Time
+	Count   *int      // nil before the first fetch
+	Counted time.Time // when Count was fetched
+}
+
+// handleNewFeed serves the papers added last as an Atom feed
+func (s *UIServer) handleNewFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, "", "", "New papers")
+}
+
+// handleTrendingFeed serves the papers gaining the most citations over the
+// last 30 days as an Atom feed
+func (s *UIServer) handleTrendingFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, trendingSorts[0], "", "Trending papers")
+}
+
+// handleTagFeed serves the papers added last with a tag as an Atom feed, at
+// /feeds/tags/{tag}.atom
+func (s *UIServer) handleTagFeed(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".atom")
+	tags, err := normalizeTags([]string{name})
+	if !ok || err != nil || len(tags) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveFeed(w, r, "", tags[0], "New papers tagged "+tags[0])
+}
+
+// serveFeed writes the papers matching the request's filters, and the tag if
+// any, as an Atom feed: the papers added last, or those gaining the most over
+// a gain sort
+func (s *UIServer) serveFeed(w http.ResponseWriter, r *http.Request, gain, tag, title string) {
+	query, err := s.parsePaperQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tag != "" {
+		query.Tag = tag
+	}
+	papers, err := s.getFeedPapers(query, gain)
+	if err != nil {
+		http.Error(w, "Failed to fetch papers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	base := s.baseURL(r) + s.base
+	self := base + r.URL.RequestURI()
+	feed := atomFeed{
+		Title:   title + " - Most Cited Papers",
+		ID:      self,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: "Most Cited Papers"},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: base + "/"},
+		},
+	}
+	for i, paper := range papers {
+		entry := feedEntry(base, paper, gain != "")
+		if i == 0 || entry.Updated > feed.Updated {
+			feed.Updated = entry.Updated
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		log.Printf("Error writing feed: %v", err)
+	}
+}
+
+// feedEntry makes the entry of a paper. A trending entry is new each time
+// the paper's count is fetched, so movers show up again as they keep moving.
+func feedEntry(base string, paper feedPaper, trending bool) atomEntry {
+	published := paper.Added
+	if trending && paper.Count != nil {
+		published = paper.Counted
+	}
+	entry := atomEntry{
+		Title:     paper.Title,
+		ID:        paper.URL,
+		Published: published.UTC().Format(time.RFC3339),
+		Updated:   published.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "alternate", Type: "text/html", Href: fmt.Sprintf("%s/paper/%d", base, paper.ID)},
+			{Rel: "related", Href: paper.URL},
+		},
+	}
+	if trending {
+		entry.ID += "#trending-" + published.UTC().Format("2006-01-02")
+	}
+	for _, author := range strings.Split(paper.Authors, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			entry.Authors = append(entry.Authors, atomPerson{Name: author})
+		}
+	}
+	for _, tag := range paper.Tags {
+		entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+	}
+
+	var summary []string
+	if paper.FirstSentence != "" {
+		summary = append(summary, paper.FirstSentence)
+	}
+	switch {
+	case paper.Count == nil:
+		summary = append(summary, "Citations not fetched yet.")
+	case trending:
+		summary = append(summary, fmt.Sprintf("%d citations as of %s, %s in 30 days.",
+			*paper.Count, paper.Counted.Format("Jan 02, 2006"), formatGain(paper.Gain30)))
+	default:
+		summary = append(summary, fmt.Sprintf("%d citations as of %s.", *paper.Count, paper.Counted.Format("Jan 02, 2006")))
+	}
+	entry.Summary = strings.Join(summary, " ")
+	return entry
+}
+
+// getFeedPapers fetches the papers of a feed matching the query's filters:
+// those added last with their first count or, with a gain sort, those
+// gaining the most with their latest count
+func (s *UIServer) getFeedPapers(q PaperQuery, gain string) ([]feedPaper, error) {
+	var search paperSearch
+	q.addFilters(&search)
+
+	order, history := `paper_cache.added DESC`, `h.fetched`
+	if gain != "" {
+		column := paperSorts[gain].column
+		search.add(column + ` > 0`)
+		order, history = column+` DESC`, `h.fetched DESC`
+	}
+	where := ""
+	if len(search.conditions) > 0 {
+		where = ` WHERE ` + strings.Join(search.conditions, " AND ")
+	}
+
+	snapshot := func(column string) string {
+		return `(SELECT ` + column + ` FROM citation_history h WHERE h.url = paper_cache.url ORDER BY ` + history + ` LIMIT 1)`
+	}
+	rows, err := s.db.Query(`SELECT `+paperViewColumns+`, paper_cache.added, `+snapshot("h.citations")+`, `+snapshot("h.fetched")+`
+		FROM paper_cache`+where+` ORDER BY `+order+`, paper_cache.rowid DESC LIMIT ?`, append(search.args, feedSize)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var papers []feedPaper
+	for rows.Next() {
+		var paper feedPaper
+		var added sql.NullTime
+		var count sql.NullInt64
+		var counted sql.NullString
+		paper.PaperView, err = scanPaperView(rows, &added, &count, &counted)
+		if err != nil {
+			return nil, err
+		}
+		paper.Added, paper.Count = added.Time, nullInt(count)
+		paper.Counted, _ = parseTimestamp(counted.String)
+		papers = append(papers, paper)
+	}
+	return papers, rows.Err()
+}
+
+// baseURL is the scheme and host of absolute links: the public URL when it
+// is configured, else those the request was made to. Behind a proxy the
+// request doesn't have them, and any client can set its Host header.
+func (s *UIServer) baseURL(r *http.Request) string {
+	if s.publicURL != "" {
+		return s.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// parsePublicURL checks the URL the server is reached at, like
+// https://papers.example.com, and returns it without a trailing slash
+func parsePublicURL(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%q is not an http or https URL", value)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
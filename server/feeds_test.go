@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeeds(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	old := time.Now().UTC().AddDate(0, 0, -40).Format(time.DateTime)
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, authors, arxiv_summary, added) VALUES
+			('http://gcn', 'GCN', 150, 'Thomas N. Kipf, Max Welling', 'Graphs. More.', '2024-01-01 10:00:00'),
+			('http://rag', 'RAG', 40, NULL, 'Retrieval. More.', '2024-02-01 10:00:00'),
+			('http://new', 'Pending', NULL, NULL, NULL, '2024-03-01 10:00:00');
+		INSERT INTO paper_tags (url, tag) VALUES ('http://rag', 'rag');
+		INSERT INTO citation_history (url, source, citations, fetched) VALUES
+			('http://gcn', 'scholar', 100, ?),
+			('http://gcn', 'scholar', 150, '2030-01-02 03:04:05'),
+			('http://rag', 'scholar', 40, ?);
+	`, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string, handler http.HandlerFunc) atomFeed {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		req.SetPathValue("file", "rag.atom")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", target, w.Code, w.Body)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/atom+xml; charset=utf-8" {
+			t.Errorf("%s: unexpected content type %q", target, got)
+		}
+		var feed atomFeed
+		if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("%s: invalid feed: %v", target, err)
+		}
+		return feed
+	}
+
+	// New papers come newest first, with their first count
+	feed := get("/feeds/new.atom", server.handleNewFeed)
+	if len(feed.Entries) != 3 || feed.Entries[0].Title != "Pending" || feed.Entries[2].Title != "GCN" {
+		t.Fatalf("Unexpected entries %+v", feed.Entries)
+	}
+	gcn := feed.Entries[2]
+	if gcn.ID != "http://gcn" || gcn.Published != "2024-01-01T10:00:00Z" || gcn.Summary != "Graphs. 100 citations as of "+time.Now().UTC().AddDate(0, 0, -40).Format("Jan 02, 2006")+"." {
+		t.Errorf("Unexpected entry %+v", gcn)
+	}
+	if len(gcn.Authors) != 2 || gcn.Authors[1].Name != "Max Welling" || gcn.Links[0].Href != "http://example.com/paper/1" {
+		t.Errorf("Unexpected authors or links %+v", gcn)
+	}
+	if feed.Entries[0].Summary != "Citations not fetched yet." {
+		t.Errorf("Unexpected summary %q of a pending paper", feed.Entries[0].Summary)
+	}
+	if feed.Updated != "2024-03-01T10:00:00Z" {
+		t.Errorf("Expected the feed updated with its newest entry, got %s", feed.Updated)
+	}
+
+	// Trending papers have gained citations, with their latest count
+	feed = get("/feeds/trending.atom", server.handleTrendingFeed)
+	if len(feed.Entries) != 1 {
+		t.Fatalf("Expected only GCN trending, got %+v", feed.Entries)
+	}
+	if entry := feed.Entries[0]; entry.ID != "http://gcn#trending-2030-01-02" || entry.Summary != "Graphs. 150 citations as of Jan 02, 2030, +50 in 30 days." {
+		t.Errorf("Unexpected trending entry %+v", entry)
+	}
+
+	// Tag feeds only have papers with the tag
+	feed = get("/feeds/tags/rag.atom", server.handleTagFeed)
+	if len(feed.Entries) != 1 || feed.Entries[0].Title != "RAG" || feed.Entries[0].Categories[0].Term != "rag" {
+		t.Errorf("Unexpected tag feed entries %+v", feed.Entries)
+	}
+
+	req := httptest.NewRequest("GET", "/feeds/tags/rag", nil)
+	req.SetPathValue("file", "rag")
+	w := httptest.NewRecorder()
+	server.handleTagFeed(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without .atom, got %d", w.Code)
+	}
+
+	// Links don't follow the forwarding headers clients send
+	req = httptest.NewRequest("GET", "/feeds/new.atom", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if got := server.baseURL(req); got != "http://example.com" {
+		t.Errorf("Expected the request's scheme and host, got %s", got)
+	}
+	server.publicURL = "https://papers.example.org/team"
+	feed = get("/feeds/new.atom", server.handleNewFeed)
+	if feed.Entries[2].Links[0].Href != "https://papers.example.org/team/paper/1" {
+		t.Errorf("Expected links under the public URL, got %+v", feed.Entries[2].Links)
+	}
+}
+
+func TestParsePublicURL(t *testing.T) {
+	if got, err := parsePublicURL("https://papers.example.org/"); err != nil || got != "https://papers.example.org" {
+		t.Errorf("parsePublicURL = %q, %v", got, err)
+	}
+	for _, value := range []string{"papers.example.org", "ftp://papers.example.org", "https://papers.example.org/?q=1"} {
+		if _, err := parsePublicURL(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
@@ -2,4 +2,9 @@ module github.com/sent-hil/most-cited-papers/server
 
 go 1.24.1
 
-require github.com/mattn/go-sqlite3 v1.14.24
+require (
+	github.com/mattn/go-sqlite3 v1.14.24
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/crypto v0.33.0
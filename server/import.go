@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxImportSize bounds the size of an uploaded list
+const maxImportSize = 10 << 20
+
+// ImportError is an entry of an uploaded list that couldn't be added
+type ImportError struct {
+	Entry string `json:"entry"` // where the entry is, e.g. "line 3"
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error"`
+}
+
+// importedPaper is a paper read from an uploaded list
+type importedPaper struct {
+	NewPaper
+	entry string
+}
+
+// markdownPaperRegex matches the collector's list format: "- Title [[paper](url)]"
+var markdownPaperRegex = regexp.MustCompile(`-\s+([^\[]+)\[\[paper\]\(([^)]+)\)`)
+
+// parseMarkdownList reads papers in the collector's markdown list format
+func parseMarkdownList(r io.Reader) ([]importedPaper, error) {
+	var papers []importedPaper
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		matches := markdownPaperRegex.FindStringSubmatch(scanner.Text())
+		if matches == nil {
+			continue
+		}
+		papers = append(papers, importedPaper{
+			NewPaper: NewPaper{Title: strings.TrimSpace(matches[1]), URL: strings.TrimSpace(matches[2])},
+			entry:    fmt.Sprintf("line %d", line),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading markdown: %v", err)
+	}
+	return papers, nil
+}
+
+// parseCSVList reads papers from CSV with a header row. The url column is
+// required; title and tags (separated by ',' or ';') are optional, and other
+// columns, like those of the collector's CSV export, are ignored.
+func parseCSVList(r io.Reader) ([]importedPaper, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("CSV has no url column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var papers []importedPaper
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		papers = append(papers, importedPaper{
+			NewPaper: NewPaper{
+				URL:   field(record, "url"),
+				Title: field(record, "title"),
+				Tags:  splitTags(field(record, "tags")),
+			},
+			entry: fmt.Sprintf("line %d", line),
+		})
+	}
+	return papers, nil
+}
+
+// parseBibTeXList reads papers from BibTeX entries. The URL comes from the
+// url field, an arXiv eprint or the doi, in that order; keywords become tags.
+func parseBibTeXList(r io.Reader) ([]importedPaper, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading BibTeX: %v", err)
+	}
+
+	var papers []importedPaper
+	for _, entry := range splitBibTeXEntries(string(data)) {
+		fields := entry.fields
+		paper := importedPaper{
+			NewPaper: NewPaper{Title: fields["title"], Tags: splitTags(fields["keywords"])},
+			entry:    "entry " + entry.key,
+		}
+		switch {
+		case fields["url"] != "":
+			paper.URL = fields["url"]
+		case fields["eprint"] != "" && (strings.EqualFold(fields["archiveprefix"], "arxiv") || strings.EqualFold(fields["eprinttype"], "arxiv")):
+			paper.URL = "arXiv:" + fields["eprint"]
+		case fields["doi"] != "":
+			paper.URL = "doi:" + fields["doi"]
+		}
+		papers = append(papers, paper)
+	}
+	return papers, nil
+}
+
+// bibTeXEntry is an entry of a BibTeX file, with lowercase field names
+type bibTeXEntry struct {
+	key    string
+	fields map[string]string
+}
+
+// splitBibTeXEntries parses the entries of a BibTeX file, skipping @comment,
+// @string and @preamble. Braces and quotes around values are removed.
+func splitBibTeXEntries(text string) []bibTeXEntry {
+	var entries []bibTeXEntry
+	for {
+		at := strings.IndexByte(text, '@')
+		if at < 0 {
+			return entries
+		}
+		text = text[at+1:]
+		open := strings.IndexAny(text, "{(")
+		if open < 0 {
+			return entries
+		}
+		kind := strings.ToLower(strings.TrimSpace(text[:open]))
+		body, rest := matchBraces(text[open:])
+		text = rest
+		if kind == "comment" || kind == "string" || kind == "preamble" {
+			continue
+		}
+
+		key, fieldList, _ := strings.Cut(body, ",")
+		entry := bibTeXEntry{key: strings.TrimSpace(key), fields: make(map[string]string)}
+		for _, field := range splitBibTeXFields(fieldList) {
+			name, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			entry.fields[strings.ToLower(strings.TrimSpace(name))] = cleanBibTeXValue(value)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// matchBraces returns the text inside the brace or parenthesis that s starts
+// with, and the text after the matching one
+func matchBraces(s string) (string, string) {
+	closing := byte('}')
+	if s[0] == '(' {
+		closing = ')'
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case s[0], '{':
+			depth++
+		case closing, '}':
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:]
+			}
+		}
+	}
+	return s[1:], ""
+}
+
+// splitBibTeXFields splits "a = {x, y}, b = 2" at the commas outside braces and quotes
+func splitBibTeXFields(s string) []string {
+	var fields []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			if depth == 0 {
+				quoted = !quoted
+			}
+		case ',':
+			if depth == 0 && !quoted {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// cleanBibTeXValue removes the braces and quotes around a value, and those
+// protecting capitalization inside it
+func cleanBibTeXValue(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.NewReplacer("{", "", "}", "", `\&`, "&", `\%`, "%", `\#`, "#", `\$`, "$", `\_`, "_").Replace(value)
+	value = strings.Trim(value, `"`)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// importFormat returns the format of an uploaded list: the format parameter,
+// else the file extension, else the content type
+func importFormat(r *http.Request, filename string) (string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		switch strings.ToLower(path.Ext(filename)) {
+		case ".md", ".markdown":
+			format = "md"
+		case ".bib", ".bibtex":
+			format = "bib"
+		case ".csv":
+			format = "csv"
+		}
+	}
+	if format == "" {
+		contentType := r.Header.Get("Content-Type")
+		switch {
+		case strings.HasPrefix(contentType, "text/markdown"):
+			format = "md"
+		case strings.HasPrefix(contentType, "application/x-bibtex"), strings.HasPrefix(contentType, "text/x-bibtex"):
+			format = "bib"
+		case strings.HasPrefix(contentType, "text/csv"):
+			format = "csv"
+		}
+	}
+
+	switch format {
+	case "md", "markdown":
+		return "md", nil
+	case "bib", "bibtex":
+		return "bib", nil
+	case "csv":
+		return "csv", nil
+	case "":
+		return "", errors.New("unknown format, pass format=md, bib or csv")
+	default:
+		return "", fmt.Errorf("unknown format %q, expected md, bib or csv", format)
+	}
+}
+
+// handleImportAPI adds every paper of an uploaded markdown, BibTeX or CSV
+// list, sent as the request body or as the "file" field of a multipart form.
+// Papers already stored are reported as duplicates and invalid entries as
+// errors; the rest are queued for fetching in a single job.
+func (s *UIServer) handleImportAPI(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var body io.Reader = r.Body
+	var filename string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Failed to read upload: "+err.Error())
+			return
+		}
+		defer file.Close()
+		body, filename = file, header.Filename
+	}
+
+	format, err := importFormat(r, filename)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var imported []importedPaper
+	switch format {
+	case "md":
+		imported, err = parseMarkdownList(body)
+	case "bib":
+		imported, err = parseBibTeXList(body)
+	case "csv":
+		imported, err = parseCSVList(body)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := struct {
+		Added      []NewPaper    `json:"added"`
+		Duplicates []string      `json:"duplicates"`
+		Errors     []ImportError `json:"errors"`
+		Job        *Job          `json:"job"` // nil when nothing was added or the queue is full
+	}{Added: []NewPaper{}, Duplicates: []string{}, Errors: []ImportError{}}
+
+	var valid []NewPaper
+	seen := make(map[string]bool)
+	for _, paper := range imported {
+		if err := paper.validate(); err != nil {
+			response.Errors = append(response.Errors, ImportError{Entry: paper.entry, URL: paper.URL, Error: err.Error()})
+			continue
+		}
+		if seen[paper.URL] {
+			response.Duplicates = append(response.Duplicates, paper.URL)
+			continue
+		}
+		seen[paper.URL] = true
+		valid = append(valid, paper.NewPaper)
+	}
+
+	results, err := s.insertPapers(valid)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "Failed to add papers: "+err.Error())
+		return
+	}
+	for i, paper := range valid {
+		if results[i] != nil {
+			response.Duplicates = append(response.Duplicates, paper.URL)
+			continue
+		}
+		response.Added = append(response.Added, paper)
+	}
+
+	if len(response.Added) > 0 {
+		if job, err := s.jobs.enqueue(Job{Pending: true}); err == nil {
+			response.Job = &job
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseLists(t *testing.T) {
+	markdown := `# Papers
+
+- Attention Is All You Need [[paper](https://arxiv.org/abs/1706.03762)]
+Not a paper line
+- Graph Papers [[paper](https://arxiv.org/pdf/2311.09862)]
+`
+	csvList := "Title,URL,Citations,Tags\n" +
+		"\"Attention, Again\",https://arxiv.org/abs/1706.03762,100,nlp;transformers\n" +
+		"Short,https://example.com/short\n"
+	bibtex := `@comment{exported by a reference manager}
+@article{vaswani2017,
+  title = {Attention Is {All} You Need},
+  author = "Vaswani, Ashish and others",
+  eprint = {1706.03762},
+  archivePrefix = {arXiv},
+  keywords = {nlp, transformers}
+}
+@inproceedings(ying2019,
+  title = "{GNNExplainer}: Generating Explanations",
+  doi = {10.5555/3454287.3455116},
+  year = 2019
+)
+@misc{site, title={A Site}, url={https://example.com/site}}
+`
+
+	tests := []struct {
+		name  string
+		parse func(*strings.Reader) ([]importedPaper, error)
+		input string
+		want  []NewPaper
+	}{
+		{"markdown", func(r *strings.Reader) ([]importedPaper, error) { return parseMarkdownList(r) }, markdown, []NewPaper{
+			{URL: "https://arxiv.org/abs/1706.03762", Title: "Attention Is All You Need"},
+			{URL: "https://arxiv.org/pdf/2311.09862", Title: "Graph Papers"},
+		}},
+		{"csv", func(r *strings.Reader) ([]importedPaper, error) { return parseCSVList(r) }, csvList, []NewPaper{
+			{URL: "https://arxiv.org/abs/1706.03762", Title: "Attention, Again", Tags: []string{"nlp", "transformers"}},
+			{URL: "https://example.com/short", Title: "Short"},
+		}},
+		{"bibtex", func(r *strings.Reader) ([]importedPaper, error) { return parseBibTeXList(r) }, bibtex, []NewPaper{
+			{URL: "arXiv:1706.03762", Title: "Attention Is All You Need", Tags: []string{"nlp", "transformers"}},
+			{URL: "doi:10.5555/3454287.3455116", Title: "GNNExplainer: Generating Explanations"},
+			{URL: "https://example.com/site", Title: "A Site"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			papers, err := tt.parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if len(papers) != len(tt.want) {
+				t.Fatalf("Expected %d papers, got %d: %+v", len(tt.want), len(papers), papers)
+			}
+			for i, paper := range papers {
+				want := tt.want[i]
+				if paper.URL != want.URL || paper.Title != want.Title || strings.Join(paper.Tags, "|") != strings.Join(want.Tags, "|") {
+					t.Errorf("Paper %d = %+v; want %+v", i, paper.NewPaper, want)
+				}
+			}
+		})
+	}
+
+	if _, err := parseCSVList(strings.NewReader("title\nNo URL\n")); err == nil {
+		t.Error("Expected an error for CSV without a url column")
+	}
+}
+
+func TestImportAPI(t *testing.T) {
+	server, ran := newTestServer(t)
+
+	if _, err := server.insertPapers([]NewPaper{{URL: "https://arxiv.org/abs/1706.03762", Title: "Existing"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload as a multipart form, the format coming from the file name
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "papers.md")
+	file.Write([]byte(`- Attention [[paper](https://arxiv.org/pdf/1706.03762)]
+- Graph Papers [[paper](https://arxiv.org/pdf/2311.09862)]
+- Graph Papers Again [[paper](arXiv:2311.09862v2)]
+- Untitled [[paper](ftp://example.com/paper)]
+`))
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/papers/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	server.handleImportAPI(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d: %s", w.Code, w.Body)
+	}
+
+	var response struct {
+		Added      []NewPaper    `json:"added"`
+		Duplicates []string      `json:"duplicates"`
+		Errors     []ImportError `json:"errors"`
+		Job        *Job          `json:"job"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Added) != 1 || response.Added[0].URL != "https://arxiv.org/abs/2311.09862" {
+		t.Errorf("Unexpected added papers %+v", response.Added)
+	}
+	if len(response.Duplicates) != 2 {
+		t.Errorf("Expected 2 duplicates, got %v", response.Duplicates)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Entry != "line 4" {
+		t.Errorf("Unexpected errors %+v", response.Errors)
+	}
+	if response.Job == nil || !response.Job.Pending {
+		t.Errorf("Expected a job for the pending papers, got %+v", response.Job)
+	}
+	if job := <-ran; !job.Pending {
+		t.Errorf("Expected the pending papers to be refreshed, got %+v", job)
+	}
+
+	// A raw body needs the format
+	req = httptest.NewRequest("POST", "/api/papers/import", strings.NewReader("url\n2311.09862\n"))
+	w = httptest.NewRecorder()
+	server.handleImportAPI(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a format; got %d", w.Code)
+	}
+	req = httptest.NewRequest("POST", "/api/papers/import?format=csv", strings.NewReader("url\n2311.09862\n"))
+	w = httptest.NewRecorder()
+	server.handleImportAPI(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicates":["https://arxiv.org/abs/2311.09862"]`) {
+		t.Errorf("Expected the paper to be a duplicate, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// maxJobs is how many jobs are kept for status requests, oldest dropped first
+const maxJobs = 100
+
+// Job is a refresh of one paper, of the papers added but not fetched yet
+// when Pending is set, or of every paper
+type Job struct {
+	ID       string          `json:"id"`
+	URL      string          `json:"url,omitempty"`
+	Pending  bool            `json:"pending,omitempty"`
+	Status   string          `json:"status"`
+	Created  time.Time       `json:"created"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Report   json.RawMessage `json:"report,omitempty"` // the collector's run report
+}
+
+// jobRunner runs a job and returns the collector's report
+type jobRunner func(ctx context.Context, job Job) (json.RawMessage, error)
+
+// jobQueue runs refresh jobs one at a time in the background, so that
+// concurrent requests don't multiply the load on Google Scholar
+type jobQueue struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []string // job IDs, oldest first
+	nextID int
+	queue  chan *Job
+	run    jobRunner
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newJobQueue starts a queue that runs jobs with run until it is closed
+func newJobQueue(run jobRunner) *jobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &jobQueue{
+		jobs:   make(map[string]*Job),
+		queue:  make(chan *Job, maxJobs),
+		run:    run,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go q.work(ctx)
+	return q
+}
+
+// enqueue adds a refresh of the papers target selects with its URL and
+// Pending fields. A job for the same papers that hasn't started yet is
+// returned instead of a new one.
+func (q *jobQueue) enqueue(target Job) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, id := range q.order {
+		if job := q.jobs[id]; job.Status == jobQueued && job.URL == target.URL && job.Pending == target.Pending {
+			return *job, nil
+		}
+	}
+
+	q.nextID++
+	job := &Job{
+		ID:      strconv.Itoa(q.nextID),
+		URL:     target.URL,
+		Pending: target.Pending,
+		Status:  jobQueued,
+		Created: time.Now(),
+	}
+	select {
+	case q.queue <- job:
+	default:
+		return Job{}, errors.New("too many queued jobs")
+	}
+
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.prune()
+	return *job, nil
+}
+
+// prune drops the oldest finished jobs over maxJobs
+func (q *jobQueue) prune() {
+	for i := 0; len(q.order) > maxJobs && i < len(q.order); {
+		id := q.order[i]
+		if status := q.jobs[id].Status; status == jobSucceeded || status == jobFailed {
+			delete(q.jobs, id)
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// get returns a copy of the job with the given ID
+func (q *jobQueue) get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// work runs queued jobs until ctx is cancelled
+func (q *jobQueue) work(ctx context.Context) {
+	defer close(q.done)
+	for {
+		select {
+		case job := <-q.queue:
+			q.runJob(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runJob runs job and records its outcome
+func (q *jobQueue) runJob(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	started := time.Now()
+	job.Status = jobRunning
+	job.Started = &started
+	snapshot := *job
+	q.mu.Unlock()
+
+	log.Printf("Starting job %s (%s)", job.ID, jobTarget(snapshot))
+	report, err := q.run(ctx, snapshot)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	finished := time.Now()
+	job.Finished = &finished
+	job.Report = report
+	if err != nil {
+		job.Status = jobFailed
+		job.Error = err.Error()
+		log.Printf("Job %s failed: %v", job.ID, err)
+		return
+	}
+	job.Status = jobSucceeded
+	log.Printf("Job %s finished in %s", job.ID, finished.Sub(started).Round(time.Millisecond))
+}
+
+// close stops the queue, killing the running job
+func (q *jobQueue) close() {
+	q.cancel()
+	<-q.done
+}
+
+// jobTarget describes the papers a job refreshes
+func jobTarget(job Job) string {
+	switch {
+	case job.URL != "":
+		return job.URL
+	case job.Pending:
+		return "pending papers"
+	default:
+		return "all papers"
+	}
+}
+
+// runCollector runs the collector's refresh command for job against the
+// server's database and returns its report
+func (s *UIServer) runCollector(ctx context.Context, job Job) (json.RawMessage, error) {
+	fields := strings.Fields(s.collector)
+	if len(fields) == 0 {
+		return nil, errors.New("no collector command configured")
+	}
+
+	reportFile, err := os.CreateTemp("", "refresh-report-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report file: %v", err)
+	}
+	reportFile.Close()
+	defer os.Remove(reportFile.Name())
+
+	args := append(fields[1:], "refresh", "-db", s.dbFilePath, "-report", reportFile.Name())
+	switch {
+	case job.URL != "":
+		// A URL starting with - mustn't be taken for a flag
+		args = append(args, "--", job.URL)
+	case job.Pending:
+		args = append(args, "-pending")
+	default:
+		args = append(args, "-all")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, fields[0], args...)
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var report json.RawMessage
+	if data, err := os.ReadFile(reportFile.Name()); err == nil && len(bytes.TrimSpace(data)) > 0 {
+		report = data
+	}
+	if runErr != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return report, fmt.Errorf("collector failed: %v: %s", runErr, line)
+		}
+		return report, fmt.Errorf("collector failed: %v", runErr)
+	}
+	return report, nil
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForJob polls the queue until the job finishes
+func waitForJob(t *testing.T, q *jobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := q.get(id)
+		if !ok {
+			t.Fatalf("Job %s not found", id)
+		}
+		if job.Status == jobSucceeded || job.Status == jobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s didn't finish", id)
+	return Job{}
+}
+
+func TestJobQueue(t *testing.T) {
+	release := make(chan struct{})
+	q := newJobQueue(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		<-release
+		if job.URL == "http://fail.com" {
+			return nil, errors.New("collector failed")
+		}
+		return json.RawMessage(`{"fetched":1}`), nil
+	})
+	defer q.close()
+
+	first, _ := q.enqueue(Job{URL: "http://test1.com"})
+	// Wait for the first job to start so the next ones stay queued
+	for job, _ := q.get(first.ID); job.Status != jobRunning; job, _ = q.get(first.ID) {
+		time.Sleep(time.Millisecond)
+	}
+	all, _ := q.enqueue(Job{})
+	again, _ := q.enqueue(Job{})
+	pending, _ := q.enqueue(Job{Pending: true})
+	failing, _ := q.enqueue(Job{URL: "http://fail.com"})
+	if again.ID != all.ID {
+		t.Errorf("Expected the queued job %s to be reused, got %s", all.ID, again.ID)
+	}
+	if pending.ID == all.ID {
+		t.Error("Expected a separate job for pending papers")
+	}
+	close(release)
+
+	if job := waitForJob(t, q, first.ID); job.Status != jobSucceeded || string(job.Report) != `{"fetched":1}` {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if job := waitForJob(t, q, all.ID); job.Status != jobSucceeded || job.Started == nil || job.Finished == nil {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if job := waitForJob(t, q, failing.ID); job.Status != jobFailed || job.Error != "collector failed" {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if _, ok := q.get("404"); ok {
+		t.Error("Expected no job 404")
+	}
+}
+
+func TestRefreshAPI(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	server, err := NewUIServer(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.jobs.close()
+	server.jobs = newJobQueue(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		_, err := db.Exec(`UPDATE paper_cache SET citations = 11 WHERE url = ?`, job.URL)
+		return json.RawMessage(`{"fetched":1}`), err
+	})
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{"", http.StatusBadRequest},
+		{"url=http://unknown.com", http.StatusNotFound},
+		{"all=true", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/api/refresh", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.handleRefreshAPI(w, req)
+		if w.Code != tt.status {
+			t.Errorf("POST %q: expected status %d; got %d", tt.body, tt.status, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/api/refresh", strings.NewReader("url=http://test1.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.handleRefreshAPI(w, req)
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Location") != "/api/jobs/"+job.ID || job.URL != "http://test1.com" {
+		t.Errorf("Unexpected response %s, Location %q", w.Body, w.Header().Get("Location"))
+	}
+	waitForJob(t, server.jobs, job.ID)
+
+	req = httptest.NewRequest("GET", "/api/jobs/"+job.ID, nil)
+	req.SetPathValue("id", job.ID)
+	w = httptest.NewRecorder()
+	server.handleJobAPI(w, req)
+	var status struct {
+		Status    string `json:"status"`
+		Citations *int   `json:"citations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != jobSucceeded || status.Citations == nil || *status.Citations != 11 {
+		t.Errorf("Unexpected job status %s", w.Body)
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/404", nil)
+	req.SetPathValue("id", "404")
+	w = httptest.NewRecorder()
+	server.handleJobAPI(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job; got %d", w.Code)
+	}
+}
+
+func TestRunCollector(t *testing.T) {
+	// A fake collector that writes its arguments as the report
+	script := filepath.Join(t.TempDir(), "collector")
+	content := `#!/bin/sh
+while [ "$1" != "-report" ]; do shift; done
+echo "{\"args\": \"$*\"}" > "$2"
+`
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &UIServer{collector: script, dbFilePath: "papers.db"}
+	report, err := server.runCollector(context.Background(), Job{URL: "http://test1.com"})
+	if err != nil {
+		t.Fatalf("runCollector failed: %v", err)
+	}
+	if !strings.Contains(string(report), "-- http://test1.com") {
+		t.Errorf("Expected the paper's URL to be passed after --, got %s", report)
+	}
+
+	server.collector = "false"
+	if _, err := server.runCollector(context.Background(), Job{}); err == nil {
+		t.Error("Expected an error from a failing collector")
+	}
+}
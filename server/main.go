@@ -3,20 +3,94 @@ package main
 import (
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	// Define command line flags
+	configPath := flag.String("config", "", "YAML config file (default $MCP_CONFIG or "+defaultConfigFile+" if present)")
 	dbPath := flag.String("db", "paper_cache.db", "Path to the SQLite database file")
+	databases := flag.String("databases", "", "Databases to serve read-only at /{name}/ instead of -db, as name=path,...")
 	addr := flag.String("addr", ":9001", "HTTP server address")
+	pageSize := flag.Int("page-size", defaultPageSize, "Papers per page")
+	collector := flag.String("collector", defaultCollector, "Command that runs the collector for refresh jobs, e.g. \"go run ..\"")
+	publicURL := flag.String("public-url", "", "URL the server is reached at, like https://papers.example.com, for the links in feeds (default the request's host)")
+	var options authOptions
+	flag.StringVar(&options.Tokens, "tokens", "", "File of API tokens, as name:role:token lines")
+	flag.StringVar(&options.Htpasswd, "htpasswd", "", "htpasswd file of users for basic auth, with an optional :role after each hash")
+	flag.StringVar(&options.ProxyUserHeader, "proxy-user-header", "", "Header a trusted reverse proxy gives the authenticated user in")
+	flag.StringVar(&options.ProxyRoleHeader, "proxy-role-header", "", "Header a trusted reverse proxy gives the user's role in")
+	flag.StringVar(&options.TrustedProxies, "trusted-proxies", "", "Addresses or CIDRs of the trusted reverse proxies (default 127.0.0.1,::1)")
+	flag.BoolVar(&options.AnonymousReads, "anonymous-reads", true, "Let anyone read papers when auth is configured")
 	flag.Parse()
 
+	// The config is read again on reload, except for what the command line gives
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	// Fill in the flags that weren't given from the config file and environment
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.apply(flag.CommandLine); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *pageSize < 1 {
+		log.Fatalf("Invalid page size %d", *pageSize)
+	}
+	if *publicURL != "" {
+		if *publicURL, err = parsePublicURL(*publicURL); err != nil {
+			log.Fatalf("Invalid public URL: %v", err)
+		}
+	}
+	auth, err := loadAuth(options)
+	if err != nil {
+		log.Fatalf("Failed to load auth: %v", err)
+	}
+	if !auth.enabled() {
+		log.Printf("No auth configured, anyone who can reach the server can change papers")
+	}
+
+	if *databases != "" {
+		paths, err := parseDatabases(*databases)
+		if err != nil {
+			log.Fatalf("Invalid databases: %v", err)
+		}
+		set := newDatabaseSet(*pageSize)
+		set.auth = auth
+		set.publicURL = *publicURL
+		if err := set.load(paths); err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+		defer set.Close()
+		if given["db"] {
+			log.Printf("Serving -databases, not %s", *dbPath)
+		}
+		go reloadOnHangup(set, *configPath, *databases, given["databases"])
+
+		log.Printf("Starting UI server at %s", *addr)
+		log.Printf("Databases: %s", formatDatabases(paths))
+		log.Printf("Open your browser at http://localhost%s", *addr)
+		if err := http.ListenAndServe(*addr, set); err != nil {
+			log.Fatalf("Server error: %v", err)
+		}
+		return
+	}
+
 	// Create a new UI server
 	server, err := NewUIServer(*dbPath)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 	defer server.Close()
+	server.pageSize = *pageSize
+	server.collector = *collector
+	server.auth = auth
+	server.publicURL = *publicURL
 
 	log.Printf("Starting UI server at %s", *addr)
 	log.Printf("Database: %s", *dbPath)
@@ -26,3 +100,30 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// reloadOnHangup reloads the databases of set on SIGHUP, from the config
+// file and environment unless the command line gives them. A list that
+// fails to load leaves the databases served as they were.
+func reloadOnHangup(set *databaseSet, configPath, databases string, given bool) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		value := databases
+		if !given {
+			var err error
+			if value, err = configDatabases(configPath); err != nil {
+				log.Printf("Failed to reload databases: %v", err)
+				continue
+			}
+		}
+		paths, err := parseDatabases(value)
+		if err == nil {
+			err = set.load(paths)
+		}
+		if err != nil {
+			log.Printf("Failed to reload databases: %v", err)
+			continue
+		}
+		log.Printf("Reloaded databases: %s", formatDatabases(paths))
+	}
+}
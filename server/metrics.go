@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// publishedDate estimates when a paper came out: the middle of the month its
+// arXiv ID gives, else the middle of its year. NULL when neither is known.
+const publishedDate = `COALESCE(published || '-15', year || '-07-01')`
+
+// velocityColumn is the citations of a paper per month since it came out,
+// counting at least a month so new papers don't shoot up. Its age is counted
+// from today, not now, so a velocity holds over a day and cursors stay put.
+const velocityColumn = `paper_cache.citations / MAX(1.0, (julianday('now', 'start of day') - julianday(` + publishedDate + `)) / 30.44)`
+
+// gainColumn is the change in the citations of a paper over the last days,
+// from its citation history: since the newest count at least that old, or
+// the oldest one when the history is more recent. NULL without history.
+func gainColumn(days int) string {
+	return fmt.Sprintf(`paper_cache.citations - COALESCE(
+		(SELECT h.citations FROM citation_history h WHERE h.url = paper_cache.url AND h.fetched <= datetime('now', '-%d days') ORDER BY h.fetched DESC LIMIT 1),
+		(SELECT h.citations FROM citation_history h WHERE h.url = paper_cache.url ORDER BY h.fetched LIMIT 1))`, days)
+}
+
+// trendingSorts are the rankings of the trending view, the first by default
+var trendingSorts = []string{"gain30", "gain7", "gain90", "velocity"}
+
+// handleTrending ranks papers by how fast they gain citations, by default
+// over the last 30 days. It takes the filters and search of the index.
+func (s *UIServer) handleTrending(w http.ResponseWriter, r *http.Request) {
+	query, err := s.parsePaperQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case query.Sort == "":
+		query.Sort = trendingSorts[0]
+	case !slices.Contains(trendingSorts, query.Sort):
+		http.Error(w, fmt.Sprintf("trending papers are ranked by %s, not %s", strings.Join(trendingSorts, ", "), query.Sort), http.StatusBadRequest)
+		return
+	}
+
+	papers, total, err := s.getPapers(query)
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch papers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	totalPages := (total + query.PageSize - 1) / query.PageSize
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	data := struct {
+		Papers      []PaperView
+		Query       PaperQuery
+		Offset      int // rank of the first paper of the page, less one
+		CurrentPage int
+		TotalPages  int
+		CanEdit     bool
+	}{
+		Papers:      papers,
+		Query:       query,
+		Offset:      (query.Page - 1) * query.PageSize,
+		CurrentPage: query.Page,
+		TotalPages:  totalPages,
+		CanEdit:     s.canEdit(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := s.tmpl.ExecuteTemplate(w, "trending", data); err != nil {
+		http.Error(w, "Template execution failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// formatGain formats a change in citations with its sign, "–" if unknown
+func formatGain(gain *int) string {
+	switch {
+	case gain == nil:
+		return "–"
+	case *gain > 0:
+		return fmt.Sprintf("+%d", *gain)
+	default:
+		return fmt.Sprint(*gain)
+	}
+}
+
+// formatVelocity formats citations per month, "–" if unknown
+func formatVelocity(velocity *float64) string {
+	if velocity == nil {
+		return "–"
+	}
+	return fmt.Sprintf("%.1f", *velocity)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCitationMetrics(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	ago := func(days int) string {
+		return time.Now().UTC().AddDate(0, 0, -days).Format(time.DateTime)
+	}
+	month := func(months int) string {
+		return time.Now().UTC().AddDate(0, -months, 0).Format("2006-01")
+	}
+	// Old has many citations but gains few, new gains fast, and quiet has
+	// a single count and so no gain yet
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, published, year) VALUES
+			('http://old', 'Old', 1000, ?, NULL),
+			('http://new', 'New', 200, ?, NULL),
+			('http://quiet', 'Quiet', 50, NULL, 2000),
+			('http://undated', 'Undated', 10, NULL, NULL);
+		INSERT INTO citation_history (url, source, citations, fetched) VALUES
+			('http://old', 'scholar', 990, ?),
+			('http://old', 'scholar', 995, ?),
+			('http://old', 'scholar', 1000, ?),
+			('http://new', 'scholar', 100, ?),
+			('http://new', 'scholar', 200, ?),
+			('http://quiet', 'scholar', 50, ?);
+	`, month(100), month(10), ago(60), ago(10), ago(0), ago(20), ago(0), ago(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	papers, _, err := server.getPapers(PaperQuery{Sort: "velocity", Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, paper := range papers {
+		titles = append(titles, paper.Title)
+	}
+	if got := strings.Join(titles, ","); got != "New,Old,Quiet,Undated" {
+		t.Errorf("Expected papers by velocity New,Old,Quiet,Undated, got %s", got)
+	}
+	if v := papers[0].Velocity; v == nil || *v < 19 || *v > 21 {
+		t.Errorf("Expected about 20 citations a month for New, got %v", formatVelocity(v))
+	}
+	if papers[3].Velocity != nil {
+		t.Errorf("Expected no velocity without a date, got %v", *papers[3].Velocity)
+	}
+
+	gains := map[string][3]string{
+		// The 7-day gain of old counts from 10 days ago, the 30-day one
+		// from the oldest count as nothing is older
+		"Old":     {"+5", "+10", "+10"},
+		"New":     {"+100", "+100", "+100"},
+		"Quiet":   {"0", "0", "0"},
+		"Undated": {"–", "–", "–"},
+	}
+	for _, paper := range papers {
+		got := [3]string{formatGain(paper.Gain7), formatGain(paper.Gain30), formatGain(paper.Gain90)}
+		if got != gains[paper.Title] {
+			t.Errorf("Expected gains %v for %s, got %v", gains[paper.Title], paper.Title, got)
+		}
+	}
+}
+
+func TestHandleTrending(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	old := time.Now().UTC().AddDate(0, 0, -40).Format(time.DateTime)
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, year) VALUES
+			('http://a', 'Steady', 500, 2010),
+			('http://b', 'Rising', 80, 2024);
+		INSERT INTO citation_history (url, source, citations, fetched) VALUES
+			('http://a', 'scholar', 490, ?),
+			('http://a', 'scholar', 500, CURRENT_TIMESTAMP),
+			('http://b', 'scholar', 20, ?),
+			('http://b', 'scholar', 80, CURRENT_TIMESTAMP);
+	`, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/trending"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleTrending(w, req)
+		return w
+	}
+
+	w := get("")
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, body)
+	}
+	rising, steady := strings.Index(body, "Rising"), strings.Index(body, "Steady")
+	if rising < 0 || steady < 0 || rising > steady {
+		t.Errorf("Expected Rising ranked above Steady by 30-day gain")
+	}
+	for _, want := range []string{`href="/paper/2"`, "&#43;60", "&#43;10", `30 days ▼`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+
+	if w := get("?sort=title"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a sort trending doesn't rank by, got %d", w.Code)
+	}
+}
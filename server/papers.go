@@ -0,0 +1,288 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxTitleLength and maxTagLength bound what users can submit
+const (
+	maxTitleLength = 500
+	maxTagLength   = 40
+)
+
+// NewPaper is a paper submitted to the server
+type NewPaper struct {
+	URL   string   `json:"url"`
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+var (
+	// arxivIDRegex matches new-style (2311.09862) and old-style (hep-th/9901001) arXiv IDs
+	arxivIDRegex = regexp.MustCompile(`^(\d{4}\.\d{4,5}|[a-z-]+(?:\.[A-Z]{2})?/\d{7})(?:v\d+)?$`)
+	// arxivPathRegex matches the paths of arXiv abstract and PDF pages
+	arxivPathRegex = regexp.MustCompile(`^/(?:abs|pdf)/(.+?)(?:\.pdf)?$`)
+	doiRegex       = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+	tagRegex       = regexp.MustCompile(`^[a-z0-9][a-z0-9._+-]*$`)
+)
+
+// canonicalURL validates a submitted paper URL and returns the form it is
+// stored under, so the same paper isn't added twice. arXiv IDs and URLs
+// become https://arxiv.org/abs/ID without a version, which the collector
+// resolves without a title, and DOIs become https://doi.org/DOI. The
+// collector stores the papers of its lists under the same URLs, as
+// testdata/canonical_urls.json checks.
+func canonicalURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("url is required")
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(raw, "arXiv:"), "arxiv:")
+	if m := arxivIDRegex.FindStringSubmatch(id); m != nil {
+		return "https://arxiv.org/abs/" + m[1], nil
+	}
+	if doi := strings.TrimPrefix(raw, "doi:"); doiRegex.MatchString(doi) {
+		return "https://doi.org/" + doi, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %v", raw, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid url %q, expected an http or https URL, an arXiv ID or a DOI", raw)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", fmt.Errorf("invalid url %q, missing host", raw)
+	}
+
+	switch host {
+	case "arxiv.org", "www.arxiv.org", "export.arxiv.org":
+		if m := arxivPathRegex.FindStringSubmatch(strings.TrimSuffix(u.Path, "/")); m != nil {
+			if id := arxivIDRegex.FindStringSubmatch(m[1]); id != nil {
+				return "https://arxiv.org/abs/" + id[1], nil
+			}
+		}
+	case "doi.org", "dx.doi.org", "www.doi.org":
+		return "https://doi.org/" + strings.TrimPrefix(u.Path, "/"), nil
+	}
+
+	// Keep the port only when it isn't the default one
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+	if u.Path != "/" {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	// Tracking parameters don't identify the paper
+	query := u.Query()
+	for name := range query {
+		if strings.HasPrefix(name, "utm_") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// normalizeTags lowercases and validates tags, dropping duplicates. Spaces
+// inside a tag become dashes.
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || !tagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q, expected letters, digits, '.', '_', '+' or '-'", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// splitTags splits a comma- or semicolon-separated tag list
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// validate canonicalizes the paper's URL, title and tags in place
+func (p *NewPaper) validate() error {
+	canonical, err := canonicalURL(p.URL)
+	if err != nil {
+		return err
+	}
+	p.URL = canonical
+
+	p.Title = strings.Join(strings.Fields(p.Title), " ")
+	if len(p.Title) > maxTitleLength {
+		return fmt.Errorf("title is longer than %d characters", maxTitleLength)
+	}
+	if p.Title == "" {
+		// The collector finds other papers on Google Scholar by their title
+		id, ok := strings.CutPrefix(p.URL, "https://arxiv.org/abs/")
+		if !ok {
+			return errors.New("title is required for papers that aren't on arXiv")
+		}
+		p.Title = "arXiv:" + id
+	}
+
+	tags, err := normalizeTags(p.Tags)
+	if err != nil {
+		return err
+	}
+	p.Tags = tags
+	return nil
+}
+
+// errPaperExists is returned by insertPapers for a paper that is already stored
+var errPaperExists = errors.New("paper already exists")
+
+// insertPapers stores papers as pending, so the collector fetches them on its
+// next run. It returns errPaperExists for each paper already stored, and nil
+// for each one inserted.
+func (s *UIServer) insertPapers(papers []NewPaper) ([]error, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]error, len(papers))
+	for i, paper := range papers {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM paper_cache WHERE url = ?`, paper.URL).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %v", paper.URL, err)
+		}
+		if count > 0 {
+			results[i] = errPaperExists
+			continue
+		}
+
+		_, err := tx.Exec(`INSERT INTO paper_cache (url, title, timestamp, pending, added) VALUES (?, ?, NULL, 1, CURRENT_TIMESTAMP)`, paper.URL, paper.Title)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert %s: %v", paper.URL, err)
+		}
+		for _, tag := range paper.Tags {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO paper_tags (url, tag) VALUES (?, ?)`, paper.URL, tag); err != nil {
+				return nil, fmt.Errorf("failed to tag %s: %v", paper.URL, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %v", err)
+	}
+	return results, nil
+}
+
+// readNewPaper reads a paper from a JSON body, or from form values with
+// comma-separated tags
+func readNewPaper(r *http.Request) (NewPaper, error) {
+	var paper NewPaper
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxImportSize)).Decode(&paper); err != nil {
+			return paper, fmt.Errorf("invalid JSON: %v", err)
+		}
+		return paper, nil
+	}
+
+	paper.URL = r.FormValue("url")
+	paper.Title = r.FormValue("title")
+	paper.Tags = splitTags(r.FormValue("tags"))
+	return paper, nil
+}
+
+// addPaper validates, stores and queues the paper submitted in r, returning
+// the HTTP status to respond with on error
+func (s *UIServer) addPaper(r *http.Request) (NewPaper, Job, int, error) {
+	paper, err := readNewPaper(r)
+	if err != nil {
+		return paper, Job{}, http.StatusBadRequest, err
+	}
+	if err := paper.validate(); err != nil {
+		return paper, Job{}, http.StatusBadRequest, err
+	}
+
+	results, err := s.insertPapers([]NewPaper{paper})
+	if err != nil {
+		return paper, Job{}, http.StatusInternalServerError, err
+	}
+	if results[0] != nil {
+		return paper, Job{}, http.StatusConflict, fmt.Errorf("%v: %s", results[0], paper.URL)
+	}
+
+	job, err := s.jobs.enqueue(Job{URL: paper.URL})
+	if err != nil {
+		// The paper is stored; the collector fetches it on its next run
+		return paper, Job{}, http.StatusServiceUnavailable, err
+	}
+	return paper, job, http.StatusCreated, nil
+}
+
+// handleAddPaperAPI adds a paper given as JSON ({"url", "title", "tags"}) or
+// form values, and queues its first fetch
+func (s *UIServer) handleAddPaperAPI(w http.ResponseWriter, r *http.Request) {
+	paper, job, status, err := s.addPaper(r)
+	if err != nil && status != http.StatusServiceUnavailable {
+		writeAPIError(w, status, err.Error())
+		return
+	}
+
+	response := struct {
+		Paper NewPaper `json:"paper"`
+		Job   *Job     `json:"job"` // nil when the queue is full
+	}{Paper: paper}
+	if err == nil {
+		response.Job = &job
+		w.Header().Set("Location", apiPrefix(r)+"/jobs/"+job.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleAddPaper handles the add form when JavaScript is off
+func (s *UIServer) handleAddPaper(w http.ResponseWriter, r *http.Request) {
+	if _, _, status, err := s.addPaper(r); err != nil && status != http.StatusServiceUnavailable {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	http.Redirect(w, r, s.url("/"), http.StatusSeeOther)
+}
+
+// splitTagList splits the tags selected with group_concat
+func splitTagList(tags sql.NullString) []string {
+	if !tags.Valid || tags.String == "" {
+		return nil
+	}
+	return strings.Split(tags.String, ",")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer returns a server on an empty database whose jobs only record
+// the papers they were asked to refresh
+func newTestServer(t *testing.T) (*UIServer, chan Job) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "papers.db")
+	createSchema(t, path)
+	server, err := NewUIServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	ran := make(chan Job, 10)
+	server.jobs.close()
+	server.jobs = newJobQueue(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		ran <- job
+		return nil, nil
+	})
+	return server, ran
+}
+
+func TestCanonicalURL(t *testing.T) {
+	// The collector's test reads the same cases, so it stores papers alike
+	data, err := os.ReadFile("testdata/canonical_urls.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests []struct {
+		Input     string `json:"input"`
+		Canonical string `json:"canonical"`
+		Rejected  bool   `json:"rejected"` // the server refuses it, the collector keeps it
+	}
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, err := canonicalURL(tt.Input)
+		if tt.Rejected {
+			if err == nil {
+				t.Errorf("Expected an error for %q", tt.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("canonicalURL(%q) failed: %v", tt.Input, err)
+			continue
+		}
+		if got != tt.Canonical {
+			t.Errorf("canonicalURL(%q) = %q; want %q", tt.Input, got, tt.Canonical)
+		}
+	}
+}
+
+func TestNewPaperValidate(t *testing.T) {
+	paper := NewPaper{URL: "2311.09862", Tags: []string{" Graph Neural Networks ", "GNN", "gnn", ""}}
+	if err := paper.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	if paper.Title != "arXiv:2311.09862" {
+		t.Errorf("Expected the arXiv ID as title, got %q", paper.Title)
+	}
+	if strings.Join(paper.Tags, ",") != "graph-neural-networks,gnn" {
+		t.Errorf("Unexpected tags %v", paper.Tags)
+	}
+
+	invalid := []NewPaper{
+		{URL: "https://example.com/paper"}, // needs a title to be found on Scholar
+		{URL: "2311.09862", Tags: []string{"c#"}},
+		{URL: "2311.09862", Title: strings.Repeat("a", maxTitleLength+1)},
+	}
+	for _, paper := range invalid {
+		if err := paper.validate(); err == nil {
+			t.Errorf("Expected an error for %+v", paper)
+		}
+	}
+}
+
+func TestAddPaperAPI(t *testing.T) {
+	server, ran := newTestServer(t)
+
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/papers", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		server.handleAddPaperAPI(w, req)
+		return w
+	}
+
+	w := post("application/json", `{"url": "https://arxiv.org/pdf/2311.09862", "title": "Graph Papers", "tags": ["GNN", "survey"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201; got %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Paper NewPaper `json:"paper"`
+		Job   *Job     `json:"job"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Paper.URL != "https://arxiv.org/abs/2311.09862" || response.Job == nil {
+		t.Errorf("Unexpected response %s", w.Body)
+	}
+	if job := <-ran; job.URL != "https://arxiv.org/abs/2311.09862" {
+		t.Errorf("Expected a job for the new paper, got %+v", job)
+	}
+
+	// The same paper under another URL is a duplicate
+	if w := post("application/x-www-form-urlencoded", "url=arXiv:2311.09862v2"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409; got %d", w.Code)
+	}
+	if w := post("application/x-www-form-urlencoded", "url=ftp://example.com"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400; got %d", w.Code)
+	}
+	if w := post("application/json", `{"url": `); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid JSON; got %d", w.Code)
+	}
+
+	papers, total, err := server.getPapers(PaperQuery{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || !papers[0].Pending || strings.Join(papers[0].Tags, ",") != "gnn,survey" || papers[0].LastUpdate != "" {
+		t.Errorf("Expected one pending, tagged paper, got %+v", papers)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PaperQuery selects a page of papers
+type PaperQuery struct {
+	Page     int
+	PageSize int
+	Search   string // query parsed by parseSearch
+	Rank     string // "blend" boosts search results by citations, else relevance only
+	Sort     string // a key of paperSorts; "" orders searches by relevance, else by citations
+	Order    string // "asc" or "desc"; "" for the sort's usual order
+
+	// Collection is the list the papers are in, "" for the papers still in
+	// any list or added through the server
+	Collection string
+
+	// Filters, on top of those in Search
+	MinCitations *int
+	MaxCitations *int
+	MinYear      *int
+	MaxYear      *int
+	Tag          string
+	Source       string   // a key of sourceConditions
+	Missing      []string // keys of hasConditions the papers must lack
+	NewDays      *int     // only papers first seen this many days ago or later
+	Mine         []string // keys of annotationConditions the user's annotations must match
+
+	User string // who is listing the papers, for their annotations; "" if unknown
+
+	cursor *paperCursor // where the API's cursor parameter continues the listing, nil for Page
+}
+
+// paperSort is an order papers can be listed in
+type paperSort struct {
+	column string // SQL expression sorted on; papers where it is NULL come last
+	desc   bool   // whether it sorts in descending order unless asked otherwise
+}
+
+// paperSorts are the orders of the sort parameter
+var paperSorts = map[string]paperSort{
+	"citations":  {"citations", true},
+	"title":      {"paper_cache.title COLLATE NOCASE", false},
+	"added":      {"added", true},
+	"updated":    {"timestamp", true},
+	"year":       {"year", true},
+	"velocity":   {velocityColumn, true},
+	"gain7":      {gainColumn(7), true},
+	"gain30":     {gainColumn(30), true},
+	"gain90":     {gainColumn(90), true},
+	"first_seen": {firstSeenColumn, true},
+	"stars":      {starsColumn, true},
+}
+
+// Choices offered by the index page, in the order shown
+var (
+	filterSources  = []string{"arxiv", "acl", "doi", "other"}
+	missingFields  = []string{"abstract", "citations", "code", "authors", "year"}
+	secondarySorts = []string{"year", "added", "updated", "velocity", "stars"}
+)
+
+// parsePaperQuery reads the page, search, sort order and filters of a paper
+// listing
+func (s *UIServer) parsePaperQuery(r *http.Request) (PaperQuery, error) {
+	params := r.URL.Query()
+	query := PaperQuery{Page: 1, PageSize: s.pageSize, Search: params.Get("q"), User: s.requestUser(r)}
+	if pageStr := params.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			query.Page = p
+		}
+	}
+	switch rank := params.Get("rank"); rank {
+	case "", "relevance":
+	case "blend":
+		query.Rank = rank
+	default:
+		return query, fmt.Errorf("unknown rank %q, expected relevance or blend", rank)
+	}
+
+	query.Sort = params.Get("sort")
+	if _, ok := paperSorts[query.Sort]; !ok && query.Sort != "" && query.Sort != "relevance" {
+		return query, fmt.Errorf("unknown sort %q, expected relevance, citations, title, added, updated, year, velocity, gain7, gain30, gain90, first_seen or stars", query.Sort)
+	}
+	if query.Sort == "relevance" {
+		query.Sort = ""
+	}
+	switch query.Order = params.Get("order"); query.Order {
+	case "", "asc", "desc":
+	default:
+		return query, fmt.Errorf("unknown order %q, expected asc or desc", query.Order)
+	}
+
+	for name, limit := range map[string]**int{
+		"min_citations": &query.MinCitations,
+		"max_citations": &query.MaxCitations,
+		"min_year":      &query.MinYear,
+		"max_year":      &query.MaxYear,
+		"new_days":      &query.NewDays,
+	} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid %s %q, expected a number", name, value)
+		}
+		*limit = &n
+	}
+
+	query.Collection = params.Get("collection")
+	if tag := params.Get("tag"); tag != "" {
+		tags, err := normalizeTags([]string{tag})
+		if err != nil {
+			return query, err
+		}
+		query.Tag = tags[0]
+	}
+	query.Source = strings.ToLower(params.Get("source"))
+	if _, ok := sourceConditions[query.Source]; !ok && query.Source != "" {
+		return query, fmt.Errorf("unknown source %q, expected arxiv, acl, doi or other", query.Source)
+	}
+	for _, value := range params["missing"] {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.ToLower(strings.TrimSpace(field))
+			if _, ok := hasConditions[field]; !ok {
+				return query, fmt.Errorf("unknown missing field %q, expected %s", field, hasFields)
+			}
+			query.Missing = append(query.Missing, field)
+		}
+	}
+	for _, value := range params["mine"] {
+		for _, filter := range strings.Split(value, ",") {
+			filter = strings.ToLower(strings.TrimSpace(filter))
+			if _, ok := annotationConditions[filter]; !ok {
+				return query, fmt.Errorf("unknown mine filter %q, expected %s", filter, strings.Join(mineFilters, ", "))
+			}
+			query.Mine = append(query.Mine, filter)
+		}
+	}
+	if len(query.Mine) > 0 && query.User == "" {
+		return query, fmt.Errorf("set your name, or the X-User header, to filter by your annotations")
+	}
+	return query, nil
+}
+
+// addFilters adds the query's filters to the conditions of a search
+func (q PaperQuery) addFilters(search *paperSearch) {
+	if q.Collection != "" {
+		search.add(collectionCondition, q.Collection)
+	} else {
+		search.add(listedCondition)
+	}
+	if q.NewDays != nil {
+		search.add(firstSeenColumn+` >= datetime('now', ?)`, fmt.Sprintf("-%d days", *q.NewDays))
+	}
+	if q.MinCitations != nil {
+		search.add(`citations >= ?`, *q.MinCitations)
+	}
+	if q.MaxCitations != nil {
+		search.add(`citations <= ?`, *q.MaxCitations)
+	}
+	if q.MinYear != nil {
+		search.add(`year >= ?`, *q.MinYear)
+	}
+	if q.MaxYear != nil {
+		search.add(`year <= ?`, *q.MaxYear)
+	}
+	if q.Tag != "" {
+		search.add(tagCondition, q.Tag)
+	}
+	if q.Source != "" {
+		search.add(sourceConditions[q.Source])
+	}
+	for _, field := range q.Missing {
+		search.add(`NOT (` + hasConditions[field] + `)`)
+	}
+	for _, filter := range q.Mine {
+		search.add(annotationConditions[filter], q.User)
+	}
+}
+
+// HasFilters reports whether any filter is set
+func (q PaperQuery) HasFilters() bool {
+	return q.MinCitations != nil || q.MaxCitations != nil || q.MinYear != nil || q.MaxYear != nil ||
+		q.Tag != "" || q.Source != "" || len(q.Missing) > 0 || q.NewDays != nil || len(q.Mine) > 0
+}
+
+// IsMissing reports whether the query selects papers missing field
+func (q PaperQuery) IsMissing(field string) bool {
+	for _, missing := range q.Missing {
+		if missing == field {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMine reports whether the listing is filtered by the user's annotations
+// matching filter
+func (q PaperQuery) IsMine(filter string) bool {
+	return slices.Contains(q.Mine, filter)
+}
+
+// WithoutFilters links to the first page of the listing without its filters
+func (q PaperQuery) WithoutFilters() string {
+	return "?" + PaperQuery{Search: q.Search, Rank: q.Rank, Sort: q.Sort, Order: q.Order, Collection: q.Collection}.values().Encode()
+}
+
+// CollectionURL links to the first page of the listing in a collection, or
+// in every list for ""
+func (q PaperQuery) CollectionURL(name string) string {
+	q.Collection, q.Page = name, 1
+	return "?" + q.values().Encode()
+}
+
+// ExportURL links to the listing, every page of it, in an export format
+func (q PaperQuery) ExportURL(format string) string {
+	q.Page = 1
+	return "/export." + format + "?" + q.values().Encode()
+}
+
+// direction returns the key and the sort the listing is in, and whether it
+// is descending
+func (q PaperQuery) direction() (string, paperSort, bool) {
+	key := q.Sort
+	if key == "" {
+		key = "citations"
+	}
+	sort := paperSorts[key]
+	desc := sort.desc
+	if q.Order != "" {
+		desc = q.Order == "desc"
+	}
+	return key, sort, desc
+}
+
+// orderBy returns the ORDER BY clause of the query's sort, with the rowid
+// breaking ties so pages don't overlap
+func (q PaperQuery) orderBy() string {
+	_, sort, desc := q.direction()
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+	return ` ORDER BY CASE WHEN ` + sort.column + ` IS NULL THEN 1 ELSE 0 END, ` + sort.column + direction + `, paper_cache.rowid` + direction
+}
+
+// after returns the condition selecting the papers that orderBy lists after
+// the cursor's paper
+func (q PaperQuery) after(c paperCursor) (string, []interface{}) {
+	_, sort, desc := q.direction()
+	cmp := " > ?"
+	if desc {
+		cmp = " < ?"
+	}
+	if c.Value == nil {
+		return `(` + sort.column + ` IS NULL AND paper_cache.rowid` + cmp + `)`, []interface{}{c.RowID}
+	}
+	return `(` + sort.column + ` IS NULL OR ` + sort.column + cmp + ` OR (` + sort.column + ` = ? AND paper_cache.rowid` + cmp + `))`,
+		[]interface{}{c.Value, c.Value, c.RowID}
+}
+
+// values encodes the query as URL parameters, leaving out the defaults
+func (q PaperQuery) values() url.Values {
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	setInt := func(name string, n *int) {
+		if n != nil {
+			values.Set(name, strconv.Itoa(*n))
+		}
+	}
+	set("q", q.Search)
+	set("rank", q.Rank)
+	set("sort", q.Sort)
+	set("order", q.Order)
+	set("collection", q.Collection)
+	setInt("min_citations", q.MinCitations)
+	setInt("max_citations", q.MaxCitations)
+	setInt("min_year", q.MinYear)
+	setInt("max_year", q.MaxYear)
+	set("tag", q.Tag)
+	set("source", q.Source)
+	if len(q.Missing) > 0 {
+		values.Set("missing", strings.Join(q.Missing, ","))
+	}
+	setInt("new_days", q.NewDays)
+	if len(q.Mine) > 0 {
+		values.Set("mine", strings.Join(q.Mine, ","))
+	}
+	if q.Page > 1 {
+		values.Set("page", strconv.Itoa(q.Page))
+	}
+	return values
+}
+
+// PageURL links to another page of the listing
+func (q PaperQuery) PageURL(page int) string {
+	q.Page = page
+	return "?" + q.values().Encode()
+}
+
+// SortURL links to the first page of the listing sorted by key, reversing
+// the order if it's already sorted by it
+func (q PaperQuery) SortURL(key string) string {
+	if q.sortKey() == key {
+		ascending := q.sortedAscending()
+		q.Sort, q.Order = key, "asc"
+		if ascending {
+			q.Order = "desc"
+		}
+	} else {
+		q.Sort, q.Order = key, ""
+	}
+	q.Page = 1
+	return "?" + q.values().Encode()
+}
+
+// SortArrow shows whether the listing is sorted by key, and in which order
+func (q PaperQuery) SortArrow(key string) string {
+	switch {
+	case q.sortKey() != key:
+		return ""
+	case q.sortedAscending():
+		return "▲"
+	default:
+		return "▼"
+	}
+}
+
+// sortKey returns the key of the listing's sort, "" for relevance
+func (q PaperQuery) sortKey() string {
+	if q.Sort == "" && q.Search == "" {
+		return "citations"
+	}
+	return q.Sort
+}
+
+// sortedAscending reports whether the listing is in ascending order of its sort
+func (q PaperQuery) sortedAscending() bool {
+	if q.Order != "" {
+		return q.Order == "asc"
+	}
+	return !paperSorts[q.sortKey()].desc
+}
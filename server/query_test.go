@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsePaperQuery(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/?q=graph&page=2&sort=title&order=desc&min_citations=10&max_year=2023&tag=RAG&source=ACL&missing=code,year&missing=abstract", nil)
+	query, err := server.parsePaperQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Page != 2 || query.Sort != "title" || query.Order != "desc" || *query.MinCitations != 10 || *query.MaxYear != 2023 ||
+		query.MaxCitations != nil || query.Tag != "rag" || query.Source != "acl" || strings.Join(query.Missing, ",") != "code,year,abstract" {
+		t.Errorf("Unexpected query %+v", query)
+	}
+	if got := query.PageURL(3); got != "?max_year=2023&min_citations=10&missing=code%2Cyear%2Cabstract&order=desc&page=3&q=graph&sort=title&source=acl&tag=rag" {
+		t.Errorf("Unexpected page URL %s", got)
+	}
+	if got := query.WithoutFilters(); got != "?order=desc&q=graph&sort=title" {
+		t.Errorf("Unexpected URL without filters %s", got)
+	}
+
+	for _, invalid := range []string{"sort=popularity", "mine=unread", "mine=liked", "order=up", "min_citations=many", "max_year=-1", "tag=c%23", "source=nature", "missing=slides"} {
+		req := httptest.NewRequest("GET", "/?"+invalid, nil)
+		if _, err := server.parsePaperQuery(req); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+		w := httptest.NewRecorder()
+		server.handlePapersAPI(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s; got %d", invalid, w.Code)
+		}
+	}
+}
+
+func TestSortURL(t *testing.T) {
+	tests := []struct {
+		query PaperQuery
+		key   string
+		url   string
+		arrow string
+	}{
+		// Papers are sorted by citations, most first, unless searching
+		{PaperQuery{}, "citations", "?order=asc&sort=citations", "▼"},
+		{PaperQuery{Search: "graph"}, "citations", "?q=graph&sort=citations", ""},
+		{PaperQuery{Sort: "title"}, "title", "?order=desc&sort=title", "▲"},
+		{PaperQuery{Sort: "title", Order: "desc", Page: 3}, "title", "?order=asc&sort=title", "▼"},
+		{PaperQuery{Sort: "title", Order: "asc"}, "year", "?sort=year", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.query.SortURL(tt.key); got != tt.url {
+			t.Errorf("%+v.SortURL(%q) = %q; want %q", tt.query, tt.key, got, tt.url)
+		}
+		if got := tt.query.SortArrow(tt.key); got != tt.arrow {
+			t.Errorf("%+v.SortArrow(%q) = %q; want %q", tt.query, tt.key, got, tt.arrow)
+		}
+	}
+}
+
+func TestSortAndFilterPapers(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, arxiv_summary, code_url, year, timestamp, added) VALUES
+			('https://arxiv.org/abs/1609.02907', 'beta', 300, 'Abstract.', 'https://github.com/a/b', 2016, '2024-03-01 10:00:00', '2024-01-01 10:00:00'),
+			('https://aclanthology.org/2023.acl-long.1', 'Alpha', 50, NULL, NULL, 2023, '2024-03-03 10:00:00', '2024-01-02 10:00:00'),
+			('https://example.com/paper', 'Gamma', NULL, NULL, NULL, NULL, '2024-03-02 10:00:00', '2024-01-03 10:00:00')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.db.Exec(`INSERT INTO paper_tags (url, tag) VALUES ('https://example.com/paper', 'rag')`); err != nil {
+		t.Fatal(err)
+	}
+
+	intPtr := func(n int) *int { return &n }
+	tests := []struct {
+		name  string
+		query PaperQuery
+		want  string
+	}{
+		{"default", PaperQuery{}, "beta, Alpha, Gamma"},
+		{"citations ascending", PaperQuery{Sort: "citations", Order: "asc"}, "Alpha, beta, Gamma"},
+		{"title", PaperQuery{Sort: "title"}, "Alpha, beta, Gamma"},
+		{"added", PaperQuery{Sort: "added"}, "Gamma, Alpha, beta"},
+		{"updated", PaperQuery{Sort: "updated", Order: "asc"}, "beta, Gamma, Alpha"},
+		{"year", PaperQuery{Sort: "year"}, "Alpha, beta, Gamma"},
+		{"citation range", PaperQuery{MinCitations: intPtr(40), MaxCitations: intPtr(100)}, "Alpha"},
+		{"year range", PaperQuery{MinYear: intPtr(2010), MaxYear: intPtr(2020)}, "beta"},
+		{"tag", PaperQuery{Tag: "rag"}, "Gamma"},
+		{"source", PaperQuery{Source: "arxiv"}, "beta"},
+		{"missing", PaperQuery{Missing: []string{"abstract", "citations"}}, "Gamma"},
+		{"with a search", PaperQuery{Search: "year:>2000", Sort: "title", Order: "desc"}, "beta, Alpha"},
+	}
+	for _, tt := range tests {
+		tt.query.Page, tt.query.PageSize = 1, 10
+		papers, total, err := server.getPapers(tt.query)
+		if err != nil {
+			t.Errorf("%s: getPapers failed: %v", tt.name, err)
+			continue
+		}
+		var titles []string
+		for _, paper := range papers {
+			titles = append(titles, paper.Title)
+		}
+		if got := strings.Join(titles, ", "); got != tt.want || total != len(papers) {
+			t.Errorf("%s: got %q (total %d); want %q", tt.name, got, total, tt.want)
+		}
+	}
+
+	// The index page links the headers to the other orders
+	req := httptest.NewRequest("GET", "/?sort=title&tag=rag", nil)
+	w := httptest.NewRecorder()
+	server.handleIndex(w, req)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `href="?order=desc&amp;sort=title&amp;tag=rag"`) || !strings.Contains(body, "Title ▲") {
+		t.Errorf("Expected a link reversing the title order; got %d", w.Code)
+	}
+	if !strings.Contains(body, `<option value="acl" >acl</option>`) || !strings.Contains(body, `name="tag" value="rag"`) {
+		t.Errorf("Expected the filter form with the tag")
+	}
+}
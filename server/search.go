@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Markers around the matches in highlight() and snippet() output. They are
+// replaced by <mark> tags once the rest of the text is escaped.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// searchRank orders search results by relevance. bm25 is negative, better
+// matches lower; title matches weigh most, then authors and tags.
+const searchRank = `bm25(paper_search, 10.0, 1.0, 5.0, 5.0)`
+
+// blendedRank orders search results by relevance boosted by citations: a
+// paper with c citations counts up to twice as relevant, half way at 100
+const blendedRank = searchRank + ` * (1 + COALESCE(citations, 0) / (COALESCE(citations, 0) + 100.0))`
+
+// QueryError is a search query that can't be parsed
+type QueryError struct {
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return "invalid query: " + e.Message
+}
+
+// searchTerm is a word or a quoted phrase searched in the text of papers
+type searchTerm struct {
+	text   string
+	phrase bool
+}
+
+// paperSearch is a parsed search query: the terms every paper must contain,
+// and SQL conditions on the other fields, with their arguments
+type paperSearch struct {
+	terms      []searchTerm
+	conditions []string
+	args       []interface{}
+}
+
+// sourceConditions select papers by where their URL points to
+var sourceConditions = map[string]string{
+	"arxiv": `url LIKE '%arxiv.org/%'`,
+	"acl":   `url LIKE '%aclanthology.org/%'`,
+	"doi":   `url LIKE 'https://doi.org/%'`,
+	"other": `url NOT LIKE '%arxiv.org/%' AND url NOT LIKE '%aclanthology.org/%' AND url NOT LIKE 'https://doi.org/%'`,
+}
+
+// hasConditions select papers by the data fetched for them
+var hasConditions = map[string]string{
+	"code":      `COALESCE(code_url, '') != ''`,
+	"abstract":  `COALESCE(arxiv_summary, '') != ''`,
+	"citations": `citations IS NOT NULL`,
+	"authors":   `COALESCE(paper_cache.authors, '') != ''`,
+	"year":      `year IS NOT NULL`,
+}
+
+// hasFields lists the keys of hasConditions for error messages
+const hasFields = "code, abstract, citations, authors or year"
+
+// tagCondition selects papers with a tag
+const tagCondition = `EXISTS (SELECT 1 FROM paper_tags t WHERE t.url = paper_cache.url AND t.tag = ?)`
+
+// parseSearch parses a search query like
+//
+//	author:kipf year:>=2023 cites:>100 tag:rag has:code source:acl "exact phrase" graph
+//
+// Words, URLs and quoted phrases are searched in titles, abstracts, authors
+// and tags; a field:value pair filters on a field. Values may be quoted, and
+// year and cites take a comparison: 2023, >2023, >=2023, <2023 or <=2023.
+func parseSearch(query string) (paperSearch, error) {
+	var search paperSearch
+	tokens, err := splitSearch(query)
+	if err != nil {
+		return search, err
+	}
+
+	for _, token := range tokens {
+		name, value, ok := strings.Cut(token, ":")
+		if !ok || strings.HasPrefix(token, `"`) || strings.HasPrefix(value, "//") || !isFieldName(name) {
+			search.addTerm(token)
+			continue
+		}
+
+		value = strings.Trim(value, `"`)
+		if value == "" {
+			return search, &QueryError{fmt.Sprintf("%s: needs a value", name)}
+		}
+
+		switch strings.ToLower(name) {
+		case "author":
+			search.add(`paper_cache.authors LIKE ? ESCAPE '\'`, likePattern(value))
+		case "year":
+			op, year, err := parseComparison(value)
+			if err != nil {
+				return search, &QueryError{fmt.Sprintf("year:%s: %v", value, err)}
+			}
+			search.add(`year `+op+` ?`, year)
+		case "cites", "citations":
+			op, count, err := parseComparison(value)
+			if err != nil {
+				return search, &QueryError{fmt.Sprintf("%s:%s: %v", name, value, err)}
+			}
+			search.add(`citations `+op+` ?`, count)
+		case "tag":
+			tags, err := normalizeTags([]string{value})
+			if err != nil {
+				return search, &QueryError{err.Error()}
+			}
+			search.add(tagCondition, tags[0])
+		case "has":
+			condition, ok := hasConditions[strings.ToLower(value)]
+			if !ok {
+				return search, &QueryError{fmt.Sprintf("has:%s: expected %s", value, hasFields)}
+			}
+			search.add(condition)
+		case "source":
+			condition, ok := sourceConditions[strings.ToLower(value)]
+			if !ok {
+				return search, &QueryError{fmt.Sprintf("source:%s: expected arxiv, acl, doi or other", value)}
+			}
+			search.add(condition)
+		default:
+			return search, &QueryError{fmt.Sprintf("unknown field %q, expected author, year, cites, tag, has or source", name)}
+		}
+	}
+	return search, nil
+}
+
+// splitSearch splits a query at the spaces outside double quotes
+func splitSearch(query string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, &QueryError{"missing closing quote"}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+// isFieldName reports whether the text before a colon could name a field
+func isFieldName(name string) bool {
+	return name != "" && !strings.ContainsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// parseComparison parses ">=2023" into the SQL operator and the number
+func parseComparison(value string) (string, int, error) {
+	op := "="
+	for _, prefix := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, prefix) {
+			op, value = prefix, value[len(prefix):]
+			break
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return "", 0, fmt.Errorf("expected a number, optionally after >, >=, < or <=")
+	}
+	return op, n, nil
+}
+
+// add adds a condition on a field
+func (s *paperSearch) add(condition string, args ...interface{}) {
+	s.conditions = append(s.conditions, "("+condition+")")
+	s.args = append(s.args, args...)
+}
+
+// addTerm adds a word or a quoted phrase to search for, ignoring those
+// without letters or digits
+func (s *paperSearch) addTerm(token string) {
+	term := searchTerm{text: token}
+	if strings.HasPrefix(token, `"`) {
+		term = searchTerm{text: strings.ReplaceAll(token, `"`, ""), phrase: true}
+	}
+	if !strings.ContainsFunc(term.text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+		return
+	}
+	s.terms = append(s.terms, term)
+}
+
+// matchQuery turns the search terms into an FTS5 query matching papers with
+// all of them, the last word as a prefix since it may still be being typed
+func matchQuery(terms []searchTerm) string {
+	var quoted []string
+	for _, term := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(term.text, `"`, `""`)+`"`)
+	}
+	if last := len(terms) - 1; last >= 0 && !terms[last].phrase {
+		quoted[last] += "*"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// likeConditions is the fallback search without FTS5: every term must be in
+// the title or the abstract
+func likeConditions(terms []searchTerm) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for _, term := range terms {
+		conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR arxiv_summary LIKE ? ESCAPE '\')`)
+		pattern := likePattern(term.text)
+		args = append(args, pattern, pattern)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// likePattern matches text containing value, escaping LIKE's wildcards
+func likePattern(value string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value) + "%"
+}
+
+// highlightHTML escapes text returned by highlight() or snippet() and marks
+// its matches
+func highlightHTML(text string) template.HTML {
+	escaped := html.EscapeString(text)
+	escaped = strings.NewReplacer(matchStart, `<mark class="highlight">`, matchEnd, `</mark>`).Replace(escaped)
+	return template.HTML(escaped)
+}
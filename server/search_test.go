@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"graph neural", `"graph" "neural"*`},
+		{`  say "hi there" - `, `"say" "hi there"`},
+		{"c++ AND", `"c++" "AND"*`},
+		{"http://example.com/x", `"http://example.com/x"*`},
+		{"- !", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		search, err := parseSearch(tt.input)
+		if err != nil {
+			t.Fatalf("parseSearch(%q) failed: %v", tt.input, err)
+		}
+		if got := matchQuery(search.terms); got != tt.want {
+			t.Errorf("matchQuery(%q) = %q; want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	search, err := parseSearch(`author:"de Kipf" Year:>=2023 cites:<100 tag:RAG has:code source:acl "exact phrase" graph`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`(paper_cache.authors LIKE ? ESCAPE '\')`,
+		`(year >= ?)`,
+		`(citations < ?)`,
+		`(EXISTS (SELECT 1 FROM paper_tags t WHERE t.url = paper_cache.url AND t.tag = ?))`,
+		"(" + hasConditions["code"] + ")",
+		"(" + sourceConditions["acl"] + ")",
+	}
+	if strings.Join(search.conditions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected conditions %q", search.conditions)
+	}
+	if got := fmt.Sprint(search.args); got != "[%de Kipf% 2023 100 rag]" {
+		t.Errorf("Unexpected arguments %s", got)
+	}
+	if len(search.terms) != 2 || search.terms[0] != (searchTerm{"exact phrase", true}) || search.terms[1] != (searchTerm{"graph", false}) {
+		t.Errorf("Unexpected terms %+v", search.terms)
+	}
+
+	for _, invalid := range []string{
+		`"unterminated`,
+		"author:",
+		"year:recent",
+		"cites:>=-1",
+		"has:slides",
+		"source:nature",
+		"venue:acl",
+		"tag:c#",
+	} {
+		var queryErr *QueryError
+		if _, err := parseSearch(invalid); !errors.As(err, &queryErr) {
+			t.Errorf("Expected a QueryError for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestHighlightHTML(t *testing.T) {
+	got := highlightHTML("<b>" + matchStart + "Graph" + matchEnd + "</b> & more")
+	want := `&lt;b&gt;<mark class="highlight">Graph</mark>&lt;/b&gt; &amp; more`
+	if string(got) != want {
+		t.Errorf("highlightHTML = %q; want %q", got, want)
+	}
+}
+
+func TestSearchPapers(t *testing.T) {
+	server, _ := newTestServer(t)
+	if !server.search {
+		t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+	}
+
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, arxiv_summary, authors, timestamp) VALUES
+			('http://a', 'Mining Graphs', 10, 'We mine graphs.', 'Ada Lovelace', '2024-03-23 10:00:00'),
+			('http://b', 'Mining Graphs of Citations', 5000, 'A method for mining large graphs.', 'Alan Turing', '2024-03-23 10:00:00'),
+			('http://c', 'Unrelated', 100, 'Nothing to see.', 'Grace Hopper', '2024-03-23 10:00:00')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.db.Exec(`INSERT INTO paper_tags (url, tag) VALUES ('http://c', 'graphs')`); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query PaperQuery) []PaperView {
+		t.Helper()
+		query.Page, query.PageSize = 1, 10
+		papers, total, err := server.getPapers(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != len(papers) {
+			t.Errorf("Expected a total of %d, got %d", len(papers), total)
+		}
+		return papers
+	}
+	titles := func(papers []PaperView) string {
+		var titles []string
+		for _, paper := range papers {
+			titles = append(titles, paper.Title)
+		}
+		return strings.Join(titles, ", ")
+	}
+
+	// Stemmed, ranked by relevance with title matches first
+	papers := search(PaperQuery{Search: "mining graph"})
+	if got := titles(papers); got != "Mining Graphs, Mining Graphs of Citations" {
+		t.Errorf("Unexpected results %q", got)
+	}
+	if !strings.Contains(string(papers[0].TitleHighlighted), `<mark class="highlight">Mining</mark>`) {
+		t.Errorf("Expected the title to be highlighted, got %q", papers[0].TitleHighlighted)
+	}
+	if !strings.Contains(string(papers[1].Snippet), `<mark class="highlight">mining</mark>`) {
+		t.Errorf("Expected the abstract to be highlighted, got %q", papers[1].Snippet)
+	}
+
+	// Citations move a well cited paper up
+	if got := titles(search(PaperQuery{Search: "mining graph", Rank: "blend"})); got != "Mining Graphs of Citations, Mining Graphs" {
+		t.Errorf("Unexpected blended results %q", got)
+	}
+
+	// Authors and tags are searched, the last word as a prefix
+	if got := titles(search(PaperQuery{Search: "lovel"})); got != "Mining Graphs" {
+		t.Errorf("Unexpected author results %q", got)
+	}
+	papers = search(PaperQuery{Search: "graphs"})
+	if len(papers) != 3 {
+		t.Fatalf("Expected the tagged paper to match, got %q", titles(papers))
+	}
+	for _, paper := range papers {
+		if paper.Title == "Unrelated" && paper.Snippet != "" {
+			t.Errorf("Expected no snippet without a match in the abstract, got %q", paper.Snippet)
+		}
+	}
+	// Ranked results page on with a cursor too
+	_, response, _ := getPapersAPI(t, server, "/api/v1/papers?q=graphs&limit=2")
+	_, next, _ := getPapersAPI(t, server, "/api/v1/papers?q=graphs&limit=2&cursor="+response.NextCursor)
+	if len(response.Papers) != 2 || len(next.Papers) != 1 || next.NextCursor != "" || next.Papers[0]["Title"] != papers[2].Title {
+		t.Errorf("Expected the last result on the second page, got %v then %v", response.Papers, next.Papers)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	_, err := server.db.Exec(`
+		INSERT INTO paper_cache (url, title, citations, arxiv_summary, authors, code_url, year, timestamp) VALUES
+			('https://arxiv.org/abs/1609.02907', 'Graph Convolutional Networks', 30000, 'Semi-supervised classification.', 'Thomas N. Kipf, Max Welling', 'https://github.com/tkipf/gcn', 2016, '2024-03-23 10:00:00'),
+			('https://aclanthology.org/2023.acl-long.1', 'Retrieval for Graphs', 50, 'Retrieval augmented 100% graphs.', 'Ada Lovelace', NULL, 2023, '2024-03-23 10:00:00'),
+			('https://example.com/paper', 'Other Graphs', NULL, NULL, NULL, NULL, NULL, '2024-03-23 10:00:00')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.db.Exec(`INSERT INTO paper_tags (url, tag) VALUES ('https://aclanthology.org/2023.acl-long.1', 'rag')`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"author:kipf", "Graph Convolutional Networks"},
+		{"year:>=2020", "Retrieval for Graphs"},
+		{"year:2016 has:code", "Graph Convolutional Networks"},
+		{"cites:>100", "Graph Convolutional Networks"},
+		{"cites:<=100", "Retrieval for Graphs"},
+		{"tag:RAG graphs", "Retrieval for Graphs"},
+		{"source:acl", "Retrieval for Graphs"},
+		{"source:other", "Other Graphs"},
+		{"has:abstract source:arxiv", "Graph Convolutional Networks"},
+		{`"retrieval augmented"`, "Retrieval for Graphs"},
+		{"100%", "Retrieval for Graphs"},
+		{"author:kipf year:2023", ""},
+	}
+	for _, tt := range tests {
+		papers, total, err := server.getPapers(PaperQuery{Page: 1, PageSize: 10, Search: tt.query})
+		if err != nil {
+			t.Errorf("getPapers(%q) failed: %v", tt.query, err)
+			continue
+		}
+		var titles []string
+		for _, paper := range papers {
+			titles = append(titles, paper.Title)
+		}
+		if got := strings.Join(titles, ", "); got != tt.want || total != len(papers) {
+			t.Errorf("getPapers(%q) = %q (total %d); want %q", tt.query, got, total, tt.want)
+		}
+	}
+
+	papers, _, _ := server.getPapers(PaperQuery{Page: 1, PageSize: 10, Search: "author:kipf"})
+	if len(papers) != 1 || papers[0].Year != 2016 || papers[0].CodeURL != "https://github.com/tkipf/gcn" {
+		t.Errorf("Expected the year and code link, got %+v", papers)
+	}
+
+	// Invalid queries are a bad request, explained
+	req := httptest.NewRequest("GET", "/api/papers?q=year:soon", nil)
+	w := httptest.NewRecorder()
+	server.handlePapersAPI(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "year:soon") {
+		t.Errorf("Expected status 400 explaining the error; got %d: %s", w.Code, w.Body)
+	}
+	req = httptest.NewRequest("GET", "/?q=year:soon", nil)
+	w = httptest.NewRecorder()
+	server.handleIndex(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `id="searchInput"`) || !strings.Contains(w.Body.String(), "invalid query: year:soon") {
+		t.Errorf("Expected the page with the error; got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/papers?q=source:acl", nil)
+	w = httptest.NewRecorder()
+	server.handlePapersAPI(w, req)
+	var response struct {
+		Count int `json:"count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Count != 1 {
+		t.Errorf("Expected one paper from the API, got %s", w.Body)
+	}
+}
@@ -11,6 +11,21 @@ function debounce(func, wait) {
     };
 }
 
+// Path of a page of the server, under the path it is mounted at
+function basePath(path) {
+    return (document.body.dataset.base || '') + path;
+}
+
+// Whether papers can't be added or refreshed on this server
+function isReadOnly() {
+    return document.body.dataset.readOnly !== undefined;
+}
+
+// Whether the user has given the name they annotate papers as
+function canAnnotate() {
+    return !isReadOnly() && Boolean(document.body.dataset.user);
+}
+
 // Update URL with search parameters
 function updateURL(searchQuery, page) {
     const url = new URL(window.location);
@@ -27,6 +42,53 @@ function updateURL(searchQuery, page) {
     window.history.pushState({}, '', url);
 }
 
+// Link to a page of the current listing, keeping its search, sort and filters
+function listingURL(page) {
+    const params = new URLSearchParams(window.location.search);
+    if (page > 1) {
+        params.set('page', page);
+    } else {
+        params.delete('page');
+    }
+    const search = params.toString();
+    return search ? '?' + search : '?';
+}
+
+// Point the sort and export links and the filter form at the current search
+function updateListingLinks(searchQuery) {
+    document.querySelectorAll('a.sort-link').forEach(link => {
+        const url = new URL(link.href, window.location.href);
+        if (searchQuery) {
+            url.searchParams.set('q', searchQuery);
+        } else {
+            url.searchParams.delete('q');
+        }
+        link.href = url.search || '?';
+    });
+    document.querySelectorAll('a.export-link').forEach(link => {
+        const url = new URL(link.href, window.location.href);
+        if (searchQuery) {
+            url.searchParams.set('q', searchQuery);
+        } else {
+            url.searchParams.delete('q');
+        }
+        link.href = url.pathname + url.search;
+    });
+
+    const form = document.getElementById('filterForm');
+    if (form) {
+        let input = form.querySelector('input[name="q"]');
+        if (!input) {
+            input = document.createElement('input');
+            input.type = 'hidden';
+            input.name = 'q';
+            form.prepend(input);
+        }
+        input.value = searchQuery;
+        input.disabled = !searchQuery;
+    }
+}
+
 // Setup abstract expansion functionality
 function setupAbstractExpansion() {
     document.querySelectorAll('.abstract-container').forEach(container => {
@@ -36,26 +98,135 @@ function setupAbstractExpansion() {
         const query = new URLSearchParams(window.location.search).get('q');
 
         if (button) {
-            // Store initial text for collapsing
+            // A snippet highlighted by the server is restored as is when
+            // collapsing; otherwise the first sentence is shown
+            const serverHighlight = firstSentence.hasAttribute('data-server-highlight');
+            const initialHTML = firstSentence.innerHTML;
             const initialText = firstSentence.textContent.split('.')[0] + '.';
-            firstSentence.textContent = initialText;
+            if (!serverHighlight) {
+                firstSentence.textContent = initialText;
+            }
             button.textContent = '...';
+            let expanded = false;
 
             button.addEventListener('click', function() {
-                if (firstSentence.textContent === fullText) {
+                if (expanded) {
                     // Collapse - show first sentence and ...
-                    firstSentence.textContent = initialText;
+                    if (serverHighlight) {
+                        firstSentence.innerHTML = initialHTML;
+                    } else {
+                        firstSentence.textContent = initialText;
+                    }
                     button.textContent = '...';
+                    expanded = false;
                 } else {
                     // Expand - show full text with highlighting
                     firstSentence.innerHTML = highlightText(fullText, query);
                     button.textContent = 'Show less';
+                    expanded = true;
                 }
             });
         }
     });
 }
 
+// Setup per-paper refresh buttons: queue a refresh job and poll it until
+// it finishes, then show the new citation count
+function setupRefreshButtons() {
+    document.querySelectorAll('.refresh-form').forEach(form => {
+        form.addEventListener('submit', function(e) {
+            e.preventDefault();
+            const button = form.querySelector('.refresh-button');
+            const url = form.querySelector('input[name="url"]').value;
+            button.disabled = true;
+            button.textContent = 'Queued...';
+
+            return fetch(basePath('/api/v1/refresh'), {
+                method: 'POST',
+                body: new URLSearchParams({ url: url })
+            })
+                .then(response => {
+                    if (!response.ok) {
+                        throw new Error('refresh failed with status ' + response.status);
+                    }
+                    return response.json();
+                })
+                .then(job => pollJob(job.id, form))
+                .catch(error => {
+                    console.error('Error:', error);
+                    button.textContent = 'Refresh failed';
+                    button.disabled = false;
+                });
+        });
+    });
+}
+
+// Poll a refresh job until it finishes and update the paper's row
+function pollJob(id, form, interval = 2000) {
+    const button = form.querySelector('.refresh-button');
+    return fetch(basePath(`/api/v1/jobs/${encodeURIComponent(id)}`))
+        .then(response => response.json())
+        .then(job => {
+            if (job.status === 'queued' || job.status === 'running') {
+                button.textContent = job.status === 'running' ? 'Refreshing...' : 'Queued...';
+                return new Promise(resolve => setTimeout(resolve, interval))
+                    .then(() => pollJob(id, form, interval));
+            }
+
+            button.disabled = false;
+            if (job.status === 'succeeded') {
+                button.textContent = 'Refreshed';
+                const count = form.closest('tr').querySelector('.citation-count');
+                if (count && job.citations !== undefined) {
+                    count.textContent = job.citations;
+                }
+            } else {
+                button.textContent = 'Refresh failed';
+                button.title = job.error || '';
+            }
+        });
+}
+
+// Setup the add paper form: add the paper through the API and show it,
+// or show why it was rejected
+function setupAddPaperForm() {
+    const form = document.getElementById('addPaperForm');
+    if (!form) return;
+    const status = document.getElementById('addPaperStatus');
+
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+        status.textContent = 'Adding...';
+
+        return fetch(basePath('/api/v1/papers'), {
+            method: 'POST',
+            body: new URLSearchParams(new FormData(form))
+        })
+            .then(response => response.json().then(data => {
+                if (!response.ok) {
+                    throw new Error(data.error);
+                }
+                return data;
+            }))
+            .then(data => {
+                status.textContent = 'Added ' + data.paper.title + ', fetching citations...';
+                form.reset();
+                const query = new URLSearchParams(window.location.search).get('q') || '';
+                return performSearch(query);
+            })
+            .catch(error => {
+                status.textContent = error.message;
+            });
+    });
+}
+
+// Escape text for use in HTML
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 // Function to highlight text
 function highlightText(text, query) {
     if (!query || !text) return text;
@@ -90,10 +261,19 @@ function performSearch(query) {
     const tbody = document.querySelector('tbody');
     tbody.innerHTML = '<tr><td colspan="3" class="px-4 py-3 text-center">Loading...</td></tr>';
 
-    // Fetch data from API
-    return fetch(`/api/papers?q=${encodeURIComponent(query)}&page=1`)
+    updateListingLinks(query);
+
+    // Fetch data from API, keeping the ranking, sort and filters in the URL
+    return fetch(basePath('/api/v1/papers') + listingURL(1))
         .then(response => response.json())
         .then(data => {
+            // An invalid query comes back with the error to show
+            if (data.error) {
+                tbody.innerHTML = '<tr><td colspan="3" class="query-error px-4 py-3 text-center text-red-500">' +
+                    escapeHTML(data.error) + '</td></tr>';
+                return;
+            }
+
             // Update table body
             if (data.papers.length === 0) {
                 tbody.innerHTML = '<tr>' +
@@ -105,23 +285,55 @@ function performSearch(query) {
                 tbody.innerHTML = data.papers.map(paper => `
                     <tr>
                         <td class="px-4 py-3">
+                            ${paper.TitleHighlighted ? `
+                            <div class="text-lg font-medium text-gray-900" data-server-highlight>${paper.TitleHighlighted}</div>
+                            ` : `
                             <div class="text-lg font-medium text-gray-900">${highlightText(paper.Title, query)}</div>
+                            `}
+                            ${paper.Authors || paper.Year ? `<div class="authors text-sm text-gray-500">${[paper.Authors, paper.Year].filter(Boolean).join(' · ')}</div>` : ''}
+                            ${paper.Tags && paper.Tags.length ? `
+                            <div class="mt-1 flex gap-1">${paper.Tags.map(tag => `<span class="tag text-xs text-gray-600">${tag}</span>`).join('')}</div>
+                            ` : ''}
+                            ${paper.Note ? `<div class="note mt-1 text-sm text-gray-700">Note: ${escapeHTML(paper.Note)}</div>` : ''}
                             ${paper.ArxivSummary ? `
                             <div class="mt-2 abstract-container">
+                                ${paper.Snippet ? `
+                                <span class="text-sm text-gray-600" data-server-highlight>${paper.Snippet}</span>
+                                ` : `
                                 <span class="text-sm text-gray-600">${highlightText(paper.FirstSentence, query)}</span>
+                                `}
                                 <button class="expand-button ml-2">...</button>
                                 <div class="abstract-text" style="display: none;">${highlightText(paper.ArxivSummary, query)}</div>
                             </div>
                             ` : ''}
                         </td>
                         <td class="px-4 py-3">
-                            <div class="citation-count text-sm text-gray-900">${paper.Citations || 0}</div>
+                            <div class="citation-count text-sm text-gray-900">${paper.Pending ? 'pending' : paper.Citations || 0}</div>
+                            ${paper.Stars ? `<div class="stars text-xs text-gray-500" title="Starred by ${paper.Stars}">★ ${paper.Stars}</div>` : ''}
                         </td>
                         <td class="px-4 py-3">
                             <div class="flex flex-col gap-1">
+                                <a href="${basePath(`/paper/${paper.ID}`)}" class="details-link text-sm text-gray-600 hover:text-gray-900">Details</a>
                                 <a href="${paper.URL}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">Paper</a>
                                 ${paper.ArxivAbsURL ? `<a href="${paper.ArxivAbsURL}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">arXiv</a>` : ''}
                                 ${paper.GoogleScholarURL ? `<a href="${paper.GoogleScholarURL}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">Scholar</a>` : ''}
+                                ${paper.CodeURL ? `<a href="${paper.CodeURL}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">Code</a>` : ''}
+                                ${isReadOnly() ? '' : `
+                                <form method="post" action="${basePath('/refresh')}" class="refresh-form">
+                                    <input type="hidden" name="url" value="${paper.URL}">
+                                    <button type="submit" class="refresh-button text-sm text-gray-600 hover:text-gray-900">Refresh</button>
+                                </form>
+                                `}
+                                ${canAnnotate() ? `
+                                <form method="post" action="${basePath(`/paper/${paper.ID}/annotations`)}" class="annotate-form">
+                                    <input type="hidden" name="starred" value="${!paper.Starred}">
+                                    <button type="submit" class="star-button text-sm text-gray-600 hover:text-gray-900">${paper.Starred ? 'Unstar' : 'Star'}</button>
+                                </form>
+                                <form method="post" action="${basePath(`/paper/${paper.ID}/annotations`)}" class="annotate-form">
+                                    <input type="hidden" name="read" value="${!paper.Read}">
+                                    <button type="submit" class="read-button text-sm text-gray-600 hover:text-gray-900">${paper.Read ? 'Mark unread' : 'Mark read'}</button>
+                                </form>
+                                ` : ''}
                             </div>
                         </td>
                     </tr>
@@ -132,7 +344,7 @@ function performSearch(query) {
             const paginationContainer = document.getElementById('paginationContainer');
             paginationContainer.innerHTML = `
                 ${data.currentPage > 1 ? `
-                <a href="?page=${data.currentPage - 1}${query ? '&q=' + encodeURIComponent(query) : ''}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
+                <a href="${listingURL(data.currentPage - 1)}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
                     Previous
                 </a>
                 ` : ''}
@@ -140,7 +352,7 @@ function performSearch(query) {
                     Page ${data.currentPage} of ${data.totalPages}
                 </span>
                 ${data.currentPage < data.totalPages ? `
-                <a href="?page=${data.currentPage + 1}${query ? '&q=' + encodeURIComponent(query) : ''}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
+                <a href="${listingURL(data.currentPage + 1)}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
                     Next
                 </a>
                 ` : ''}
@@ -148,6 +360,7 @@ function performSearch(query) {
 
             // Re-setup abstract expansion
             setupAbstractExpansion();
+            setupRefreshButtons();
         })
         .catch(error => {
             console.error('Error:', error);
@@ -159,18 +372,20 @@ function performSearch(query) {
 document.addEventListener('DOMContentLoaded', function() {
     // Setup abstract expansion functionality
     setupAbstractExpansion();
+    setupRefreshButtons();
+    setupAddPaperForm();
 
     // Add highlighting to initial page load
     const url = new URL(window.location);
     const query = url.searchParams.get('q');
     if (query) {
         // Highlight text in all paper titles
-        document.querySelectorAll('.text-lg.font-medium').forEach(title => {
+        document.querySelectorAll('.text-lg.font-medium:not([data-server-highlight])').forEach(title => {
             title.innerHTML = highlightText(title.textContent, query);
         });
 
         // Highlight text in all first sentences
-        document.querySelectorAll('.abstract-container .text-gray-600').forEach(sentence => {
+        document.querySelectorAll('.abstract-container .text-gray-600:not([data-server-highlight])').forEach(sentence => {
             sentence.innerHTML = highlightText(sentence.textContent, query);
         });
 
@@ -189,37 +404,12 @@ document.addEventListener('DOMContentLoaded', function() {
             const searchInput = document.getElementById('searchInput');
             searchInput.value = '';
             // Update URL to home page
-            window.history.pushState({}, '', '/');
+            window.history.pushState({}, '', basePath('/'));
             // Perform empty search to reset results
             performSearch('');
         });
     }
 
-    // Add sorting functionality
-    const table = document.querySelector('table');
-    const headers = table.querySelectorAll('th');
-
-    headers.forEach(header => {
-        if (header.textContent === 'Citations') {
-            header.style.cursor = 'pointer';
-            header.addEventListener('click', function() {
-                const tbody = table.querySelector('tbody');
-                const rows = Array.from(tbody.querySelectorAll('tr'));
-
-                const isAscending = header.getAttribute('data-sort') === 'asc';
-                header.setAttribute('data-sort', isAscending ? 'desc' : 'asc');
-
-                rows.sort((a, b) => {
-                    const aCitations = parseInt(a.querySelector('.citation-count').textContent) || 0;
-                    const bCitations = parseInt(b.querySelector('.citation-count').textContent) || 0;
-                    return isAscending ? aCitations - bCitations : bCitations - aCitations;
-                });
-
-                rows.forEach(row => tbody.appendChild(row));
-            });
-        }
-    });
-
     // Setup search input
     const searchInput = document.getElementById('searchInput');
     const debouncedSearch = debounce((query) => {
@@ -242,8 +432,17 @@ document.addEventListener('DOMContentLoaded', function() {
 // Export functions for testing
 module.exports = {
     highlightText,
+    basePath,
+    isReadOnly,
+    canAnnotate,
+    listingURL,
+    updateListingLinks,
+    escapeHTML,
     updateURL,
     setupAbstractExpansion,
+    setupRefreshButtons,
+    setupAddPaperForm,
+    pollJob,
     performSearch,
     debounce
 };
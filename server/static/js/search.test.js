@@ -4,12 +4,47 @@ require('@testing-library/jest-dom');
 // Import functions to test
 const {
     highlightText,
+    basePath,
+    isReadOnly,
+    canAnnotate,
+    listingURL,
+    updateListingLinks,
+    escapeHTML,
     updateURL,
     setupAbstractExpansion,
+    setupRefreshButtons,
+    setupAddPaperForm,
+    pollJob,
     performSearch,
     debounce
 } = require('./search.js');
 
+// Mock fetch to answer each call with the next response
+function mockResponses(...responses) {
+    global.fetch = jest.fn();
+    responses.forEach(({ ok = true, data }) => {
+        global.fetch.mockImplementationOnce(() =>
+            Promise.resolve({
+                ok: ok,
+                status: ok ? 200 : 400,
+                json: () => Promise.resolve(data)
+            })
+        );
+    });
+}
+
+// Let the promises of event handlers settle
+function flushPromises() {
+    return new Promise(resolve => setTimeout(resolve, 0));
+}
+
+// Clear what the page tells the script about the server and the user
+function resetBody() {
+    delete document.body.dataset.base;
+    delete document.body.dataset.readOnly;
+    delete document.body.dataset.user;
+}
+
 // Mock the DOM environment
 document.body.innerHTML = `
     <div class="flex justify-between items-center mb-8">
@@ -139,6 +174,80 @@ describe('setupAbstractExpansion', () => {
     });
 });
 
+// Test basePath, isReadOnly and canAnnotate functions
+describe('server and user settings', () => {
+    afterEach(resetBody);
+
+    test('should put paths under the base the server is mounted at', () => {
+        expect(basePath('/api/v1/papers')).toBe('/api/v1/papers');
+        document.body.dataset.base = '/graphs';
+        expect(basePath('/api/v1/papers')).toBe('/graphs/api/v1/papers');
+    });
+
+    test('should be read-only when the page says so', () => {
+        expect(isReadOnly()).toBe(false);
+        document.body.dataset.readOnly = '';
+        expect(isReadOnly()).toBe(true);
+    });
+
+    test('should annotate only as a named user of a writable server', () => {
+        expect(canAnnotate()).toBe(false);
+        document.body.dataset.user = 'bob';
+        expect(canAnnotate()).toBe(true);
+        document.body.dataset.readOnly = '';
+        expect(canAnnotate()).toBe(false);
+    });
+});
+
+// Test listingURL and updateListingLinks functions
+describe('listing links', () => {
+    beforeEach(() => {
+        delete window.location;
+        window.location = new URL('http://localhost/?q=graph&sort=title&page=2');
+        document.body.innerHTML = `
+            <a class="sort-link" href="?sort=citations&q=old">Citations</a>
+            <a class="export-link" href="/graphs/export?format=csv&q=old">CSV</a>
+            <form id="filterForm">
+                <input type="number" name="min_citations">
+            </form>
+        `;
+    });
+
+    test('should keep the search, sort and filters of the listing', () => {
+        expect(listingURL(1)).toBe('?q=graph&sort=title');
+        expect(listingURL(3)).toBe('?q=graph&sort=title&page=3');
+
+        window.location = new URL('http://localhost/');
+        expect(listingURL(1)).toBe('?');
+    });
+
+    test('should point the sort, export and filter links at the search', () => {
+        updateListingLinks('graph');
+        expect(document.querySelector('.sort-link').getAttribute('href')).toBe('?sort=citations&q=graph');
+        expect(document.querySelector('.export-link').getAttribute('href')).toBe('/graphs/export?format=csv&q=graph');
+        const input = document.querySelector('#filterForm input[name="q"]');
+        expect(input.type).toBe('hidden');
+        expect(input.value).toBe('graph');
+        expect(input.disabled).toBe(false);
+    });
+
+    test('should drop the search from the links when it is cleared', () => {
+        updateListingLinks('graph');
+        updateListingLinks('');
+        expect(document.querySelector('.sort-link').getAttribute('href')).toBe('?sort=citations');
+        expect(document.querySelector('.export-link').getAttribute('href')).toBe('/graphs/export?format=csv');
+        expect(document.querySelectorAll('#filterForm input[name="q"]')).toHaveLength(1);
+        expect(document.querySelector('#filterForm input[name="q"]').disabled).toBe(true);
+    });
+});
+
+// Test escapeHTML function
+describe('escapeHTML', () => {
+    test('should escape markup', () => {
+        expect(escapeHTML('<b>Graphs</b> & more')).toBe('&lt;b&gt;Graphs&lt;/b&gt; &amp; more');
+    });
+});
+
 // Test performSearch function
 describe('performSearch', () => {
     beforeEach(() => {
@@ -224,6 +333,272 @@ describe('performSearch', () => {
     });
 });
 
+// Test how performSearch renders papers
+describe('performSearch rendering', () => {
+    const paper = {
+        ID: 7,
+        Title: 'Graph Networks',
+        URL: 'http://gnn',
+        Citations: 30,
+        Authors: 'Ada Lovelace',
+        Year: 2024,
+        Tags: ['graphs'],
+        CodeURL: 'https://github.com/gnn',
+        Stars: 3,
+        Starred: true,
+        Read: false,
+        Note: '<b>mine</b>'
+    };
+
+    beforeEach(() => {
+        delete window.location;
+        window.location = new URL('http://localhost/?q=graph&sort=title&page=2');
+        document.body.innerHTML = `
+            <div id="paginationContainer"></div>
+            <table>
+                <tbody></tbody>
+            </table>
+        `;
+    });
+
+    afterEach(resetBody);
+
+    test('should fetch the listing of the URL under the base', async () => {
+        document.body.dataset.base = '/graphs';
+        mockResponses({ data: { papers: [paper], currentPage: 2, totalPages: 3 } });
+
+        await performSearch('graph');
+        expect(global.fetch).toHaveBeenCalledWith('/graphs/api/v1/papers?q=graph&sort=title');
+        expect(document.querySelector('.details-link').getAttribute('href')).toBe('/graphs/paper/7');
+        const links = document.querySelectorAll('#paginationContainer a');
+        expect(links[0].getAttribute('href')).toBe('?q=graph&sort=title');
+        expect(links[1].getAttribute('href')).toBe('?q=graph&sort=title&page=3');
+    });
+
+    test('should show the authors, tags, code, stars and escaped note', async () => {
+        mockResponses({ data: { papers: [paper], currentPage: 1, totalPages: 1 } });
+
+        await performSearch('graph');
+        const tbody = document.querySelector('tbody');
+        expect(tbody.querySelector('.authors').textContent).toBe('Ada Lovelace · 2024');
+        expect(tbody.querySelector('.tag').textContent).toBe('graphs');
+        expect(tbody.querySelector('a[href="https://github.com/gnn"]').textContent).toBe('Code');
+        expect(tbody.querySelector('.stars').textContent).toBe('★ 3');
+        expect(tbody.querySelector('.note').innerHTML).toBe('Note: &lt;b&gt;mine&lt;/b&gt;');
+    });
+
+    test('should show pending papers without a count', async () => {
+        mockResponses({ data: { papers: [{ ...paper, Pending: true, Citations: 0 }], currentPage: 1, totalPages: 1 } });
+
+        await performSearch('graph');
+        expect(document.querySelector('.citation-count').textContent).toBe('pending');
+    });
+
+    test('should keep the highlighting of the server', async () => {
+        mockResponses({
+            data: {
+                papers: [{
+                    ...paper,
+                    ArxivSummary: 'We mine graphs. More.',
+                    FirstSentence: 'We mine graphs.',
+                    TitleHighlighted: '<mark class="highlight">Graph</mark> Networks',
+                    Snippet: 'We mine <mark class="highlight">graphs</mark>'
+                }],
+                currentPage: 1,
+                totalPages: 1
+            }
+        });
+
+        await performSearch('graph');
+        const title = document.querySelector('.text-lg[data-server-highlight]');
+        expect(title.innerHTML).toBe('<mark class="highlight">Graph</mark> Networks');
+        const snippet = document.querySelector('.abstract-container span[data-server-highlight]');
+        expect(snippet.innerHTML).toBe('We mine <mark class="highlight">graphs</mark>');
+    });
+
+    test('should show why a query is invalid', async () => {
+        mockResponses({ data: { error: 'unknown field <year>' } });
+
+        await performSearch('year:>x');
+        const error = document.querySelector('.query-error');
+        expect(error.textContent).toBe('unknown field <year>');
+        expect(error.innerHTML).toBe('unknown field &lt;year&gt;');
+    });
+
+    test('should offer refresh but not annotations to an unnamed user', async () => {
+        mockResponses({ data: { papers: [paper], currentPage: 1, totalPages: 1 } });
+
+        await performSearch('graph');
+        expect(document.querySelector('.refresh-form').getAttribute('action')).toBe('/refresh');
+        expect(document.querySelector('.annotate-form')).toBeNull();
+    });
+
+    test('should offer annotations to a named user', async () => {
+        document.body.dataset.base = '/graphs';
+        document.body.dataset.user = 'bob';
+        mockResponses({ data: { papers: [paper], currentPage: 1, totalPages: 1 } });
+
+        await performSearch('graph');
+        const forms = document.querySelectorAll('.annotate-form');
+        expect(forms).toHaveLength(2);
+        expect(forms[0].getAttribute('action')).toBe('/graphs/paper/7/annotations');
+        expect(forms[0].querySelector('input[name="starred"]').value).toBe('false');
+        expect(forms[0].querySelector('.star-button').textContent).toBe('Unstar');
+        expect(forms[1].querySelector('input[name="read"]').value).toBe('true');
+        expect(forms[1].querySelector('.read-button').textContent).toBe('Mark read');
+    });
+
+    test('should offer neither refresh nor annotations when read-only', async () => {
+        document.body.dataset.readOnly = '';
+        document.body.dataset.user = 'bob';
+        mockResponses({ data: { papers: [paper], currentPage: 1, totalPages: 1 } });
+
+        await performSearch('graph');
+        expect(document.querySelector('.refresh-form')).toBeNull();
+        expect(document.querySelector('.annotate-form')).toBeNull();
+    });
+});
+
+// Test expanding abstracts the server highlighted
+describe('setupAbstractExpansion with server highlighting', () => {
+    beforeEach(() => {
+        document.body.innerHTML = `
+            <div class="abstract-container">
+                <span class="text-gray-600" data-server-highlight>We mine <mark class="highlight">graphs</mark></span>
+                <button class="expand-button">...</button>
+                <div class="abstract-text" style="display: none;">We mine graphs. More.</div>
+            </div>
+        `;
+    });
+
+    test('should restore the highlighted snippet when collapsing', () => {
+        setupAbstractExpansion();
+        const button = document.querySelector('.expand-button');
+        const snippet = document.querySelector('.text-gray-600');
+        expect(snippet.innerHTML).toBe('We mine <mark class="highlight">graphs</mark>');
+
+        button.click();
+        expect(snippet.textContent).toBe('We mine graphs. More.');
+        button.click();
+        expect(snippet.innerHTML).toBe('We mine <mark class="highlight">graphs</mark>');
+        expect(button.textContent).toBe('...');
+    });
+});
+
+// Test refreshing a paper from its row
+describe('refresh buttons', () => {
+    beforeEach(() => {
+        document.body.innerHTML = `
+            <table>
+                <tbody>
+                    <tr>
+                        <td><div class="citation-count">30</div></td>
+                        <td>
+                            <form class="refresh-form">
+                                <input type="hidden" name="url" value="http://gnn">
+                                <button type="submit" class="refresh-button">Refresh</button>
+                            </form>
+                        </td>
+                    </tr>
+                </tbody>
+            </table>
+        `;
+        jest.spyOn(console, 'error').mockImplementation(() => {});
+    });
+
+    afterEach(() => {
+        console.error.mockRestore();
+        resetBody();
+    });
+
+    test('should queue a refresh and show the new count', async () => {
+        document.body.dataset.base = '/graphs';
+        mockResponses({ data: { id: '1', status: 'queued' } }, { data: { id: '1', status: 'succeeded', citations: 42 } });
+        setupRefreshButtons();
+
+        document.querySelector('.refresh-form').dispatchEvent(new Event('submit', { cancelable: true }));
+        expect(document.querySelector('.refresh-button').disabled).toBe(true);
+        await flushPromises();
+
+        expect(global.fetch.mock.calls[0][0]).toBe('/graphs/api/v1/refresh');
+        expect(global.fetch.mock.calls[0][1].body.get('url')).toBe('http://gnn');
+        expect(global.fetch.mock.calls[1][0]).toBe('/graphs/api/v1/jobs/1');
+        expect(document.querySelector('.citation-count').textContent).toBe('42');
+        expect(document.querySelector('.refresh-button').textContent).toBe('Refreshed');
+        expect(document.querySelector('.refresh-button').disabled).toBe(false);
+    });
+
+    test('should show when the refresh is refused', async () => {
+        mockResponses({ ok: false, data: { error: 'Read-only' } });
+        setupRefreshButtons();
+
+        document.querySelector('.refresh-form').dispatchEvent(new Event('submit', { cancelable: true }));
+        await flushPromises();
+
+        expect(document.querySelector('.refresh-button').textContent).toBe('Refresh failed');
+        expect(document.querySelector('.citation-count').textContent).toBe('30');
+    });
+
+    test('should poll a job until it finishes', async () => {
+        mockResponses(
+            { data: { id: '2', status: 'running' } },
+            { data: { id: '2', status: 'failed', error: 'rate limited' } }
+        );
+
+        await pollJob('2', document.querySelector('.refresh-form'), 0);
+        expect(global.fetch).toHaveBeenCalledTimes(2);
+        const button = document.querySelector('.refresh-button');
+        expect(button.textContent).toBe('Refresh failed');
+        expect(button.title).toBe('rate limited');
+    });
+});
+
+// Test adding a paper
+describe('setupAddPaperForm', () => {
+    beforeEach(() => {
+        delete window.location;
+        window.location = new URL('http://localhost/');
+        document.body.innerHTML = `
+            <form id="addPaperForm">
+                <input type="text" name="url" value="2311.09862">
+                <button type="submit">Add paper</button>
+            </form>
+            <div id="addPaperStatus"></div>
+            <div id="paginationContainer"></div>
+            <table>
+                <tbody></tbody>
+            </table>
+        `;
+    });
+
+    test('should add the paper and show the listing again', async () => {
+        mockResponses(
+            { data: { paper: { title: 'arXiv:2311.09862' } } },
+            { data: { papers: [], currentPage: 1, totalPages: 1 } }
+        );
+        setupAddPaperForm();
+
+        document.getElementById('addPaperForm').dispatchEvent(new Event('submit', { cancelable: true }));
+        await flushPromises();
+
+        expect(global.fetch.mock.calls[0][0]).toBe('/api/v1/papers');
+        expect(global.fetch.mock.calls[0][1].body.get('url')).toBe('2311.09862');
+        expect(global.fetch.mock.calls[1][0]).toBe('/api/v1/papers?');
+        expect(document.getElementById('addPaperStatus').textContent).toBe('Added arXiv:2311.09862, fetching citations...');
+    });
+
+    test('should show why the paper was rejected', async () => {
+        mockResponses({ ok: false, data: { error: 'The paper is already stored' } });
+        setupAddPaperForm();
+
+        document.getElementById('addPaperForm').dispatchEvent(new Event('submit', { cancelable: true }));
+        await flushPromises();
+
+        expect(global.fetch).toHaveBeenCalledTimes(1);
+        expect(document.getElementById('addPaperStatus').textContent).toBe('The paper is already stored');
+    });
+});
+
 // Test header link functionality
 describe('Header Link', () => {
     beforeEach(() => {
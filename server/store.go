@@ -0,0 +1,46 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// checkSchema makes sure a database has the tables and columns the server
+// uses, which the collector creates and keeps up to date, and reports
+// whether the paper_search index can be used. A writable database with the
+// index needs FTS5, whose triggers would otherwise fail every write.
+func checkSchema(db *sql.DB, writable bool) (bool, error) {
+	probes := []string{
+		`SELECT ` + paperViewColumns + `, paper_cache.added FROM paper_cache LIMIT 0`,
+		`SELECT url, tag FROM paper_tags LIMIT 0`,
+		`SELECT url, source, citations, fetched FROM citation_history LIMIT 0`,
+		`SELECT name, source, synced FROM collections LIMIT 0`,
+		`SELECT collection, url, section, first_seen, last_seen, removed FROM collection_papers LIMIT 0`,
+		`SELECT source, kind, error, attempts, last_failed FROM fetch_failures LIMIT 0`,
+		`SELECT user, url, read, starred, note, updated FROM annotations LIMIT 0`,
+	}
+	for _, probe := range probes {
+		rows, err := db.Query(probe)
+		if err != nil {
+			return false, fmt.Errorf("the database is older than the server, run the collector on it once: %v", err)
+		}
+		rows.Close()
+	}
+
+	var hasFTS5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5: %v", err)
+	}
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'paper_search'").Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for the search index: %v", err)
+	}
+	if writable && !hasFTS5 {
+		if exists > 0 {
+			return false, fmt.Errorf("the database has a full-text index but SQLite was built without FTS5; build with -tags sqlite_fts5")
+		}
+		log.Printf("SQLite was built without FTS5, searching with LIKE; build with -tags sqlite_fts5 for ranked search")
+	}
+	return hasFTS5 && exists > 0, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createSchema creates the database at path with the collector's schema,
+// leaving out the paper_search index when SQLite was built without FTS5
+func createSchema(t *testing.T, path string) {
+	t.Helper()
+	schema, err := os.ReadFile("testdata/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var hasFTS5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5); err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range strings.Split(string(schema), ";\n\n") {
+		if !hasFTS5 && strings.Contains(statement, "paper_search") {
+			continue
+		}
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("failed to create schema: %v", err)
+		}
+	}
+}
+
+func TestNewUIServerChecksSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "papers.db")
+	if _, err := NewUIServer(path); err == nil || !strings.Contains(err.Error(), "run the collector") {
+		t.Errorf("Expected a missing database to be refused, got %v", err)
+	}
+
+	createSchema(t, path)
+	server, err := NewUIServer(path)
+	if err != nil {
+		t.Fatalf("Expected the collector's schema to be enough, got %v", err)
+	}
+	server.Close()
+}
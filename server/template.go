@@ -6,6 +6,9 @@ const indexTemplate = `<!DOCTYPE html>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>Most Cited Papers</title>
+    <link rel="alternate" type="application/atom+xml" title="New papers" href="{{url "/feeds/new.atom"}}">
+    <link rel="alternate" type="application/atom+xml" title="Trending papers" href="{{url "/feeds/trending.atom"}}">
+    {{with .Query.Tag}}<link rel="alternate" type="application/atom+xml" title="New papers tagged {{.}}" href="{{url "/feeds/tags/"}}{{.}}.atom">{{end}}
     <script src="https://cdn.tailwindcss.com"></script>
     <style>
         .citation-count {
@@ -33,19 +36,26 @@ const indexTemplate = `<!DOCTYPE html>
         .search-input {
             width: 300px;
         }
+        .tag {
+            background-color: #f3f4f6;
+            border-radius: 9999px;
+            padding: 0.1em 0.6em;
+        }
         .highlight {
             background-color: #fef08a;
             padding: 0.1em 0.2em;
             border-radius: 0.2em;
         }
     </style>
-    <script src="/static/js/search.js"></script>
+    <script src="{{url "/static/js/search.js"}}"></script>
 </head>
-<body class="bg-white">
+<body class="bg-white" data-base="{{url ""}}"{{if not $.CanEdit}} data-read-only{{end}}{{if .CanAnnotate}} data-user="{{.Query.User}}"{{end}}>
     <div class="max-w-6xl mx-auto px-4 py-6">
         <div class="flex justify-between items-center mb-8">
             <h1 class="text-2xl font-semibold text-gray-900 px-4">
-                <a href="/" class="hover:text-gray-600 transition-colors">Most Cited Papers</a>
+                <a href="{{url "/"}}" class="hover:text-gray-600 transition-colors">Most Cited Papers</a>
+                <a href="{{url "/trending"}}" class="ml-4 text-sm font-normal text-gray-600 hover:text-gray-900">Trending</a>
+                <a href="{{url "/new"}}{{with .Query.Collection}}?collection={{.}}{{end}}" class="ml-2 text-sm font-normal text-gray-600 hover:text-gray-900">New this week</a>
             </h1>
             <div class="flex items-center space-x-2" style="margin-right: 18px;">
                 <div id="searchContainer">
@@ -53,11 +63,12 @@ const indexTemplate = `<!DOCTYPE html>
                            id="searchInput"
                            class="search-input px-4 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
                            placeholder="Search papers..."
+                           title='Words, "phrases" and filters: author:kipf year:>=2023 cites:>100 tag:rag has:code source:arxiv|acl|doi|other'
                            value="{{.SearchQuery}}">
                 </div>
                 <div id="paginationContainer" class="flex items-center space-x-2">
                     {{if gt .CurrentPage 1}}
-                    <a href="?page={{subtract .CurrentPage 1}}{{if .SearchQuery}}&q={{.SearchQuery}}{{end}}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
+                    <a href="{{.Query.PageURL (subtract .CurrentPage 1)}}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
                         Previous
                     </a>
                     {{end}}
@@ -65,7 +76,7 @@ const indexTemplate = `<!DOCTYPE html>
                         Page {{.CurrentPage}} of {{.TotalPages}}
                     </span>
                     {{if lt .CurrentPage .TotalPages}}
-                    <a href="?page={{add .CurrentPage 1}}{{if .SearchQuery}}&q={{.SearchQuery}}{{end}}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
+                    <a href="{{.Query.PageURL (add .CurrentPage 1)}}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">
                         Next
                     </a>
                     {{end}}
@@ -73,33 +84,144 @@ const indexTemplate = `<!DOCTYPE html>
             </div>
         </div>
 
+        {{if .CanEdit}}
+        <form method="post" action="{{url "/papers"}}" id="addPaperForm" class="flex items-center gap-2 mb-6 px-4">
+            <input type="text" name="url" required
+                   class="flex-1 px-3 py-1 text-sm border border-gray-300 rounded-md"
+                   placeholder="arXiv ID, DOI or paper URL">
+            <input type="text" name="title"
+                   class="flex-1 px-3 py-1 text-sm border border-gray-300 rounded-md"
+                   placeholder="Title (optional for arXiv)">
+            <input type="text" name="tags"
+                   class="w-48 px-3 py-1 text-sm border border-gray-300 rounded-md"
+                   placeholder="Tags, comma-separated">
+            <button type="submit" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">Add paper</button>
+            <span id="addPaperStatus" class="text-sm text-gray-600"></span>
+        </form>
+        {{end}}
+
+        {{if .Principal.Name}}
+        <p id="userForm" class="mb-6 px-4 text-sm text-gray-600">Signed in as <span class="font-medium">{{.Principal.Name}}</span> · {{.Principal.Role}}</p>
+        {{else if not .Auth}}
+        <form method="post" action="{{url "/user"}}" id="userForm" class="flex items-center gap-2 mb-6 px-4 text-sm text-gray-600">
+            <label>Annotating as
+                <input type="text" name="user" value="{{.Query.User}}" maxlength="64"
+                       class="w-32 px-2 py-1 border border-gray-300 rounded-md" placeholder="your name">
+            </label>
+            <button type="submit" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">Save</button>
+        </form>
+        {{end}}
+
+        {{if .Collections}}
+        <nav class="collections mb-4 px-4 text-sm text-gray-600">
+            Lists:
+            <a href="{{.Query.CollectionURL ""}}" class="ml-1 {{if not .Query.Collection}}font-medium text-gray-900{{else}}hover:text-gray-900{{end}}">All</a>
+            {{range .Collections}}
+            · <a href="{{$.Query.CollectionURL .Name}}" title="{{.Source}}" class="{{if eq .Name $.Query.Collection}}font-medium text-gray-900{{else}}hover:text-gray-900{{end}}">{{.Name}} ({{.Papers}})</a>
+            {{end}}
+        </nav>
+        {{end}}
+
+        <details class="mb-6 px-4" {{if .Query.HasFilters}}open{{end}}>
+            <summary class="text-sm text-gray-600 cursor-pointer">Filters</summary>
+            <form method="get" action="{{url "/"}}" id="filterForm" class="flex flex-wrap items-center gap-2 mt-2 text-sm text-gray-600">
+                {{if .Query.Search}}<input type="hidden" name="q" value="{{.Query.Search}}">{{end}}
+                {{if .Query.Sort}}<input type="hidden" name="sort" value="{{.Query.Sort}}">{{end}}
+                {{if .Query.Order}}<input type="hidden" name="order" value="{{.Query.Order}}">{{end}}
+                {{if .Query.Collection}}<input type="hidden" name="collection" value="{{.Query.Collection}}">{{end}}
+                <label>Citations
+                    <input type="number" name="min_citations" min="0" value="{{with .Query.MinCitations}}{{.}}{{end}}" class="w-20 px-2 py-1 border border-gray-300 rounded-md" placeholder="min">
+                    to <input type="number" name="max_citations" min="0" value="{{with .Query.MaxCitations}}{{.}}{{end}}" class="w-20 px-2 py-1 border border-gray-300 rounded-md" placeholder="max">
+                </label>
+                <label>Year
+                    <input type="number" name="min_year" min="0" value="{{with .Query.MinYear}}{{.}}{{end}}" class="w-20 px-2 py-1 border border-gray-300 rounded-md" placeholder="from">
+                    to <input type="number" name="max_year" min="0" value="{{with .Query.MaxYear}}{{.}}{{end}}" class="w-20 px-2 py-1 border border-gray-300 rounded-md" placeholder="to">
+                </label>
+                <label>First seen in the last
+                    <input type="number" name="new_days" min="0" value="{{with .Query.NewDays}}{{.}}{{end}}" class="w-16 px-2 py-1 border border-gray-300 rounded-md"> days
+                </label>
+                <label>Tag <input type="text" name="tag" value="{{.Query.Tag}}" class="w-28 px-2 py-1 border border-gray-300 rounded-md"></label>
+                <label>Source
+                    <select name="source" class="px-2 py-1 border border-gray-300 rounded-md">
+                        <option value="">any</option>
+                        {{range $source := .Sources}}<option value="{{$source}}" {{if eq $source $.Query.Source}}selected{{end}}>{{$source}}</option>{{end}}
+                    </select>
+                </label>
+                <span>Missing
+                    {{range $field := .MissingFields}}<label class="ml-1"><input type="checkbox" name="missing" value="{{$field}}" {{if $.Query.IsMissing $field}}checked{{end}}> {{$field}}</label>{{end}}
+                </span>
+                {{if .Query.User}}
+                <span>Mine
+                    {{range $filter := .MineFilters}}<label class="ml-1"><input type="checkbox" name="mine" value="{{$filter}}" {{if $.Query.IsMine $filter}}checked{{end}}> {{$filter}}</label>{{end}}
+                </span>
+                {{end}}
+                <button type="submit" class="px-3 py-1 font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">Apply</button>
+                {{if .Query.HasFilters}}<a href="{{.Query.WithoutFilters}}" class="hover:text-gray-900">Clear</a>{{end}}
+            </form>
+        </details>
+
+        <div class="mb-6 px-4 text-sm text-gray-600">
+            Export this list:
+            <a href="{{url (.Query.ExportURL "csv")}}" class="export-link ml-1 px-2 py-1 border border-gray-300 rounded-md hover:bg-gray-50">CSV</a>
+            <a href="{{url (.Query.ExportURL "json")}}" class="export-link px-2 py-1 border border-gray-300 rounded-md hover:bg-gray-50">JSON</a>
+            <a href="{{url (.Query.ExportURL "bib")}}" class="export-link px-2 py-1 border border-gray-300 rounded-md hover:bg-gray-50">BibTeX</a>
+            <a href="{{url (.Query.ExportURL "md")}}" class="export-link px-2 py-1 border border-gray-300 rounded-md hover:bg-gray-50">Markdown</a>
+        </div>
+
         <div class="overflow-x-auto">
             <table class="min-w-full divide-y divide-gray-200">
                 <thead>
                     <tr>
-                        <th class="px-4 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Title</th>
-                        <th class="px-4 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Citations</th>
+                        <th class="px-4 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                            <a href="{{.Query.SortURL "title"}}" class="sort-link hover:text-gray-900" data-sort="title">Title {{.Query.SortArrow "title"}}</a>
+                            {{range $key := .SecondarySorts}}
+                            · <a href="{{$.Query.SortURL $key}}" class="sort-link hover:text-gray-900" data-sort="{{$key}}">{{$key}} {{$.Query.SortArrow $key}}</a>
+                            {{end}}
+                        </th>
+                        <th class="px-4 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                            <a href="{{.Query.SortURL "citations"}}" class="sort-link hover:text-gray-900" data-sort="citations">Citations {{.Query.SortArrow "citations"}}</a>
+                        </th>
                         <th class="px-4 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Links</th>
                     </tr>
                 </thead>
                 <tbody class="bg-white divide-y divide-gray-200">
+                    {{if .QueryError}}
+                    <tr><td colspan="3" class="query-error px-4 py-3 text-center text-red-500">{{.QueryError.Error}}</td></tr>
+                    {{end}}
                     {{range .Papers}}
                     <tr>
                         <td class="px-4 py-3">
+                            {{if .TitleHighlighted}}
+                            <div class="text-lg font-medium text-gray-900" data-server-highlight>{{.TitleHighlighted}}</div>
+                            {{else}}
                             <div class="text-lg font-medium text-gray-900">{{.Title}}</div>
+                            {{end}}
+                            {{if or .Authors .Year}}
+                            <div class="authors text-sm text-gray-500">{{.Authors}}{{if and .Authors .Year}} · {{end}}{{if .Year}}{{.Year}}{{end}}</div>
+                            {{end}}
+                            {{if .Tags}}
+                            <div class="mt-1 flex gap-1">{{range .Tags}}<span class="tag text-xs text-gray-600">{{.}}</span>{{end}}</div>
+                            {{end}}
+                            {{with .Note}}<div class="note mt-1 text-sm text-gray-700">Note: {{.}}</div>{{end}}
                             {{if .ArxivSummary}}
                             <div class="mt-2 abstract-container">
+                                {{if .Snippet}}
+                                <span class="text-sm text-gray-600" data-server-highlight>{{.Snippet}}</span>
+                                {{else}}
                                 <span class="text-sm text-gray-600">{{.FirstSentence}}</span>
+                                {{end}}
                                 <button class="expand-button ml-2">...</button>
                                 <div class="abstract-text" style="display: none;">{{.ArxivSummary}}</div>
                             </div>
                             {{end}}
                         </td>
                         <td class="px-4 py-3">
-                            <div class="citation-count text-sm text-gray-900">{{if .Citations}}{{.Citations}}{{else}}0{{end}}</div>
+                            <div class="citation-count text-sm text-gray-900">{{if .Pending}}pending{{else if .Citations}}{{.Citations}}{{else}}0{{end}}</div>
+                            {{if .Stars}}<div class="stars text-xs text-gray-500" title="Starred by {{.Stars}}">★ {{.Stars}}</div>{{end}}
                         </td>
                         <td class="px-4 py-3">
                             <div class="flex flex-col gap-1">
+                                <a href="{{url "/paper/"}}{{.ID}}" class="details-link text-sm text-gray-600 hover:text-gray-900">Details</a>
                                 <a href="{{.URL}}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">Paper</a>
                                 {{if .ArxivAbsURL}}
                                 <a href="{{.ArxivAbsURL}}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">arXiv</a>
@@ -107,6 +229,25 @@ const indexTemplate = `<!DOCTYPE html>
                                 {{if .GoogleScholarURL}}
                                 <a href="{{.GoogleScholarURL}}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">Scholar</a>
                                 {{end}}
+                                {{if .CodeURL}}
+                                <a href="{{.CodeURL}}" target="_blank" class="text-sm text-gray-600 hover:text-gray-900">Code</a>
+                                {{end}}
+                                {{if $.CanEdit}}
+                                <form method="post" action="{{url "/refresh"}}" class="refresh-form">
+                                    <input type="hidden" name="url" value="{{.URL}}">
+                                    <button type="submit" class="refresh-button text-sm text-gray-600 hover:text-gray-900">Refresh</button>
+                                </form>
+                                {{end}}
+                                {{if $.CanAnnotate}}
+                                <form method="post" action="{{url "/paper/"}}{{.ID}}/annotations" class="annotate-form">
+                                    <input type="hidden" name="starred" value="{{not .Starred}}">
+                                    <button type="submit" class="star-button text-sm text-gray-600 hover:text-gray-900">{{if .Starred}}Unstar{{else}}Star{{end}}</button>
+                                </form>
+                                <form method="post" action="{{url "/paper/"}}{{.ID}}/annotations" class="annotate-form">
+                                    <input type="hidden" name="read" value="{{not .Read}}">
+                                    <button type="submit" class="read-button text-sm text-gray-600 hover:text-gray-900">{{if .Read}}Mark unread{{else}}Mark read{{end}}</button>
+                                </form>
+                                {{end}}
                             </div>
                         </td>
                     </tr>
@@ -117,3 +258,262 @@ const indexTemplate = `<!DOCTYPE html>
     </div>
 </body>
 </html>`
+
+const paperTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Paper.Title}} - Most Cited Papers</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+    <style>
+        .citation-count {
+            font-variant-numeric: tabular-nums;
+            font-feature-settings: "tnum";
+        }
+        .tag {
+            background-color: #f3f4f6;
+            border-radius: 9999px;
+            padding: 0.1em 0.6em;
+        }
+        .citation-chart {
+            max-width: 100%;
+            height: auto;
+        }
+    </style>
+</head>
+<body class="bg-white" data-base="{{url ""}}"{{if not $.CanEdit}} data-read-only{{end}}>
+    <div class="max-w-4xl mx-auto px-4 py-6">
+        <div class="mb-8 px-4">
+            <a href="{{url "/"}}" class="text-sm text-gray-600 hover:text-gray-900">&larr; Most Cited Papers</a>
+        </div>
+
+        {{with .Paper}}
+        <div class="px-4">
+            <h1 class="text-2xl font-semibold text-gray-900">{{.Title}}</h1>
+            {{if or .Authors .Year}}
+            <div class="authors mt-1 text-gray-600">{{.Authors}}{{if and .Authors .Year}} · {{end}}{{if .Year}}{{.Year}}{{end}}</div>
+            {{end}}
+            {{if .Tags}}
+            <div class="mt-2 flex gap-1">{{range .Tags}}<span class="tag text-xs text-gray-600">{{.}}</span>{{end}}</div>
+            {{end}}
+
+            <div class="mt-4 flex flex-wrap gap-4 text-sm text-gray-600">
+                <a href="{{.URL}}" target="_blank" class="hover:text-gray-900">Paper</a>
+                {{if .ArxivAbsURL}}<a href="{{.ArxivAbsURL}}" target="_blank" class="hover:text-gray-900">arXiv</a>{{end}}
+                {{if .GoogleScholarURL}}<a href="{{.GoogleScholarURL}}" target="_blank" class="hover:text-gray-900">Scholar</a>{{end}}
+                {{if .CodeURL}}<a href="{{.CodeURL}}" target="_blank" class="hover:text-gray-900">Code</a>{{end}}
+            </div>
+
+            {{if .ArxivSummary}}
+            <h2 class="mt-6 text-sm font-medium text-gray-500 uppercase tracking-wider">Abstract</h2>
+            <p class="abstract mt-2 text-sm leading-relaxed text-gray-800">{{.ArxivSummary}}</p>
+            {{end}}
+
+            <h2 class="mt-6 text-sm font-medium text-gray-500 uppercase tracking-wider">Citations</h2>
+            <div class="mt-2 flex items-center gap-4 text-sm text-gray-800">
+                <span class="citation-count text-lg">{{if .Pending}}pending{{else}}{{.Citations}}{{end}}</span>
+                <span class="last-fetched text-gray-500">{{if .Pending}}Not fetched yet{{else}}Last fetched {{.LastUpdate}}{{end}}</span>
+                <span class="metrics text-gray-500">{{velocity .Velocity}} a month · {{gain .Gain7}} in 7 days · {{gain .Gain30}} in 30 days · {{gain .Gain90}} in 90 days</span>
+                {{if $.CanEdit}}
+                <form method="post" action="{{url "/refresh"}}">
+                    <input type="hidden" name="url" value="{{.URL}}">
+                    <button type="submit" class="text-gray-600 hover:text-gray-900">Refresh</button>
+                </form>
+                {{end}}
+            </div>
+        </div>
+        {{end}}
+
+        <div class="px-4">
+            {{if .Counts}}
+            <table class="source-counts mt-2 text-sm text-gray-700">
+                {{range .Counts}}
+                <tr><td class="pr-4">{{.Source}}</td><td class="citation-count pr-4">{{.Citations}}</td><td class="text-gray-500">as of {{.Fetched}}</td></tr>
+                {{end}}
+            </table>
+            {{end}}
+
+            {{if .Chart}}
+            <div class="mt-4">{{.Chart}}</div>
+            {{else}}
+            <p class="mt-4 text-sm text-gray-500">No citation history yet.</p>
+            {{end}}
+
+            {{if .Collections}}
+            <h2 class="mt-6 text-sm font-medium text-gray-500 uppercase tracking-wider">Lists</h2>
+            <ul class="collections mt-2 text-sm text-gray-700">
+                {{range .Collections}}
+                <li class="mt-1"><a href="{{url "/"}}?collection={{.Collection}}" class="font-medium hover:text-gray-900" title="{{.Source}}">{{.Collection}}</a>{{with .Section}} › {{.}}{{end}}
+                    <span class="text-gray-500">first seen {{.FirstSeen}}, last seen {{.LastSeen}}{{with .Removed}}, removed {{.}}{{end}}</span></li>
+                {{end}}
+            </ul>
+            {{end}}
+
+            <h2 class="mt-6 text-sm font-medium text-gray-500 uppercase tracking-wider">Annotations</h2>
+            {{if .CanAnnotate}}
+            <form method="post" action="{{url "/paper/"}}{{.Paper.ID}}/annotations" class="annotation-form mt-2 text-sm text-gray-700">
+                <div class="flex items-center gap-4">
+                    <span>As {{.User}}:</span>
+                    <label><input type="checkbox" name="read" value="true" {{if .Paper.Read}}checked{{end}}> Read</label>
+                    <input type="hidden" name="read" value="false">
+                    <label><input type="checkbox" name="starred" value="true" {{if .Paper.Starred}}checked{{end}}> Starred</label>
+                    <input type="hidden" name="starred" value="false">
+                </div>
+                <textarea name="note" rows="3" maxlength="10000" placeholder="Note"
+                          class="mt-2 w-full px-2 py-1 border border-gray-300 rounded-md">{{.Paper.Note}}</textarea>
+                <button type="submit" class="mt-1 px-3 py-1 font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">Save</button>
+            </form>
+            {{else if .CanEdit}}
+            <p class="mt-2 text-sm text-gray-500">Set your name on the <a href="{{url "/"}}" class="underline hover:text-gray-900">index</a> to annotate papers.</p>
+            {{end}}
+            {{if .Annotations}}
+            <ul class="annotations mt-2 text-sm text-gray-700">
+                {{range .Annotations}}
+                <li class="mt-1"><span class="font-medium">{{.User}}</span>
+                    <span class="text-gray-500">{{if .Read}}read{{end}}{{if and .Read .Starred}}, {{end}}{{if .Starred}}starred{{end}}</span>
+                    {{with .Note}}<div class="whitespace-pre-line text-gray-600">{{.}}</div>{{end}}</li>
+                {{end}}
+            </ul>
+            {{end}}
+
+            {{if .Failures}}
+            <h2 class="mt-6 text-sm font-medium text-gray-500 uppercase tracking-wider">Fetch failures</h2>
+            <ul class="failures mt-2 text-sm text-gray-700">
+                {{range .Failures}}
+                <li class="mt-1"><span class="font-medium">{{.Source}}</span>: {{.Kind}}, {{.Attempts}} attempt{{if ne .Attempts 1}}s{{end}}, last {{.LastFailed}}
+                    <div class="text-gray-500">{{.Error}}</div></li>
+                {{end}}
+            </ul>
+            {{end}}
+        </div>
+    </div>
+</body>
+</html>`
+
+const trendingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Trending - Most Cited Papers</title>
+    <link rel="alternate" type="application/atom+xml" title="Trending papers" href="{{url "/feeds/trending.atom"}}">
+    <script src="https://cdn.tailwindcss.com"></script>
+    <style>
+        .citation-count {
+            font-variant-numeric: tabular-nums;
+            font-feature-settings: "tnum";
+        }
+        .tag {
+            background-color: #f3f4f6;
+            border-radius: 9999px;
+            padding: 0.1em 0.6em;
+        }
+    </style>
+</head>
+<body class="bg-white" data-base="{{url ""}}"{{if not $.CanEdit}} data-read-only{{end}}>
+    <div class="max-w-6xl mx-auto px-4 py-6">
+        <div class="flex justify-between items-center mb-8">
+            <h1 class="text-2xl font-semibold text-gray-900 px-4">
+                <a href="{{url "/"}}" class="hover:text-gray-600 transition-colors">Most Cited Papers</a>
+                <span class="ml-4 text-sm font-normal text-gray-900">Trending</span>
+            </h1>
+            <div class="flex items-center space-x-2" style="margin-right: 18px;">
+                {{if gt .CurrentPage 1}}
+                <a href="{{.Query.PageURL (subtract .CurrentPage 1)}}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">Previous</a>
+                {{end}}
+                <span class="px-3 py-1 text-sm font-medium text-gray-700 whitespace-nowrap">Page {{.CurrentPage}} of {{.TotalPages}}</span>
+                {{if lt .CurrentPage .TotalPages}}
+                <a href="{{.Query.PageURL (add .CurrentPage 1)}}" class="px-3 py-1 text-sm font-medium text-gray-700 bg-white border border-gray-300 rounded-md hover:bg-gray-50">Next</a>
+                {{end}}
+            </div>
+        </div>
+
+        <p class="mb-6 px-4 text-sm text-gray-600">
+            Papers gaining the most citations, from the counts the collector has recorded.
+            Per month is the citations since the paper came out, per month.
+            Follow the movers in a feed reader with the <a href="{{url "/feeds/trending.atom"}}" class="underline hover:text-gray-900">Atom feed</a>.
+        </p>
+
+        <div class="overflow-x-auto">
+            <table class="min-w-full divide-y divide-gray-200">
+                <thead>
+                    <tr class="text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                        <th class="px-4 py-3">#</th>
+                        <th class="px-4 py-3">Title</th>
+                        <th class="px-4 py-3"><a href="{{.Query.SortURL "gain7"}}" class="sort-link hover:text-gray-900">7 days {{.Query.SortArrow "gain7"}}</a></th>
+                        <th class="px-4 py-3"><a href="{{.Query.SortURL "gain30"}}" class="sort-link hover:text-gray-900">30 days {{.Query.SortArrow "gain30"}}</a></th>
+                        <th class="px-4 py-3"><a href="{{.Query.SortURL "gain90"}}" class="sort-link hover:text-gray-900">90 days {{.Query.SortArrow "gain90"}}</a></th>
+                        <th class="px-4 py-3"><a href="{{.Query.SortURL "velocity"}}" class="sort-link hover:text-gray-900">Per month {{.Query.SortArrow "velocity"}}</a></th>
+                        <th class="px-4 py-3">Citations</th>
+                    </tr>
+                </thead>
+                <tbody class="bg-white divide-y divide-gray-200">
+                    {{range $i, $paper := .Papers}}
+                    <tr class="text-sm text-gray-900">
+                        <td class="px-4 py-3 text-gray-500">{{add $.Offset (add $i 1)}}</td>
+                        <td class="px-4 py-3">
+                            <a href="{{url "/paper/"}}{{.ID}}" class="text-lg font-medium hover:text-gray-600">{{.Title}}</a>
+                            {{if or .Authors .Year}}
+                            <div class="authors text-gray-500">{{.Authors}}{{if and .Authors .Year}} · {{end}}{{if .Year}}{{.Year}}{{end}}</div>
+                            {{end}}
+                            {{if .Tags}}
+                            <div class="mt-1 flex gap-1">{{range .Tags}}<span class="tag text-xs text-gray-600">{{.}}</span>{{end}}</div>
+                            {{end}}
+                        </td>
+                        <td class="citation-count px-4 py-3">{{gain .Gain7}}</td>
+                        <td class="citation-count px-4 py-3">{{gain .Gain30}}</td>
+                        <td class="citation-count px-4 py-3">{{gain .Gain90}}</td>
+                        <td class="citation-count px-4 py-3">{{velocity .Velocity}}</td>
+                        <td class="citation-count px-4 py-3">{{if .Pending}}pending{{else}}{{.Citations}}{{end}}</td>
+                    </tr>
+                    {{else}}
+                    <tr><td colspan="7" class="px-4 py-3 text-center text-gray-500">No papers found</td></tr>
+                    {{end}}
+                </tbody>
+            </table>
+        </div>
+    </div>
+</body>
+</html>`
+
+const landingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Most Cited Papers</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+</head>
+<body class="bg-white">
+    <div class="max-w-4xl mx-auto px-4 py-6">
+        <h1 class="text-2xl font-semibold text-gray-900 px-4 mb-8">Most Cited Papers</h1>
+        <table class="min-w-full">
+            <thead>
+                <tr class="text-left text-sm font-medium text-gray-500">
+                    <th class="px-4 py-3">Database</th>
+                    <th class="px-4 py-3">Papers</th>
+                    <th class="px-4 py-3">Last fetched</th>
+                </tr>
+            </thead>
+            <tbody class="divide-y divide-gray-200">
+                {{range .}}
+                <tr class="database">
+                    <td class="px-4 py-3"><a href="/{{.Name}}/" class="text-lg font-medium hover:text-gray-600">{{.Name}}</a></td>
+                    {{if .Error}}
+                    <td colspan="2" class="px-4 py-3 text-sm text-red-500">{{.Error}}</td>
+                    {{else}}
+                    <td class="citation-count px-4 py-3 text-sm text-gray-900">{{.Papers}}</td>
+                    <td class="px-4 py-3 text-sm text-gray-500">{{with .Fetched}}{{.}}{{else}}Never{{end}}</td>
+                    {{end}}
+                </tr>
+                {{else}}
+                <tr>
+                    <td colspan="3" class="px-4 py-3 text-center text-gray-500">No databases</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </div>
+</body>
+</html>`
@@ -0,0 +1,106 @@
+-- Created by initCache in the collector's store.go; go test -tags sqlite_fts5 -run TestServerSchema -update-schema rewrites it
+
+CREATE TABLE paper_cache (
+			url TEXT PRIMARY KEY,
+			title TEXT NOT NULL,
+			citations INTEGER,
+			arxiv_abs_url TEXT,
+			google_scholar_url TEXT,
+			arxiv_summary TEXT,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			pending INTEGER NOT NULL DEFAULT 0,
+			authors TEXT,
+			code_url TEXT,
+			year INTEGER,
+			added DATETIME DEFAULT CURRENT_TIMESTAMP,
+			published TEXT
+		);
+
+CREATE TABLE paper_tags (
+			url TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (url, tag)
+		);
+
+CREATE TABLE fetch_failures (
+			url TEXT NOT NULL,
+			source TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			error TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 1,
+			first_failed DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_failed DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (url, source)
+		);
+
+CREATE TABLE citation_history (
+		url TEXT NOT NULL,
+		source TEXT NOT NULL,
+		citations INTEGER NOT NULL,
+		fetched DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+CREATE INDEX citation_history_url ON citation_history (url, fetched);
+
+CREATE TABLE collections (
+		name TEXT PRIMARY KEY,
+		source TEXT NOT NULL,
+		synced DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+CREATE TABLE collection_papers (
+		collection TEXT NOT NULL,
+		url TEXT NOT NULL,
+		section TEXT NOT NULL DEFAULT '',
+		first_seen DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		removed DATETIME,
+		PRIMARY KEY (collection, url)
+	);
+
+CREATE INDEX collection_papers_url ON collection_papers (url);
+
+CREATE TABLE annotations (
+		user TEXT NOT NULL,
+		url TEXT NOT NULL,
+		read INTEGER NOT NULL DEFAULT 0,
+		starred INTEGER NOT NULL DEFAULT 0,
+		note TEXT NOT NULL DEFAULT '',
+		updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user, url)
+	);
+
+CREATE INDEX annotations_url ON annotations (url);
+
+CREATE VIRTUAL TABLE paper_search USING fts5(
+		title, abstract, authors, tags, tokenize = 'porter unicode61'
+	);
+
+CREATE TRIGGER paper_search_insert AFTER INSERT ON paper_cache BEGIN
+		INSERT INTO paper_search (rowid, title, abstract, authors, tags)
+		VALUES (new.rowid, new.title, COALESCE(new.arxiv_summary, ''), COALESCE(new.authors, ''),
+			COALESCE((SELECT group_concat(tag, ' ') FROM paper_tags WHERE url = new.url), ''));
+	END;
+
+CREATE TRIGGER paper_search_update AFTER UPDATE OF title, arxiv_summary, authors ON paper_cache BEGIN
+		UPDATE paper_search
+		SET title = new.title, abstract = COALESCE(new.arxiv_summary, ''), authors = COALESCE(new.authors, '')
+		WHERE rowid = new.rowid;
+	END;
+
+CREATE TRIGGER paper_search_delete AFTER DELETE ON paper_cache BEGIN
+		DELETE FROM paper_search WHERE rowid = old.rowid;
+	END;
+
+CREATE TRIGGER paper_search_tag_insert AFTER INSERT ON paper_tags BEGIN
+		UPDATE paper_search
+		SET tags = (SELECT group_concat(tag, ' ') FROM paper_tags WHERE url = new.url)
+		WHERE rowid = (SELECT rowid FROM paper_cache WHERE url = new.url);
+	END;
+
+CREATE TRIGGER paper_search_tag_delete AFTER DELETE ON paper_tags BEGIN
+		UPDATE paper_search
+		SET tags = COALESCE((SELECT group_concat(tag, ' ') FROM paper_tags WHERE url = old.url), '')
+		WHERE rowid = (SELECT rowid FROM paper_cache WHERE url = old.url);
+	END;
+
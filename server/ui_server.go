@@ -3,6 +3,8 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
@@ -19,18 +21,49 @@ type UIServer struct {
 	db         *sql.DB
 	tmpl       *template.Template
 	dbFilePath string
+	pageSize   int    // papers per page
+	collector  string // command that runs the collector for refresh jobs
+	jobs       *jobQueue
+	search     bool   // whether the paper_search index can be used, else search uses LIKE
+	base       string // path the server is mounted at, "" at the root
+	readOnly   bool   // whether papers can't be added, imported or refreshed
+	auth       *authConfig
+	publicURL  string // scheme and host of the links in feeds, from the request when ""
 }
 
+// defaultPageSize is the number of papers per page unless configured otherwise
+const defaultPageSize = 25
+
+// defaultCollector is the collector binary built by go build in the repository root
+const defaultCollector = "most-cited-papers"
+
 // PaperView represents a paper for view in the UI
 type PaperView struct {
+	ID               int64 // the paper's rowid, which /paper/{id} shows
 	Title            string
 	URL              string
 	ArxivAbsURL      string
 	GoogleScholarURL string
 	ArxivSummary     string
 	Citations        int
+	HasCitations     bool // false if no source gave its citations, with Citations 0
 	LastUpdate       string
 	FirstSentence    string
+	Pending          bool // added but not fetched yet
+	Tags             []string
+	Authors          string
+	CodeURL          string
+	Year             int           // 0 if unknown
+	Velocity         *float64      // citations per month since it came out, nil if unknown
+	Gain7            *int          // change in citations over the last 7 days, nil without history
+	Gain30           *int          // over the last 30 days
+	Gain90           *int          // over the last 90 days
+	Stars            int           // users who starred it
+	Read             bool          // whether the requesting user read it
+	Starred          bool          // whether they starred it
+	Note             string        // their note on it
+	TitleHighlighted template.HTML // the title with the search matches marked
+	Snippet          template.HTML // the part of the abstract matching the search
 }
 
 // getFirstSentence returns the first sentence of a text
@@ -44,13 +77,37 @@ func getFirstSentence(text string) string {
 
 // NewUIServer creates a new UI server
 func NewUIServer(dbFilePath string) (*UIServer, error) {
-	// Connect to the database
-	db, err := sql.Open("sqlite3", dbFilePath)
+	// SQLite would create a missing file, without the collector's tables
+	if _, err := os.Stat(dbFilePath); err != nil {
+		return nil, fmt.Errorf("%v; run the collector to create the database", err)
+	}
+	// Connect to the database, waiting for the collector's writes to finish
+	db, err := sql.Open("sqlite3", dbFilePath+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	search, err := checkSchema(db, true)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
+	s := &UIServer{
+		db:         db,
+		dbFilePath: dbFilePath,
+		pageSize:   defaultPageSize,
+		collector:  defaultCollector,
+		search:     search,
+	}
+	if err := s.parseTemplates(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.jobs = newJobQueue(s.runCollector)
+	return s, nil
+}
 
-	// Create template with custom functions
+// parseTemplates parses the server's pages, whose links start at its base
+func (s *UIServer) parseTemplates() error {
 	funcMap := template.FuncMap{
 		"add": func(a, b int) int {
 			return a + b
@@ -58,59 +115,111 @@ func NewUIServer(dbFilePath string) (*UIServer, error) {
 		"subtract": func(a, b int) int {
 			return a - b
 		},
+		"gain":     formatGain,
+		"velocity": formatVelocity,
+		"url":      s.url,
 	}
 
-	// Parse template with custom functions
+	// Parse templates with custom functions
 	tmpl, err := template.New("index").Funcs(funcMap).Parse(indexTemplate)
-	if err != nil {
-		db.Close()
-		return nil, err
+	if err == nil {
+		_, err = tmpl.New("paper").Parse(paperTemplate)
 	}
+	if err == nil {
+		_, err = tmpl.New("trending").Parse(trendingTemplate)
+	}
+	s.tmpl = tmpl
+	return err
+}
 
-	return &UIServer{
-		db:         db,
-		tmpl:       tmpl,
-		dbFilePath: dbFilePath,
-	}, nil
+// url returns the path of a page of the server, under its base
+func (s *UIServer) url(path string) string {
+	return s.base + path
+}
+
+// Handler routes the pages and the API of the server, each for the users
+// with its role. Those that add, import, refresh or annotate papers are
+// refused when it is read-only. Annotations are each user's own, so any
+// reader who signed in may make them.
+func (s *UIServer) Handler() http.Handler {
+	read := func(handler http.HandlerFunc) http.HandlerFunc { return s.require(roleReader, handler) }
+	edit := func(handler http.HandlerFunc) http.HandlerFunc { return s.require(roleEditor, handler) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", read(s.handleIndex))
+	mux.HandleFunc("GET /paper/{id}", read(s.handlePaper))
+	mux.HandleFunc("GET /trending", read(s.handleTrending))
+	mux.HandleFunc("GET /new", read(s.handleNew))
+	mux.HandleFunc("GET /feeds/new.atom", read(s.handleNewFeed))
+	mux.HandleFunc("GET /feeds/trending.atom", read(s.handleTrendingFeed))
+	mux.HandleFunc("GET /feeds/tags/{file}", read(s.handleTagFeed))
+	mux.HandleFunc("GET /export", read(s.handleExport))
+	for _, format := range exportFormats {
+		mux.HandleFunc("GET /export."+format.name, read(s.handleExport))
+	}
+	mux.HandleFunc("/refresh", edit(s.handleRefresh))
+	mux.HandleFunc("POST /papers", edit(s.handleAddPaper))
+	mux.HandleFunc("POST /paper/{id}/annotations", s.requireUser(s.handleAnnotate))
+	mux.HandleFunc("POST /user", read(s.handleSetUser))
+	for _, prefix := range apiPrefixes {
+		mux.HandleFunc("GET "+prefix+"/papers", read(s.handlePapersAPI))
+		mux.HandleFunc("POST "+prefix+"/refresh", edit(s.handleRefreshAPI))
+		mux.HandleFunc("GET "+prefix+"/jobs/{id}", read(s.handleJobAPI))
+		mux.HandleFunc("POST "+prefix+"/papers", edit(s.handleAddPaperAPI))
+		mux.HandleFunc("POST "+prefix+"/papers/import", s.require(roleAdmin, s.handleImportAPI))
+		mux.HandleFunc("GET "+prefix+"/papers/{id}/annotations", read(s.handleAnnotationsAPI))
+		mux.HandleFunc("POST "+prefix+"/papers/{id}/annotations", s.requireUser(s.handleAnnotateAPI))
+		mux.HandleFunc(prefix+"/", read(s.handleAPINotFound))
+	}
+	mux.HandleFunc("/tailwind.css", read(s.serveTailwind))
+	mux.HandleFunc("/static/js/", read(s.serveStaticJS))
+	return s.authenticate(sameOrigin(mux))
 }
 
 // Start starts the UI server
 func (s *UIServer) Start(addr string) error {
-	http.HandleFunc("/", s.handleIndex)
-	http.HandleFunc("/api/papers", s.handlePapersAPI)
-	http.HandleFunc("/refresh", s.handleRefresh)
-	http.HandleFunc("/tailwind.css", s.serveTailwind)
-	http.HandleFunc("/static/js/", s.serveStaticJS)
-
 	log.Printf("Starting server on %s", addr)
-	return http.ListenAndServe(addr, nil)
+	return http.ListenAndServe(addr, s.Handler())
 }
 
-// Close closes the UI server
+// handleReadOnly refuses to change a read-only database
+func (s *UIServer) handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusForbidden, "This database is read-only")
+}
+
+// Close closes the UI server, stopping any running refresh job
 func (s *UIServer) Close() error {
+	s.jobs.close()
 	return s.db.Close()
 }
 
 // handleIndex handles the index page
 func (s *UIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
-	// Parse page parameter from query string
-	page := 1
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
+	query, err := s.parsePaperQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Parse search query
-	searchQuery := r.URL.Query().Get("q")
-
-	const pageSize = 25
-	papers, total, err := s.getPapers(page, pageSize, searchQuery)
+	pageSize := query.PageSize
+	papers, total, err := s.getPapers(query)
+	// An invalid query is shown above the table, so it can be fixed
+	var queryErr *QueryError
+	status := http.StatusOK
+	if errors.As(err, &queryErr) {
+		status, err = http.StatusBadRequest, nil
+	}
 	if err != nil {
 		http.Error(w, "Failed to fetch papers: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	collections, err := s.getCollections()
+	if err != nil {
+		http.Error(w, "Failed to fetch lists: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Calculate pagination info
 	totalPages := (total + pageSize - 1) / pageSize
 	if totalPages < 1 {
@@ -118,32 +227,137 @@ func (s *UIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Papers      []PaperView
-		Count       int
-		CurrentPage int
-		TotalPages  int
-		PageSize    int
-		SearchQuery string
+		Papers         []PaperView
+		Count          int
+		CurrentPage    int
+		TotalPages     int
+		PageSize       int
+		SearchQuery    string
+		Query          PaperQuery
+		QueryError     *QueryError
+		Sources        []string
+		MissingFields  []string
+		SecondarySorts []string
+		Collections    []collectionSummary
+		MineFilters    []string
+		CanEdit        bool      // whether the user may add and refresh papers
+		CanAnnotate    bool      // whether they may annotate them
+		Auth           bool      // whether users annotate as who they signed in as
+		Principal      principal // who the user signed in as, if they did
 	}{
-		Papers:      papers,
-		Count:       total,
-		CurrentPage: page,
-		TotalPages:  totalPages,
-		PageSize:    pageSize,
-		SearchQuery: searchQuery,
+		Papers:         papers,
+		Count:          total,
+		CurrentPage:    query.Page,
+		TotalPages:     totalPages,
+		PageSize:       pageSize,
+		SearchQuery:    query.Search,
+		Query:          query,
+		Sources:        filterSources,
+		MissingFields:  missingFields,
+		SecondarySorts: secondarySorts,
+		Collections:    collections,
+		MineFilters:    mineFilters,
+		CanEdit:        s.canEdit(r),
+		CanAnnotate:    s.canAnnotate(r),
+		Auth:           s.auth.enabled(),
+		Principal:      requestPrincipal(r),
+		QueryError:     queryErr,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
 	if err := s.tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Template execution failed: "+err.Error(), http.StatusInternalServerError)
 	}
 }
 
-// handleRefresh handles the refresh action
+// handleRefresh handles the refresh buttons when JavaScript is off: a POST
+// queues a refresh job, then the browser goes back to the page it came from
 func (s *UIServer) handleRefresh(w http.ResponseWriter, r *http.Request) {
-	// This is a simple redirect back to the index page
-	// In a more advanced version, you could add cache invalidation logic here
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	if r.Method == http.MethodPost {
+		if _, status, err := s.enqueueRefresh(r); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	s.redirectBack(w, r)
+}
+
+// handleRefreshAPI queues a refresh of the paper given by the url parameter,
+// or of every paper with all=true, and responds with the job
+func (s *UIServer) handleRefreshAPI(w http.ResponseWriter, r *http.Request) {
+	job, status, err := s.enqueueRefresh(r)
+	if err != nil {
+		writeAPIError(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiPrefix(r)+"/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// enqueueRefresh queues the refresh requested by r, returning the HTTP status
+// to respond with on error
+func (s *UIServer) enqueueRefresh(r *http.Request) (Job, int, error) {
+	url := strings.TrimSpace(r.FormValue("url"))
+	all, _ := strconv.ParseBool(r.FormValue("all"))
+	if url == "" && !all {
+		return Job{}, http.StatusBadRequest, errors.New("give the url of a paper, or all=true to refresh every paper")
+	}
+	if all && !s.hasRole(r, roleAdmin) {
+		return Job{}, http.StatusForbidden, errors.New("refreshing every paper needs the admin role")
+	}
+
+	if url != "" {
+		var count int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM paper_cache WHERE url = ?`, url).Scan(&count); err != nil {
+			return Job{}, http.StatusInternalServerError, err
+		}
+		if count == 0 {
+			return Job{}, http.StatusNotFound, errors.New("no paper with url " + url)
+		}
+	}
+
+	job, err := s.jobs.enqueue(Job{URL: url})
+	if err != nil {
+		return Job{}, http.StatusServiceUnavailable, err
+	}
+	return job, http.StatusAccepted, nil
+}
+
+// handleJobAPI reports the status of a refresh job. Once a single-paper job
+// has succeeded, the response includes the paper's new citation count.
+func (s *UIServer) handleJobAPI(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	response := struct {
+		Job
+		Citations *int `json:"citations,omitempty"`
+	}{Job: job}
+	if job.URL != "" && job.Status == jobSucceeded {
+		var citations sql.NullInt64
+		err := s.db.QueryRow(`SELECT citations FROM paper_cache WHERE url = ?`, job.URL).Scan(&citations)
+		if err != nil && err != sql.ErrNoRows {
+			writeAPIError(w, http.StatusInternalServerError, "Failed to fetch paper: "+err.Error())
+			return
+		}
+		if citations.Valid {
+			n := int(citations.Int64)
+			response.Citations = &n
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response: "+err.Error(), http.StatusInternalServerError)
+	}
 }
 
 // serveTailwind serves a minimal CSS file
@@ -153,49 +367,69 @@ func (s *UIServer) serveTailwind(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("/* Using Tailwind CDN instead */"))
 }
 
-// handlePapersAPI handles AJAX requests for paper data
+// handlePapersAPI responds with a page of papers as JSON. Scripts page
+// through a listing by passing back nextCursor until there is none.
 func (s *UIServer) handlePapersAPI(w http.ResponseWriter, r *http.Request) {
-	// Parse page parameter from query string
-	page := 1
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
+	query, err := s.parsePaperQuery(r)
+	if err == nil {
+		err = parseAPIPage(r, &query)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Parse search query
-	searchQuery := r.URL.Query().Get("q")
-
-	const pageSize = 25
-	papers, total, err := s.getPapers(page, pageSize, searchQuery)
+	pageSize := query.PageSize
+	page, err := s.getPaperPage(query)
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to fetch papers: "+err.Error(), http.StatusInternalServerError)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to fetch papers: "+err.Error())
 		return
 	}
 
 	// Calculate pagination info
-	totalPages := (total + pageSize - 1) / pageSize
+	totalPages := (page.total + pageSize - 1) / pageSize
 	if totalPages < 1 {
 		totalPages = 1
 	}
 
 	// If no results found, ensure papers is an empty array
-	if total == 0 {
+	var papers interface{} = page.papers
+	if page.papers == nil {
 		papers = []PaperView{}
 	}
+	if fields != nil {
+		if papers, err = projectPapers(page.papers, fields); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "Failed to encode papers: "+err.Error())
+			return
+		}
+	}
 
 	response := struct {
-		Papers      []PaperView `json:"papers"`
+		Papers      interface{} `json:"papers"`
 		Count       int         `json:"count"`
 		CurrentPage int         `json:"currentPage"`
 		TotalPages  int         `json:"totalPages"`
 		PageSize    int         `json:"pageSize"`
+		Limit       int         `json:"limit"`
+		NextCursor  string      `json:"nextCursor,omitempty"`
 	}{
 		Papers:      papers,
-		Count:       total,
-		CurrentPage: page,
+		Count:       page.total,
+		CurrentPage: query.Page,
 		TotalPages:  totalPages,
 		PageSize:    pageSize,
+		Limit:       pageSize,
+		NextCursor:  page.next,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -204,82 +438,140 @@ func (s *UIServer) handlePapersAPI(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getPapers fetches all papers from the database with pagination and search
-func (s *UIServer) getPapers(page, pageSize int, searchQuery string) ([]PaperView, int, error) {
+// paperPage is a page of papers with the number of papers in the listing,
+// and the cursor of the next page, "" on the last one
+type paperPage struct {
+	papers []PaperView
+	total  int
+	next   string
+}
+
+// getPapers fetches a page of papers and the number of papers in the listing
+func (s *UIServer) getPapers(q PaperQuery) ([]PaperView, int, error) {
+	page, err := s.getPaperPage(q)
+	return page.papers, page.total, err
+}
+
+// getPaperPage fetches a page of papers from the database in the query's sort
+// order, by default the most cited first or, when searching, the most
+// relevant first
+func (s *UIServer) getPaperPage(q PaperQuery) (paperPage, error) {
 	// Build the base query
-	baseQuery := `SELECT title, url, citations, arxiv_abs_url, google_scholar_url, timestamp, arxiv_summary FROM paper_cache`
-	countQuery := `SELECT COUNT(*) FROM paper_cache`
+	search, err := parseSearch(q.Search)
+	if err != nil {
+		return paperPage{}, err
+	}
+	q.addFilters(&search)
+
+	columns := paperViewColumns
+	from := ` FROM paper_cache`
+	order := q.orderBy()
+	sortKey, sort, desc := q.direction()
 
 	var args []interface{}
-	var whereClause string
+	var conditions []string
+	highlighted := false
+
+	if len(search.terms) > 0 && s.search {
+		columns += `, highlight(paper_search, 0, '` + matchStart + `', '` + matchEnd + `'),
+			snippet(paper_search, 1, '` + matchStart + `', '` + matchEnd + `', '…', 32)`
+		from += ` JOIN paper_search ON paper_search.rowid = paper_cache.rowid`
+		conditions = append(conditions, `paper_search MATCH ?`)
+		args = append(args, matchQuery(search.terms))
+		if q.Sort == "" && q.Rank == "blend" {
+			order = ` ORDER BY ` + blendedRank
+			sortKey, desc = "blend", false
+		} else if q.Sort == "" {
+			order = ` ORDER BY ` + searchRank
+			sortKey, desc = "relevance", false
+		}
+		highlighted = true
+	} else if len(search.terms) > 0 {
+		like, likeArgs := likeConditions(search.terms)
+		conditions = append(conditions, like)
+		args = append(args, likeArgs...)
+	}
+	conditions = append(conditions, search.conditions...)
+	args = append(args, search.args...)
 
-	if searchQuery != "" {
-		whereClause = ` WHERE title LIKE ? OR arxiv_summary LIKE ?`
-		searchPattern := "%" + searchQuery + "%"
-		args = append(args, searchPattern, searchPattern)
+	where := func(conditions []string) string {
+		if len(conditions) == 0 {
+			return ""
+		}
+		return ` WHERE ` + strings.Join(conditions, " AND ")
 	}
 
 	// Get total count
 	var total int
-	if whereClause != "" {
-		countQuery += whereClause
-	}
-	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+	if err := s.db.QueryRow(`SELECT COUNT(*)`+from+where(conditions), args...).Scan(&total); err != nil {
 		log.Printf("Error getting total count: %v", err)
-		return nil, 0, err
+		return paperPage{}, err
 	}
 
-	// Calculate offset
-	offset := (page - 1) * pageSize
+	// Pages sorted on a column continue after the last paper of the previous
+	// page, ranked searches at an offset
+	ranked := sortKey == "relevance" || sortKey == "blend"
+	if !ranked {
+		// The unary + reads DATETIME columns as their text, not as times
+		columns += `, +` + sort.column
+	}
+	offset := (q.Page - 1) * q.PageSize
+	if c := q.cursor; c != nil {
+		if c.Sort != sortKey || c.Desc != desc {
+			return paperPage{}, &QueryError{"the cursor is for another order, pass the sort, order and rank it was returned for"}
+		}
+		if ranked {
+			offset = c.Offset
+		} else {
+			after, afterArgs := q.after(*c)
+			conditions = append(conditions, after)
+			args = append(args, afterArgs...)
+			offset = 0
+		}
+	}
 
-	// Get paginated results
-	query := baseQuery + whereClause + ` ORDER BY CASE WHEN citations IS NULL THEN 1 ELSE 0 END, citations DESC LIMIT ? OFFSET ?`
-	args = append(args, pageSize, offset)
+	// Get paginated results, and one more paper to tell whether there is a next page
+	query := `SELECT ` + columns + from + where(conditions) + order + ` LIMIT ? OFFSET ?`
+	args = append(args, q.PageSize+1, offset)
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		log.Printf("Error querying papers: %v", err)
-		return nil, 0, err
+		return paperPage{}, err
 	}
 	defer rows.Close()
 
 	var papers []PaperView
+	var last paperCursor // the position of the last paper, for the next page's cursor
+	more := false
 	for rows.Next() {
-		var paper PaperView
-		var timestamp string
-		var arxivAbsURL sql.NullString
-		var googleScholarURL sql.NullString
-		var arxivSummary sql.NullString
-		var citations sql.NullInt64
-
-		if err := rows.Scan(&paper.Title, &paper.URL, &citations, &arxivAbsURL, &googleScholarURL, &timestamp, &arxivSummary); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			return nil, 0, err
-		}
-
-		if arxivAbsURL.Valid {
-			paper.ArxivAbsURL = arxivAbsURL.String
+		if len(papers) == q.PageSize {
+			more = true
+			break
 		}
 
-		if googleScholarURL.Valid {
-			paper.GoogleScholarURL = googleScholarURL.String
+		var titleHighlighted, snippet string
+		var sortValue interface{}
+		var extra []interface{}
+		if highlighted {
+			extra = append(extra, &titleHighlighted, &snippet)
 		}
-
-		if arxivSummary.Valid {
-			paper.ArxivSummary = arxivSummary.String
-			paper.FirstSentence = getFirstSentence(arxivSummary.String)
+		if !ranked {
+			extra = append(extra, &sortValue)
 		}
-
-		if citations.Valid {
-			paper.Citations = int(citations.Int64)
+		paper, err := scanPaperView(rows, extra...)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			return paperPage{}, err
 		}
-
-		// Parse timestamp and format it for display
-		t, err := time.Parse("2006-01-02 15:04:05", timestamp)
-		if err == nil {
-			paper.LastUpdate = t.Format("Jan 02, 2006 15:04")
-		} else {
-			paper.LastUpdate = timestamp
+		last = paperCursor{Sort: sortKey, Desc: desc, Value: sortValue, RowID: paper.ID}
+
+		if highlighted {
+			paper.TitleHighlighted = highlightHTML(titleHighlighted)
+			// snippet() returns the start of the abstract when only other columns match
+			if strings.Contains(snippet, matchStart) {
+				paper.Snippet = highlightHTML(snippet)
+			}
 		}
 
 		papers = append(papers, paper)
@@ -287,11 +579,115 @@ func (s *UIServer) getPapers(page, pageSize int, searchQuery string) ([]PaperVie
 
 	if err := rows.Err(); err != nil {
 		log.Printf("Error iterating rows: %v", err)
-		return nil, 0, err
+		return paperPage{}, err
+	}
+
+	if err := s.annotatePapers(q.User, papers); err != nil {
+		log.Printf("Error annotating papers: %v", err)
+		return paperPage{}, err
+	}
+
+	page := paperPage{papers: papers, total: total}
+	if more {
+		if ranked {
+			last.Offset = offset + len(papers)
+		}
+		page.next = last.encode()
+	}
+	log.Printf("Loaded %d papers (page %d, total %d, search: %q)", len(papers), q.Page, total, q.Search)
+	return page, nil
+}
+
+// paperViewColumns is the column list scanned by scanPaperView
+var paperViewColumns = `paper_cache.rowid, paper_cache.title, url, citations, arxiv_abs_url, google_scholar_url, timestamp, arxiv_summary, pending,
+	(SELECT group_concat(tag, ',') FROM (SELECT tag FROM paper_tags t WHERE t.url = paper_cache.url ORDER BY tag)),
+	paper_cache.authors, code_url, year, ` + velocityColumn + `, ` + gainColumn(7) + `, ` + gainColumn(30) + `, ` + gainColumn(90)
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPaperView reads a row selected with paperViewColumns, and any columns
+// selected after them into extra
+func scanPaperView(row rowScanner, extra ...interface{}) (PaperView, error) {
+	var paper PaperView
+	var timestamp sql.NullString
+	var arxivAbsURL sql.NullString
+	var googleScholarURL sql.NullString
+	var arxivSummary sql.NullString
+	var citations sql.NullInt64
+	var tags sql.NullString
+	var authors, codeURL sql.NullString
+	var year sql.NullInt64
+	var velocity sql.NullFloat64
+	var gain7, gain30, gain90 sql.NullInt64
+
+	dest := []interface{}{&paper.ID, &paper.Title, &paper.URL, &citations, &arxivAbsURL, &googleScholarURL, &timestamp, &arxivSummary, &paper.Pending, &tags, &authors, &codeURL, &year,
+		&velocity, &gain7, &gain30, &gain90}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return paper, err
+	}
+
+	if arxivAbsURL.Valid {
+		paper.ArxivAbsURL = arxivAbsURL.String
 	}
 
-	log.Printf("Loaded %d papers (page %d, total %d, search: %q)", len(papers), page, total, searchQuery)
-	return papers, total, nil
+	if googleScholarURL.Valid {
+		paper.GoogleScholarURL = googleScholarURL.String
+	}
+
+	if arxivSummary.Valid {
+		paper.ArxivSummary = arxivSummary.String
+		paper.FirstSentence = getFirstSentence(arxivSummary.String)
+	}
+
+	if citations.Valid {
+		paper.Citations = int(citations.Int64)
+		paper.HasCitations = true
+	}
+
+	paper.Tags = splitTagList(tags)
+	paper.Authors = authors.String
+	paper.CodeURL = codeURL.String
+	paper.Year = int(year.Int64)
+	if velocity.Valid {
+		paper.Velocity = &velocity.Float64
+	}
+	paper.Gain7, paper.Gain30, paper.Gain90 = nullInt(gain7), nullInt(gain30), nullInt(gain90)
+
+	// Format the timestamp for display; pending papers have none
+	paper.LastUpdate = formatTimestamp(timestamp.String)
+	return paper, nil
+}
+
+// nullInt returns the value of n, or nil if it is NULL
+func nullInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	value := int(n.Int64)
+	return &value
+}
+
+// formatTimestamp formats a DATETIME column for display. The driver reads
+// them as RFC 3339 times; text it can't parse is kept as it is.
+func formatTimestamp(value string) string {
+	if t, ok := parseTimestamp(value); ok {
+		return t.Format("Jan 02, 2006 15:04")
+	}
+	return value
+}
+
+// parseTimestamp parses a DATETIME column read as RFC 3339 or, from an
+// expression the driver doesn't know the type of, as SQLite's own text
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, time.DateTime} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
 }
 
 // serveStaticJS serves static JavaScript files
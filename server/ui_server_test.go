@@ -21,28 +21,13 @@ func setupTestDB(t *testing.T) (*sql.DB, string) {
 		t.Fatal(err)
 	}
 
-	// Connect to the temporary database
+	// Create the collector's tables and connect to the temporary database
+	createSchema(t, tmpfile.Name())
 	db, err := sql.Open("sqlite3", tmpfile.Name())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Create the paper_cache table
-	_, err = db.Exec(`
-		CREATE TABLE paper_cache (
-			title TEXT NOT NULL,
-			url TEXT NOT NULL,
-			citations INTEGER,
-			arxiv_abs_url TEXT,
-			google_scholar_url TEXT,
-			timestamp TEXT NOT NULL,
-			arxiv_summary TEXT
-		)
-	`)
-	if err != nil {
-		t.Fatal(err)
-	}
-
 	// Insert some test data
 	_, err = db.Exec(`
 		INSERT INTO paper_cache (title, url, citations, arxiv_abs_url, google_scholar_url, timestamp, arxiv_summary)
@@ -291,7 +276,7 @@ func TestGetPapers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			papers, total, err := server.getPapers(tt.page, tt.pageSize, tt.searchQuery)
+			papers, total, err := server.getPapers(PaperQuery{Page: tt.page, PageSize: tt.pageSize, Search: tt.searchQuery})
 			tt.checkResults(t, papers, total, err)
 		})
 	}
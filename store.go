@@ -0,0 +1,775 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultDBPath is the database shared by the collector and the UI server
+const defaultDBPath = "paper_cache.db"
+
+var cacheDB *sql.DB
+
+// initCache opens the SQLite database at dbPath and creates the paper_cache,
+// paper_tags, fetch_failures, citation_history, collection and annotations
+// tables, and the paper_search index when SQLite has FTS5. The UI server
+// only checks for them, so the collector has to run on a database first.
+func initCache(dbPath string) error {
+	// WAL lets the UI server read while the collector or daemon writes
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+
+	// Create paper_cache table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS paper_cache (
+			url TEXT PRIMARY KEY,
+			title TEXT NOT NULL,
+			citations INTEGER,
+			arxiv_abs_url TEXT,
+			google_scholar_url TEXT,
+			arxiv_summary TEXT,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			pending INTEGER NOT NULL DEFAULT 0,
+			authors TEXT,
+			code_url TEXT,
+			year INTEGER,
+			added DATETIME DEFAULT CURRENT_TIMESTAMP,
+			published TEXT
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create table: %v", err)
+	}
+
+	// Papers added through the UI server are pending until their first fetch
+	if err := addColumn(db, "paper_cache", "pending", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addColumn(db, "paper_cache", "authors", "TEXT"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addColumn(db, "paper_cache", "code_url", "TEXT"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addColumn(db, "paper_cache", "year", "INTEGER"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addColumn(db, "paper_cache", "published", "TEXT"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := backfillDates(db); err != nil {
+		db.Close()
+		return err
+	}
+	// When a paper was first stored; older rows only know when they were last fetched
+	if err := addColumn(db, "paper_cache", "added", "DATETIME"); err != nil {
+		db.Close()
+		return err
+	}
+	if _, err := db.Exec("UPDATE paper_cache SET added = COALESCE(timestamp, CURRENT_TIMESTAMP) WHERE added IS NULL"); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to set added times: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS paper_tags (
+			url TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (url, tag)
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create table: %v", err)
+	}
+
+	// fetch_failures holds the latest failure of each source for a paper,
+	// so a missing count can be explained
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS fetch_failures (
+			url TEXT NOT NULL,
+			source TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			error TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 1,
+			first_failed DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_failed DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (url, source)
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create table: %v", err)
+	}
+
+	if err := initHistory(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	if _, err := db.Exec(collectionSchema); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create collections: %v", err)
+	}
+
+	if _, err := db.Exec(annotationSchema); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create annotations: %v", err)
+	}
+
+	if err := initSearch(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	if err := canonicalizeURLs(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	cacheDB = db
+	return nil
+}
+
+// backfillDates sets the year and month of the papers saved before they were
+// stored, for those whose URL has them
+func backfillDates(db *sql.DB) error {
+	rows, err := db.Query("SELECT url, arxiv_abs_url, year IS NULL, published IS NULL FROM paper_cache WHERE year IS NULL OR published IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to read papers: %v", err)
+	}
+	years := make(map[string]int)
+	months := make(map[string]string)
+	for rows.Next() {
+		var paper Paper
+		var arxivAbsURL sql.NullString
+		var noYear, noMonth bool
+		if err := rows.Scan(&paper.URL, &arxivAbsURL, &noYear, &noMonth); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read papers: %v", err)
+		}
+		paper.ArxivAbsURL = arxivAbsURL.String
+		if year := paperYear(&paper); year > 0 && noYear {
+			years[paper.URL] = year
+		}
+		if month := paperMonth(&paper); month != "" && noMonth {
+			months[paper.URL] = month
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read papers: %v", err)
+	}
+
+	for url, year := range years {
+		if _, err := db.Exec("UPDATE paper_cache SET year = ? WHERE url = ?", year, url); err != nil {
+			return fmt.Errorf("failed to set year of %s: %v", url, err)
+		}
+	}
+	for url, month := range months {
+		if _, err := db.Exec("UPDATE paper_cache SET published = ? WHERE url = ?", month, url); err != nil {
+			return fmt.Errorf("failed to set month of %s: %v", url, err)
+		}
+	}
+	return nil
+}
+
+// historySchema is citation_history, a snapshot of each citation count
+// fetched for a paper, which the UI server charts
+const historySchema = `
+	CREATE TABLE IF NOT EXISTS citation_history (
+		url TEXT NOT NULL,
+		source TEXT NOT NULL,
+		citations INTEGER NOT NULL,
+		fetched DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS citation_history_url ON citation_history (url, fetched);
+`
+
+// annotationSchema is what each user of the UI server marked a paper as:
+// read, starred, and their note on it. Only the server writes it.
+const annotationSchema = `
+	CREATE TABLE IF NOT EXISTS annotations (
+		user TEXT NOT NULL,
+		url TEXT NOT NULL,
+		read INTEGER NOT NULL DEFAULT 0,
+		starred INTEGER NOT NULL DEFAULT 0,
+		note TEXT NOT NULL DEFAULT '',
+		updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user, url)
+	);
+	CREATE INDEX IF NOT EXISTS annotations_url ON annotations (url);
+`
+
+// initHistory creates citation_history, starting the history of the papers
+// fetched before it existed with their current count
+func initHistory(db *sql.DB) error {
+	if _, err := db.Exec(historySchema); err != nil {
+		return fmt.Errorf("failed to create citation history: %v", err)
+	}
+	_, err := db.Exec(`
+		INSERT INTO citation_history (url, source, citations, fetched)
+		SELECT url, ?, citations, COALESCE(timestamp, CURRENT_TIMESTAMP) FROM paper_cache
+		WHERE citations IS NOT NULL AND url NOT IN (SELECT url FROM citation_history)
+	`, sourceScholar)
+	if err != nil {
+		return fmt.Errorf("failed to start citation history: %v", err)
+	}
+	return nil
+}
+
+// searchSchema is the full-text index the UI server searches, kept in sync
+// with paper_cache and paper_tags by triggers. Its rowids are those of
+// paper_cache.
+const searchSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS paper_search USING fts5(
+		title, abstract, authors, tags, tokenize = 'porter unicode61'
+	);
+	CREATE TRIGGER IF NOT EXISTS paper_search_insert AFTER INSERT ON paper_cache BEGIN
+		INSERT INTO paper_search (rowid, title, abstract, authors, tags)
+		VALUES (new.rowid, new.title, COALESCE(new.arxiv_summary, ''), COALESCE(new.authors, ''),
+			COALESCE((SELECT group_concat(tag, ' ') FROM paper_tags WHERE url = new.url), ''));
+	END;
+	CREATE TRIGGER IF NOT EXISTS paper_search_update AFTER UPDATE OF title, arxiv_summary, authors ON paper_cache BEGIN
+		UPDATE paper_search
+		SET title = new.title, abstract = COALESCE(new.arxiv_summary, ''), authors = COALESCE(new.authors, '')
+		WHERE rowid = new.rowid;
+	END;
+	CREATE TRIGGER IF NOT EXISTS paper_search_delete AFTER DELETE ON paper_cache BEGIN
+		DELETE FROM paper_search WHERE rowid = old.rowid;
+	END;
+	CREATE TRIGGER IF NOT EXISTS paper_search_tag_insert AFTER INSERT ON paper_tags BEGIN
+		UPDATE paper_search
+		SET tags = (SELECT group_concat(tag, ' ') FROM paper_tags WHERE url = new.url)
+		WHERE rowid = (SELECT rowid FROM paper_cache WHERE url = new.url);
+	END;
+	CREATE TRIGGER IF NOT EXISTS paper_search_tag_delete AFTER DELETE ON paper_tags BEGIN
+		UPDATE paper_search
+		SET tags = COALESCE((SELECT group_concat(tag, ' ') FROM paper_tags WHERE url = old.url), '')
+		WHERE rowid = (SELECT rowid FROM paper_cache WHERE url = old.url);
+	END;
+`
+
+// initSearch creates the paper_search index and indexes the papers stored
+// before it existed. Without FTS5 it does nothing, unless another build
+// already created the index: its triggers would then fail every write.
+func initSearch(db *sql.DB) error {
+	var hasFTS5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5); err != nil {
+		return fmt.Errorf("failed to check for FTS5: %v", err)
+	}
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'paper_search'").Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for the search index: %v", err)
+	}
+
+	if !hasFTS5 {
+		if exists > 0 {
+			return fmt.Errorf("the database has a full-text index but SQLite was built without FTS5; build with -tags sqlite_fts5")
+		}
+		return nil
+	}
+
+	if _, err := db.Exec(searchSchema); err != nil {
+		return fmt.Errorf("failed to create search index: %v", err)
+	}
+	if exists == 0 {
+		_, err := db.Exec(`
+			INSERT INTO paper_search (rowid, title, abstract, authors, tags)
+			SELECT rowid, title, COALESCE(arxiv_summary, ''), COALESCE(authors, ''),
+				COALESCE((SELECT group_concat(tag, ' ') FROM paper_tags t WHERE t.url = paper_cache.url), '')
+			FROM paper_cache
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to index papers: %v", err)
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to a table created by an older version, if it's missing
+func addColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to read columns of %s: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+
+	if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// closeCache closes the database connection
+func closeCache() {
+	if cacheDB != nil {
+		cacheDB.Close()
+		cacheDB = nil
+	}
+}
+
+// savePaper saves everything we know about a paper to the cache, which ends
+// its pending state. A missing citation count does not overwrite one found by
+// an earlier run.
+func savePaper(paper *Paper) error {
+	if cacheDB == nil {
+		return nil
+	}
+
+	_, err := cacheDB.Exec(`
+		INSERT INTO paper_cache (url, title, citations, arxiv_abs_url, google_scholar_url, arxiv_summary, authors, code_url, year, published, timestamp, pending, added)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), datetime('now'), 0, datetime('now'))
+		ON CONFLICT(url) DO UPDATE SET
+			title = excluded.title,
+			citations = COALESCE(excluded.citations, paper_cache.citations),
+			arxiv_abs_url = COALESCE(NULLIF(excluded.arxiv_abs_url, ''), paper_cache.arxiv_abs_url),
+			google_scholar_url = COALESCE(NULLIF(excluded.google_scholar_url, ''), paper_cache.google_scholar_url),
+			arxiv_summary = COALESCE(NULLIF(excluded.arxiv_summary, ''), paper_cache.arxiv_summary),
+			authors = COALESCE(NULLIF(excluded.authors, ''), paper_cache.authors),
+			code_url = COALESCE(NULLIF(excluded.code_url, ''), paper_cache.code_url),
+			year = COALESCE(excluded.year, paper_cache.year),
+			published = COALESCE(excluded.published, paper_cache.published),
+			timestamp = excluded.timestamp,
+			pending = 0
+	`, paper.URL, paper.Title, paper.Citations, paper.ArxivAbsURL, paper.GoogleScholarURL, paper.ArxivSummary, strings.Join(paper.Authors, ", "), paper.CodeURL, paperYear(paper), paperMonth(paper))
+	if err != nil {
+		return fmt.Errorf("failed to save to cache: %v", err)
+	}
+
+	// Citation counts only come from Google Scholar
+	if paper.Citations != nil {
+		_, err := cacheDB.Exec("INSERT INTO citation_history (url, source, citations, fetched) VALUES (?, ?, ?, datetime('now'))",
+			paper.URL, sourceScholar, *paper.Citations)
+		if err != nil {
+			return fmt.Errorf("failed to save citation history: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// paperColumns is the column list scanned by scanPaper
+const paperColumns = `rowid, url, title, citations, arxiv_abs_url, google_scholar_url, arxiv_summary, timestamp, authors, code_url, year, published`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPaper reads a row selected with paperColumns into a Paper
+func scanPaper(row rowScanner) (*Paper, error) {
+	var paper Paper
+	var citations sql.NullInt64
+	var arxivAbsURL, googleScholarURL, abstract, authors, codeURL, published sql.NullString
+	var updated sql.NullTime
+	var year sql.NullInt64
+
+	err := row.Scan(&paper.ID, &paper.URL, &paper.Title, &citations, &arxivAbsURL, &googleScholarURL, &abstract, &updated, &authors, &codeURL, &year, &published)
+	if err != nil {
+		return nil, err
+	}
+
+	if citations.Valid {
+		count := int(citations.Int64)
+		paper.Citations = &count
+	}
+	paper.ArxivAbsURL = arxivAbsURL.String
+	paper.GoogleScholarURL = googleScholarURL.String
+	paper.ArxivSummary = abstract.String
+	paper.UpdatedAt = updated.Time
+	paper.CodeURL = codeURL.String
+	paper.Year = int(year.Int64)
+	paper.Published = published.String
+	if authors.String != "" {
+		paper.Authors = strings.Split(authors.String, ", ")
+	}
+
+	return &paper, nil
+}
+
+// getCachedPaper retrieves a paper from the cache
+func getCachedPaper(url string) (*Paper, error) {
+	if cacheDB == nil {
+		return nil, nil
+	}
+
+	row := cacheDB.QueryRow("SELECT "+paperColumns+" FROM paper_cache WHERE url = ?", url)
+	paper, err := scanPaper(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache: %v", err)
+	}
+
+	return paper, nil
+}
+
+// getPaperByID retrieves a paper from the cache by its row ID
+func getPaperByID(id int64) (*Paper, error) {
+	if cacheDB == nil {
+		return nil, nil
+	}
+
+	row := cacheDB.QueryRow("SELECT "+paperColumns+" FROM paper_cache WHERE rowid = ?", id)
+	paper, err := scanPaper(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache: %v", err)
+	}
+
+	return paper, nil
+}
+
+// PaperFilter selects papers from the cache
+type PaperFilter struct {
+	Query         string    // substring of the title or abstract
+	MinCitations  int       // only papers with at least this many citations
+	MaxCitations  int       // only papers with at most this many citations, 0 for no limit
+	Missing       bool      // only papers without a citation count
+	Pending       bool      // only papers added to the server but not fetched yet
+	UpdatedBefore time.Time // only papers last fetched before this time
+	URLs          []string  // only these papers
+	Collection    string    // only papers listed in this collection
+	Collected     bool      // only papers from a list, leaving out those added through the server
+	Listed        bool      // leave out papers dropped from every list they were in
+	Sort          string    // citations, title, updated (newest first) or oldest
+	Limit         int       // 0 for no limit
+}
+
+// selectsAll reports whether the filter matches every cached paper
+func (f PaperFilter) selectsAll() bool {
+	return f.Query == "" && f.MinCitations == 0 && f.MaxCitations == 0 && !f.Missing && !f.Pending &&
+		f.UpdatedBefore.IsZero() && len(f.URLs) == 0 && f.Collection == "" && !f.Collected && !f.Listed && f.Limit == 0
+}
+
+// listPapers returns the cached papers matching filter
+func listPapers(filter PaperFilter) ([]Paper, error) {
+	if cacheDB == nil {
+		return nil, nil
+	}
+
+	var where []string
+	var args []interface{}
+
+	if filter.Query != "" {
+		where = append(where, "(title LIKE ? OR arxiv_summary LIKE ?)")
+		pattern := "%" + filter.Query + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.MinCitations > 0 {
+		where = append(where, "citations >= ?")
+		args = append(args, filter.MinCitations)
+	}
+	if filter.MaxCitations > 0 {
+		where = append(where, "citations <= ?")
+		args = append(args, filter.MaxCitations)
+	}
+	if filter.Missing {
+		where = append(where, "citations IS NULL")
+	}
+	if filter.Pending {
+		where = append(where, "pending = 1")
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, filter.UpdatedBefore.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if len(filter.URLs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(filter.URLs)), ",")
+		where = append(where, "url IN ("+placeholders+")")
+		for _, url := range filter.URLs {
+			args = append(args, url)
+		}
+	}
+
+	if filter.Collection != "" {
+		where = append(where, "url IN (SELECT url FROM collection_papers WHERE collection = ? AND removed IS NULL)")
+		args = append(args, filter.Collection)
+	}
+	if filter.Collected {
+		where = append(where, "url IN (SELECT url FROM collection_papers)")
+	}
+	if filter.Listed {
+		// Papers never in a list, like those added through the server, stay
+		where = append(where, "(url IN (SELECT url FROM collection_papers WHERE removed IS NULL) OR url NOT IN (SELECT url FROM collection_papers))")
+	}
+
+	query := "SELECT " + paperColumns + " FROM paper_cache"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	switch filter.Sort {
+	case "", "citations":
+		query += " ORDER BY CASE WHEN citations IS NULL THEN 1 ELSE 0 END, citations DESC"
+	case "title":
+		query += " ORDER BY title COLLATE NOCASE"
+	case "updated":
+		query += " ORDER BY timestamp DESC"
+	case "oldest":
+		query += " ORDER BY timestamp ASC"
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", filter.Sort)
+	}
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := cacheDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache: %v", err)
+	}
+	defer rows.Close()
+
+	var papers []Paper
+	for rows.Next() {
+		paper, err := scanPaper(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan paper: %v", err)
+		}
+		papers = append(papers, *paper)
+	}
+
+	return papers, rows.Err()
+}
+
+// deletePapers removes the given papers from the cache
+func deletePapers(urls []string) (int64, error) {
+	if cacheDB == nil || len(urls) == 0 {
+		return 0, nil
+	}
+
+	tx, err := cacheDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, url := range urls {
+		result, err := tx.Exec("DELETE FROM paper_cache WHERE url = ?", url)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete %s: %v", url, err)
+		}
+		if _, err := tx.Exec("DELETE FROM fetch_failures WHERE url = ?", url); err != nil {
+			return 0, fmt.Errorf("failed to delete failures of %s: %v", url, err)
+		}
+		if _, err := tx.Exec("DELETE FROM paper_tags WHERE url = ?", url); err != nil {
+			return 0, fmt.Errorf("failed to delete tags of %s: %v", url, err)
+		}
+		if _, err := tx.Exec("DELETE FROM citation_history WHERE url = ?", url); err != nil {
+			return 0, fmt.Errorf("failed to delete citation history of %s: %v", url, err)
+		}
+		if _, err := tx.Exec("DELETE FROM collection_papers WHERE url = ?", url); err != nil {
+			return 0, fmt.Errorf("failed to delete collections of %s: %v", url, err)
+		}
+		if _, err := tx.Exec("DELETE FROM annotations WHERE url = ?", url); err != nil {
+			return 0, fmt.Errorf("failed to delete annotations of %s: %v", url, err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	return deleted, nil
+}
+
+// countFetchedSince returns how many papers were fetched at or after t
+func countFetchedSince(t time.Time) (int, error) {
+	if cacheDB == nil {
+		return 0, nil
+	}
+
+	var count int
+	err := cacheDB.QueryRow("SELECT COUNT(*) FROM paper_cache WHERE timestamp >= ?",
+		t.UTC().Format("2006-01-02 15:04:05")).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count fetched papers: %v", err)
+	}
+	return count, nil
+}
+
+// FetchFailure is a row of fetch_failures
+type FetchFailure struct {
+	URL         string
+	Source      string
+	Kind        string
+	Error       string
+	Attempts    int
+	FirstFailed time.Time
+	LastFailed  time.Time
+}
+
+// recordFetchFailures stores the failures of the latest fetch of url. A source
+// that failed again has its attempt count incremented; sources that didn't
+// fail this time are cleared.
+func recordFetchFailures(url string, failures []*FetchError) error {
+	if cacheDB == nil {
+		return nil
+	}
+
+	tx, err := cacheDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	failed := []any{url}
+	seen := make(map[string]bool)
+	for _, failure := range failures {
+		// Keep the first failure of each source, it's usually the cause of the rest
+		if seen[failure.Source] {
+			continue
+		}
+		seen[failure.Source] = true
+		failed = append(failed, failure.Source)
+
+		_, err := tx.Exec(`
+			INSERT INTO fetch_failures (url, source, kind, error, attempts, first_failed, last_failed)
+			VALUES (?, ?, ?, ?, 1, datetime('now'), datetime('now'))
+			ON CONFLICT(url, source) DO UPDATE SET
+				kind = excluded.kind,
+				error = excluded.error,
+				attempts = fetch_failures.attempts + 1,
+				last_failed = excluded.last_failed
+		`, url, failure.Source, errorKind(failure), failure.Error())
+		if err != nil {
+			return fmt.Errorf("failed to record failure: %v", err)
+		}
+	}
+
+	query := "DELETE FROM fetch_failures WHERE url = ?"
+	if len(failed) > 1 {
+		query += " AND source NOT IN (?" + strings.Repeat(", ?", len(failed)-2) + ")"
+	}
+	if _, err := tx.Exec(query, failed...); err != nil {
+		return fmt.Errorf("failed to clear failures: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	return nil
+}
+
+// getFetchFailures returns the recorded failures of url
+func getFetchFailures(url string) ([]FetchFailure, error) {
+	if cacheDB == nil {
+		return nil, nil
+	}
+
+	rows, err := cacheDB.Query(`
+		SELECT url, source, kind, error, attempts, first_failed, last_failed
+		FROM fetch_failures WHERE url = ? ORDER BY source
+	`, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failures: %v", err)
+	}
+	defer rows.Close()
+
+	var failures []FetchFailure
+	for rows.Next() {
+		var f FetchFailure
+		if err := rows.Scan(&f.URL, &f.Source, &f.Kind, &f.Error, &f.Attempts, &f.FirstFailed, &f.LastFailed); err != nil {
+			return nil, fmt.Errorf("failed to read failure: %v", err)
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+// CacheStats summarizes the contents of the cache
+type CacheStats struct {
+	Papers         int
+	WithCitations  int
+	TotalCitations int
+	MaxCitations   int
+	WithAbstract   int
+	Oldest         time.Time
+	Newest         time.Time
+	FailedByKind   map[string]int // papers with a recorded failure, by error kind
+}
+
+// getStats computes summary statistics over the cache
+func getStats() (CacheStats, error) {
+	var stats CacheStats
+	if cacheDB == nil {
+		return stats, nil
+	}
+
+	var total, max sql.NullInt64
+	var oldest, newest sql.NullString
+	err := cacheDB.QueryRow(`
+		SELECT COUNT(*), COUNT(citations), SUM(citations), MAX(citations),
+			COUNT(NULLIF(arxiv_summary, '')), MIN(timestamp), MAX(timestamp)
+		FROM paper_cache
+	`).Scan(&stats.Papers, &stats.WithCitations, &total, &max, &stats.WithAbstract, &oldest, &newest)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query stats: %v", err)
+	}
+
+	stats.TotalCitations = int(total.Int64)
+	stats.MaxCitations = int(max.Int64)
+	stats.Oldest = parseTimestamp(oldest.String)
+	stats.Newest = parseTimestamp(newest.String)
+
+	rows, err := cacheDB.Query("SELECT kind, COUNT(DISTINCT url) FROM fetch_failures GROUP BY kind")
+	if err != nil {
+		return stats, fmt.Errorf("failed to query failures: %v", err)
+	}
+	defer rows.Close()
+
+	stats.FailedByKind = make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return stats, fmt.Errorf("failed to read failures: %v", err)
+		}
+		stats.FailedByKind[kind] = count
+	}
+
+	return stats, rows.Err()
+}
+
+// parseTimestamp parses the timestamps SQLite returns for aggregate queries
+func parseTimestamp(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "rewrite the schema the UI server tests use")
+
+// serverSchema is the schema the UI server tests create their databases with
+const serverSchema = "server/testdata/schema.sql"
+
+// setupTestCache opens a fresh cache in a temporary directory
+func setupTestCache(t *testing.T) {
+	t.Helper()
+	if err := initCache(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("initCache failed: %v", err)
+	}
+	t.Cleanup(closeCache)
+}
+
+func TestSavePaperKeepsPreviousCitations(t *testing.T) {
+	setupTestCache(t)
+
+	paper := &Paper{Title: "Test Paper", URL: "https://arxiv.org/abs/2301.12345", Citations: intPtr(42), ArxivSummary: "An abstract."}
+	if err := savePaper(paper); err != nil {
+		t.Fatalf("savePaper failed: %v", err)
+	}
+
+	// A later run that couldn't find a count must not erase the old one
+	if err := savePaper(&Paper{Title: "Test Paper", URL: paper.URL}); err != nil {
+		t.Fatalf("savePaper failed: %v", err)
+	}
+
+	cached, err := getCachedPaper(paper.URL)
+	if err != nil {
+		t.Fatalf("getCachedPaper failed: %v", err)
+	}
+	if cached == nil {
+		t.Fatal("Expected cached paper")
+	}
+	if cached.Citations == nil || *cached.Citations != 42 {
+		t.Errorf("Expected 42 citations, got %v", cached.Citations)
+	}
+	if cached.ArxivSummary != "An abstract." {
+		t.Errorf("Expected abstract to be kept, got %q", cached.ArxivSummary)
+	}
+	if cached.UpdatedAt.IsZero() {
+		t.Error("Expected non-zero update time")
+	}
+
+	byID, err := getPaperByID(cached.ID)
+	if err != nil {
+		t.Fatalf("getPaperByID failed: %v", err)
+	}
+	if byID == nil || byID.URL != paper.URL {
+		t.Errorf("getPaperByID(%d) = %v; want %s", cached.ID, byID, paper.URL)
+	}
+}
+
+func TestListPapers(t *testing.T) {
+	setupTestCache(t)
+
+	papers := []Paper{
+		{Title: "Graph Paper", URL: "https://example.com/1", Citations: intPtr(10)},
+		{Title: "Another Graph Paper", URL: "https://example.com/2", Citations: intPtr(50)},
+		{Title: "Text Paper", URL: "https://example.com/3"},
+	}
+	for i := range papers {
+		if err := savePaper(&papers[i]); err != nil {
+			t.Fatalf("savePaper failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   PaperFilter
+		expected []string
+	}{
+		{"all by citations", PaperFilter{}, []string{"Another Graph Paper", "Graph Paper", "Text Paper"}},
+		{"by title", PaperFilter{Sort: "title"}, []string{"Another Graph Paper", "Graph Paper", "Text Paper"}},
+		{"query", PaperFilter{Query: "graph"}, []string{"Another Graph Paper", "Graph Paper"}},
+		{"min citations", PaperFilter{MinCitations: 20}, []string{"Another Graph Paper"}},
+		{"max citations", PaperFilter{MaxCitations: 20}, []string{"Graph Paper"}},
+		{"missing", PaperFilter{Missing: true}, []string{"Text Paper"}},
+		{"urls", PaperFilter{URLs: []string{"https://example.com/1", "https://example.com/3"}}, []string{"Graph Paper", "Text Paper"}},
+		{"limit", PaperFilter{Limit: 1}, []string{"Another Graph Paper"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := listPapers(tt.filter)
+			if err != nil {
+				t.Fatalf("listPapers failed: %v", err)
+			}
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %d papers, got %d", len(tt.expected), len(result))
+			}
+			for i, paper := range result {
+				if paper.Title != tt.expected[i] {
+					t.Errorf("Expected paper %q at position %d, got %q", tt.expected[i], i, paper.Title)
+				}
+			}
+		})
+	}
+
+	if _, err := listPapers(PaperFilter{Sort: "bogus"}); err == nil {
+		t.Error("Expected error for unknown sort order")
+	}
+}
+
+func TestDeletePapersAndStats(t *testing.T) {
+	setupTestCache(t)
+
+	for _, paper := range []Paper{
+		{Title: "Paper 1", URL: "https://example.com/1", Citations: intPtr(10), ArxivSummary: "Abstract."},
+		{Title: "Paper 2", URL: "https://example.com/2", Citations: intPtr(30)},
+		{Title: "Paper 3", URL: "https://example.com/3"},
+	} {
+		if err := savePaper(&paper); err != nil {
+			t.Fatalf("savePaper failed: %v", err)
+		}
+	}
+
+	stats, err := getStats()
+	if err != nil {
+		t.Fatalf("getStats failed: %v", err)
+	}
+	if stats.Papers != 3 || stats.WithCitations != 2 || stats.TotalCitations != 40 || stats.MaxCitations != 30 || stats.WithAbstract != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.Newest.IsZero() {
+		t.Error("Expected newest update time")
+	}
+
+	deleted, err := deletePapers([]string{"https://example.com/1", "https://example.com/missing"})
+	if err != nil {
+		t.Fatalf("deletePapers failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted paper, got %d", deleted)
+	}
+
+	stats, err = getStats()
+	if err != nil {
+		t.Fatalf("getStats failed: %v", err)
+	}
+	if stats.Papers != 2 {
+		t.Errorf("Expected 2 papers after delete, got %d", stats.Papers)
+	}
+}
+
+func TestRecordFetchFailures(t *testing.T) {
+	setupTestCache(t)
+
+	url := "https://example.com/paper.pdf"
+	scholar := newFetchError(sourceScholar, url, ErrRateLimited, "Rate limited by Google Scholar")
+	arxiv := newFetchError(sourceArxiv, url, ErrParseFailed, "abstract not found on page")
+
+	if err := recordFetchFailures(url, []*FetchError{scholar, arxiv}); err != nil {
+		t.Fatalf("recordFetchFailures failed: %v", err)
+	}
+	if err := recordFetchFailures(url, []*FetchError{scholar}); err != nil {
+		t.Fatalf("recordFetchFailures failed: %v", err)
+	}
+
+	failures, err := getFetchFailures(url)
+	if err != nil {
+		t.Fatalf("getFetchFailures failed: %v", err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("Expected the arXiv failure to be cleared, got %+v", failures)
+	}
+	if failures[0].Source != sourceScholar || failures[0].Kind != "rate-limited" || failures[0].Attempts != 2 {
+		t.Errorf("Unexpected failure %+v", failures[0])
+	}
+
+	stats, err := getStats()
+	if err != nil {
+		t.Fatalf("getStats failed: %v", err)
+	}
+	if stats.FailedByKind["rate-limited"] != 1 {
+		t.Errorf("Expected 1 rate-limited paper, got %v", stats.FailedByKind)
+	}
+
+	if err := recordFetchFailures(url, nil); err != nil {
+		t.Fatalf("recordFetchFailures failed: %v", err)
+	}
+	failures, err = getFetchFailures(url)
+	if err != nil || len(failures) != 0 {
+		t.Errorf("Expected failures to be cleared, got %+v, %v", failures, err)
+	}
+}
+
+func TestInitCacheAddsPendingColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The schema before papers could be added through the UI server
+	_, err = db.Exec(`
+		CREATE TABLE paper_cache (
+			url TEXT PRIMARY KEY,
+			title TEXT NOT NULL,
+			citations INTEGER,
+			arxiv_abs_url TEXT,
+			google_scholar_url TEXT,
+			arxiv_summary TEXT,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO paper_cache (url, title) VALUES ('https://example.com/old', 'Old');
+		INSERT INTO paper_cache (url, title) VALUES ('https://arxiv.org/abs/1706.03762', 'Attention');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := initCache(path); err != nil {
+		t.Fatalf("initCache failed: %v", err)
+	}
+	defer closeCache()
+
+	papers, err := listPapers(PaperFilter{Pending: true})
+	if err != nil || len(papers) != 0 {
+		t.Fatalf("Expected no pending papers, got %d, %v", len(papers), err)
+	}
+	if paper, err := getCachedPaper("https://arxiv.org/abs/1706.03762"); err != nil || paper.Year != 2017 || paper.Published != "2017-06" {
+		t.Fatalf("Expected the year and month to be set from the arXiv ID, got %+v, %v", paper, err)
+	}
+
+	// What the UI server inserts
+	_, err = cacheDB.Exec(`INSERT INTO paper_cache (url, title, timestamp, pending) VALUES ('https://example.com/new', 'New', NULL, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	papers, err = listPapers(PaperFilter{Pending: true})
+	if err != nil || len(papers) != 1 || papers[0].URL != "https://example.com/new" {
+		t.Fatalf("Expected the added paper to be pending, got %v, %v", papers, err)
+	}
+
+	if err := savePaper(&papers[0]); err != nil {
+		t.Fatalf("savePaper failed: %v", err)
+	}
+	if papers, _ := listPapers(PaperFilter{Pending: true}); len(papers) != 0 {
+		t.Errorf("Expected saving to end the pending state, got %v", papers)
+	}
+
+	// Opening the migrated database again is a no-op
+	closeCache()
+	if err := initCache(path); err != nil {
+		t.Fatalf("initCache failed on a migrated database: %v", err)
+	}
+}
+
+func TestSearchIndexFollowsPapers(t *testing.T) {
+	setupTestCache(t)
+	var hasFTS5 bool
+	cacheDB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5)
+	if !hasFTS5 {
+		t.Skip("SQLite built without FTS5, run with -tags sqlite_fts5")
+	}
+
+	search := func(query string) []string {
+		t.Helper()
+		rows, err := cacheDB.Query(`
+			SELECT p.url FROM paper_search JOIN paper_cache p ON p.rowid = paper_search.rowid
+			WHERE paper_search MATCH ? ORDER BY p.url`, query)
+		if err != nil {
+			t.Fatalf("search %q failed: %v", query, err)
+		}
+		defer rows.Close()
+		var urls []string
+		for rows.Next() {
+			var url string
+			rows.Scan(&url)
+			urls = append(urls, url)
+		}
+		return urls
+	}
+
+	paper := &Paper{Title: "Graph Retrieval", URL: "https://example.com/a", Authors: []string{"Ada Lovelace"}}
+	if err := savePaper(paper); err != nil {
+		t.Fatal(err)
+	}
+	if err := savePaper(&Paper{Title: "Other", URL: "https://example.com/b", ArxivSummary: "About graphs."}); err != nil {
+		t.Fatal(err)
+	}
+
+	if urls := search("graph"); len(urls) != 2 {
+		t.Errorf("Expected both papers to match a stemmed term, got %v", urls)
+	}
+	if urls := search("authors:lovelace"); len(urls) != 1 || urls[0] != paper.URL {
+		t.Errorf("Expected the paper by its author, got %v", urls)
+	}
+
+	// Updates, tags and deletes are followed
+	paper.ArxivSummary = "Augmented generation."
+	if err := savePaper(paper); err != nil {
+		t.Fatal(err)
+	}
+	if urls := search("augmented"); len(urls) != 1 {
+		t.Errorf("Expected the new abstract to be indexed, got %v", urls)
+	}
+	if _, err := cacheDB.Exec("INSERT INTO paper_tags (url, tag) VALUES (?, 'rag')", paper.URL); err != nil {
+		t.Fatal(err)
+	}
+	if urls := search("tags:rag"); len(urls) != 1 {
+		t.Errorf("Expected the tag to be indexed, got %v", urls)
+	}
+	if _, err := deletePapers([]string{paper.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if urls := search("augmented OR rag"); len(urls) != 0 {
+		t.Errorf("Expected the deleted paper to be gone, got %v", urls)
+	}
+}
+
+func TestCitationHistory(t *testing.T) {
+	setupTestCache(t)
+
+	url := "https://arxiv.org/abs/2301.12345"
+	for _, citations := range []*int{intPtr(42), nil, intPtr(50)} {
+		if err := savePaper(&Paper{Title: "Test Paper", URL: url, Citations: citations}); err != nil {
+			t.Fatalf("savePaper failed: %v", err)
+		}
+	}
+	history := func(url string) string {
+		t.Helper()
+		var counts sql.NullString
+		err := cacheDB.QueryRow("SELECT group_concat(source || ':' || citations, ' ') FROM (SELECT * FROM citation_history WHERE url = ? ORDER BY rowid)", url).Scan(&counts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return counts.String
+	}
+	if got := history(url); got != "scholar:42 scholar:50" {
+		t.Errorf("Expected a snapshot of each count fetched, got %q", got)
+	}
+
+	// Papers fetched before the history existed start it with their count
+	_, err := cacheDB.Exec("INSERT INTO paper_cache (url, title, citations, timestamp) VALUES ('https://example.com/old', 'Old', 7, '2024-01-02 03:04:05')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := initHistory(cacheDB); err != nil {
+		t.Fatalf("initHistory failed: %v", err)
+	}
+	if got := history("https://example.com/old"); got != "scholar:7" {
+		t.Errorf("Expected the current count in the history, got %q", got)
+	}
+	if got := history(url); got != "scholar:42 scholar:50" {
+		t.Errorf("Expected the history to be kept, got %q", got)
+	}
+
+	if _, err := deletePapers([]string{url}); err != nil {
+		t.Fatalf("deletePapers failed: %v", err)
+	}
+	if got := history(url); got != "" {
+		t.Errorf("Expected the history to be deleted with the paper, got %q", got)
+	}
+}
+
+// TestServerSchema checks that the schema the UI server tests use is the one
+// initCache creates. Run it with -tags sqlite_fts5 -update-schema after
+// changing the schema.
+func TestServerSchema(t *testing.T) {
+	setupTestCache(t)
+	var hasFTS5 bool
+	if err := cacheDB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5); err != nil {
+		t.Fatal(err)
+	}
+	if !hasFTS5 {
+		t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+	}
+
+	// The tables FTS5 keeps the index in are created with it
+	rows, err := cacheDB.Query(`
+		SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND NOT (type = 'table' AND name LIKE 'paper_search_%')
+		ORDER BY rowid
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var schema strings.Builder
+	schema.WriteString("-- Created by initCache in the collector's store.go; go test -tags sqlite_fts5 -run TestServerSchema -update-schema rewrites it\n\n")
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			t.Fatal(err)
+		}
+		schema.WriteString(statement + ";\n\n")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if *updateSchema {
+		if err := os.WriteFile(serverSchema, []byte(schema.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(serverSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(want) != schema.String() {
+		t.Errorf("%s is out of date, run go test -tags sqlite_fts5 -run TestServerSchema -update-schema", serverSchema)
+	}
+}